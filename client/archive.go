@@ -0,0 +1,349 @@
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// PAX record keys used for SAFE attributes in tar archives
+const (
+	paxMetadata  = "SAFE.metadata"
+	paxPrivate   = "SAFE.private"
+	paxVersioned = "SAFE.versioned"
+)
+
+// ExportInfo are parameters for Client.ExportTar and Client.ExportZip
+type ExportInfo struct {
+	// The directory to export. It is the root of the archive and is not itself included.
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// If not nil, this is called with the combined progress of all file downloads. The total is not known.
+	Progress ProgressFunc
+}
+
+// ImportInfo are parameters for Client.ImportTar and Client.ImportZip
+type ImportInfo struct {
+	// The existing directory to import the archive contents under
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// If not nil, this is called with the combined progress of all file uploads. The total is only known for zip
+	// archives.
+	Progress ProgressFunc
+}
+
+// archiveAttrs are the SAFE attributes of an archive entry that don't have a standard place in the archive format
+type archiveAttrs struct {
+	Metadata  string `json:"metadata,omitempty"`
+	Private   bool   `json:"isPrivate,omitempty"`
+	Versioned bool   `json:"isVersioned,omitempty"`
+}
+
+// exportEntry is called for every directory and file in an export with the path relative to the exported directory.
+// The contents are only set for files.
+type exportEntry func(relPath string, dir *DirInfo, file *FileInfo, contents []byte) error
+
+func (c *Client) export(ei ExportInfo, fn exportEntry) error {
+	var agg *progressAggregator
+	if ei.Progress != nil {
+		agg = newProgressAggregator(ei.Progress, -1)
+	}
+	rootPath := path.Clean("/" + ei.DirPath)
+	err := c.Walk(WalkInfo{DirPath: rootPath, Shared: ei.Shared}, func(entryPath string, dir *DirInfo, file *FileInfo,
+		err error) error {
+		if err != nil {
+			return err
+		} else if entryPath == rootPath {
+			return nil
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(entryPath, rootPath), "/")
+		if dir != nil {
+			return fn(relPath+"/", dir, nil, nil)
+		}
+		// We export the stored bytes as is because the metadata (e.g. for compression) describes them
+		rc, err := c.GetFile(GetFileInfo{FilePath: entryPath, Shared: ei.Shared, Progress: agg.transfer()})
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		contents, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return fmt.Errorf("Unable to read %v: %v", entryPath, err)
+		}
+		return fn(relPath, nil, file, contents)
+	})
+	if err == nil {
+		agg.finish()
+	}
+	return err
+}
+
+// ExportTar writes the directory tree at ExportInfo.DirPath as a tar archive. Modification times are kept in the
+// headers and SAFE metadata and directory flags are kept in PAX records.
+func (c *Client) ExportTar(w io.Writer, ei ExportInfo) error {
+	tw := tar.NewWriter(w)
+	err := c.export(ei, func(relPath string, dir *DirInfo, file *FileInfo, contents []byte) error {
+		var header *tar.Header
+		if dir != nil {
+			header = &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     relPath,
+				Mode:     0755,
+				ModTime:  dir.ModifiedOn.Time(),
+				PAXRecords: map[string]string{
+					paxPrivate:   strconv.FormatBool(dir.Private),
+					paxVersioned: strconv.FormatBool(dir.Versioned),
+				},
+			}
+			if dir.Metadata != "" {
+				header.PAXRecords[paxMetadata] = dir.Metadata
+			}
+		} else {
+			header = &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     relPath,
+				Mode:     0644,
+				Size:     int64(len(contents)),
+				ModTime:  file.ModifiedOn.Time(),
+			}
+			if file.Metadata != "" {
+				header.PAXRecords = map[string]string{paxMetadata: file.Metadata}
+			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("Unable to write tar header: %v", err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return fmt.Errorf("Unable to write tar contents: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExportZip writes the directory tree at ExportInfo.DirPath as a zip archive. Modification times are kept in the
+// headers and SAFE metadata and directory flags are kept as JSON in each entry's comment.
+func (c *Client) ExportZip(w io.Writer, ei ExportInfo) error {
+	zw := zip.NewWriter(w)
+	err := c.export(ei, func(relPath string, dir *DirInfo, file *FileInfo, contents []byte) error {
+		header := &zip.FileHeader{Name: relPath, Method: zip.Deflate}
+		var attrs archiveAttrs
+		if dir != nil {
+			header.Method = zip.Store
+			header.Modified = dir.ModifiedOn.Time()
+			attrs = archiveAttrs{Metadata: dir.Metadata, Private: dir.Private, Versioned: dir.Versioned}
+		} else {
+			header.Modified = file.ModifiedOn.Time()
+			attrs = archiveAttrs{Metadata: file.Metadata}
+		}
+		if attrs != (archiveAttrs{}) {
+			comment, err := json.Marshal(attrs)
+			if err != nil {
+				return err
+			}
+			header.Comment = string(comment)
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("Unable to write zip header: %v", err)
+		}
+		if _, err := fw.Write(contents); err != nil {
+			return fmt.Errorf("Unable to write zip contents: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// importer tracks the directories that exist so parents missing from the archive can be created
+type importer struct {
+	c    *Client
+	ii   ImportInfo
+	dirs map[string]bool
+	agg  *progressAggregator
+}
+
+func (c *Client) newImporter(ii ImportInfo, total int64) *importer {
+	ii.DirPath = path.Clean("/" + ii.DirPath)
+	imp := &importer{c: c, ii: ii, dirs: map[string]bool{ii.DirPath: true}}
+	if ii.Progress != nil {
+		imp.agg = newProgressAggregator(ii.Progress, total)
+	}
+	return imp
+}
+
+func (i *importer) fullPath(name string) (string, error) {
+	// Archives with paths outside the root are rejected rather than cleaned
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("Invalid archive entry name: %v", name)
+		}
+	}
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" {
+		return "", fmt.Errorf("Invalid archive entry name: %v", name)
+	}
+	return path.Join(i.ii.DirPath, cleaned), nil
+}
+
+func (i *importer) dir(name string, attrs archiveAttrs) error {
+	dirPath, err := i.fullPath(name)
+	if err != nil {
+		return err
+	}
+	if err = i.ensureDir(path.Dir(dirPath)); err != nil {
+		return err
+	}
+	return i.createDir(dirPath, attrs)
+}
+
+func (i *importer) ensureDir(dirPath string) error {
+	if i.dirs[dirPath] {
+		return nil
+	}
+	if err := i.ensureDir(path.Dir(dirPath)); err != nil {
+		return err
+	}
+	return i.createDir(dirPath, archiveAttrs{})
+}
+
+func (i *importer) createDir(dirPath string, attrs archiveAttrs) error {
+	if i.dirs[dirPath] {
+		return nil
+	}
+	err := i.c.MkdirAll(CreateDirInfo{
+		DirPath:   dirPath,
+		Private:   attrs.Private,
+		Versioned: attrs.Versioned,
+		Metadata:  attrs.Metadata,
+		Shared:    i.ii.Shared,
+	})
+	if err != nil {
+		return err
+	}
+	i.dirs[dirPath] = true
+	return nil
+}
+
+func (i *importer) file(name string, attrs archiveAttrs, contents io.Reader) error {
+	filePath, err := i.fullPath(name)
+	if err != nil {
+		return err
+	}
+	if err = i.ensureDir(path.Dir(filePath)); err != nil {
+		return err
+	}
+	byts, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return fmt.Errorf("Unable to read %v from archive: %v", name, err)
+	}
+	// Existing files are replaced instead of written over so no old content is left behind
+	createInfo := CreateFileInfo{FilePath: filePath, Shared: i.ii.Shared, Metadata: attrs.Metadata}
+	if err = i.c.CreateFile(createInfo); err != nil {
+		if _, statErr := i.c.statFile(filePath, i.ii.Shared); statErr != nil {
+			return err
+		}
+		if err = i.c.DeleteFile(DeleteFileInfo{FilePath: filePath, Shared: i.ii.Shared}); err != nil {
+			return err
+		}
+		if err = i.c.CreateFile(createInfo); err != nil {
+			return err
+		}
+	}
+	if len(byts) == 0 {
+		i.agg.fileWithoutTransfer()
+		return nil
+	}
+	return i.c.WriteFile(WriteFileInfo{
+		FilePath: filePath,
+		Shared:   i.ii.Shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(byts)),
+		Progress: i.agg.transfer(),
+	})
+}
+
+// ImportTar reads a tar archive and creates its directories and files under ImportInfo.DirPath, which must exist.
+// SAFE attributes written by ExportTar are restored. Existing files are replaced. Modification times can't be set on
+// SAFE so they are not restored.
+func (c *Client) ImportTar(r io.Reader, ii ImportInfo) error {
+	imp := c.newImporter(ii, -1)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			imp.agg.finish()
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Unable to read tar: %v", err)
+		}
+		attrs := archiveAttrs{Metadata: header.PAXRecords[paxMetadata]}
+		attrs.Private, _ = strconv.ParseBool(header.PAXRecords[paxPrivate])
+		attrs.Versioned, _ = strconv.ParseBool(header.PAXRecords[paxVersioned])
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = imp.dir(header.Name, attrs)
+		case tar.TypeReg:
+			err = imp.file(header.Name, attrs, tr)
+		default:
+			// Links, devices, etc have no SAFE equivalent
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportZip reads a zip archive and creates its directories and files under ImportInfo.DirPath, which must exist.
+// SAFE attributes written by ExportZip are restored. Existing files are replaced. Modification times can't be set on
+// SAFE so they are not restored.
+func (c *Client) ImportZip(r io.ReaderAt, size int64, ii ImportInfo) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("Unable to read zip: %v", err)
+	}
+	var total int64
+	for _, f := range zr.File {
+		total += int64(f.UncompressedSize64)
+	}
+	imp := c.newImporter(ii, total)
+	for _, f := range zr.File {
+		var attrs archiveAttrs
+		if f.Comment != "" {
+			if err := json.Unmarshal([]byte(f.Comment), &attrs); err != nil {
+				// Not ours, so just treat it as having no attributes
+				attrs = archiveAttrs{}
+			}
+		}
+		if strings.HasSuffix(f.Name, "/") {
+			err = imp.dir(f.Name, attrs)
+		} else {
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err != nil {
+				return fmt.Errorf("Unable to read %v from zip: %v", f.Name, err)
+			}
+			err = imp.file(f.Name, attrs, rc)
+			rc.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	imp.agg.finish()
+	return nil
+}
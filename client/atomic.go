@@ -0,0 +1,133 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// WriteFileAtomicInfo are parameters for Client.WriteFileAtomic
+type WriteFileAtomicInfo struct {
+	// The path to write to. It may or may not exist.
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// The contents to write
+	Contents io.ReadCloser
+	// The metadata of the new file
+	Metadata string
+	// If true, the contents are compressed like WriteFileInfo.Compress
+	Compress bool
+	// If not nil, this is called with the progress of the upload
+	Progress ProgressFunc
+}
+
+// Temp files for atomic writes are named .<name>.tmp-<random> while being written and .<name>.new-<random> once they
+// are complete and about to be swapped in
+const (
+	atomicTempMarker  = ".tmp-"
+	atomicReadyMarker = ".new-"
+)
+
+// WriteFileAtomic replaces the file at WriteFileAtomicInfo.FilePath with the given contents so that readers never see
+// the file partially written. The contents are written to a hidden temp file in the same directory which, once
+// complete, is swapped in by deleting the old file and renaming the temp file. The launcher can't rename over a file,
+// so between the delete and the rename the file doesn't exist, but it is never there with partial contents.
+//
+// If a previous atomic write of the same file failed, its leftovers are cleaned up first and, if it failed between
+// the delete and the rename, its complete new file is put in place. This means concurrent atomic writes to the same
+// file are not supported and should be guarded with a Lock.
+func (c *Client) WriteFileAtomic(wf WriteFileAtomicInfo) error {
+	defer wf.Contents.Close()
+	wf.FilePath = path.Clean("/" + wf.FilePath)
+	dirPath, name := path.Dir(wf.FilePath), path.Base(wf.FilePath)
+	if err := c.recoverFileAtomic(dirPath, name, wf.Shared); err != nil {
+		return err
+	}
+	suffix, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	tempPath := path.Join(dirPath, "."+name+atomicTempMarker+suffix)
+	readyName := "." + name + atomicReadyMarker + suffix
+	readyPath := path.Join(dirPath, readyName)
+
+	// Write the temp file and mark it complete
+	err = c.CreateFile(CreateFileInfo{FilePath: tempPath, Shared: wf.Shared, Metadata: wf.Metadata})
+	if err != nil {
+		return fmt.Errorf("Unable to create temp file: %v", err)
+	}
+	err = c.WriteFile(WriteFileInfo{
+		FilePath: tempPath,
+		Shared:   wf.Shared,
+		Contents: wf.Contents,
+		Compress: wf.Compress,
+		Progress: wf.Progress,
+	})
+	if err == nil {
+		err = c.ChangeFile(ChangeFileInfo{FilePath: tempPath, Shared: wf.Shared, NewName: readyName})
+	}
+	if err != nil {
+		c.DeleteFile(DeleteFileInfo{FilePath: tempPath, Shared: wf.Shared})
+		return fmt.Errorf("Unable to write temp file: %v", err)
+	}
+
+	// Swap it in
+	dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: wf.Shared})
+	if err != nil {
+		c.DeleteFile(DeleteFileInfo{FilePath: readyPath, Shared: wf.Shared})
+		return fmt.Errorf("Unable to read dir: %v", err)
+	}
+	for _, file := range dir.Files {
+		if file.Name == name {
+			if err = c.DeleteFile(DeleteFileInfo{FilePath: wf.FilePath, Shared: wf.Shared}); err != nil {
+				c.DeleteFile(DeleteFileInfo{FilePath: readyPath, Shared: wf.Shared})
+				return fmt.Errorf("Unable to delete old file: %v", err)
+			}
+			break
+		}
+	}
+	if err = c.ChangeFile(ChangeFileInfo{FilePath: readyPath, Shared: wf.Shared, NewName: name}); err != nil {
+		// Try once more to put it in place, otherwise the next atomic write of this file will
+		if recoverErr := c.recoverFileAtomic(dirPath, name, wf.Shared); recoverErr != nil {
+			return fmt.Errorf("Unable to rename temp file %v: %v", readyPath, err)
+		}
+	}
+	return nil
+}
+
+// recoverFileAtomic cleans up after failed atomic writes of the named file. Incomplete temp files are deleted. A
+// complete one is renamed into place if the file is missing, otherwise it is deleted too.
+func (c *Client) recoverFileAtomic(dirPath string, name string, shared bool) error {
+	c.invalidateCache(dirPath, shared)
+	dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: shared})
+	if err != nil {
+		return fmt.Errorf("Unable to read dir: %v", err)
+	}
+	exists := false
+	leftovers := []string{}
+	for _, file := range dir.Files {
+		if file.Name == name {
+			exists = true
+		} else if strings.HasPrefix(file.Name, "."+name+atomicTempMarker) ||
+			strings.HasPrefix(file.Name, "."+name+atomicReadyMarker) {
+			leftovers = append(leftovers, file.Name)
+		}
+	}
+	for _, leftover := range leftovers {
+		leftoverPath := path.Join(dirPath, leftover)
+		if !exists && strings.HasPrefix(leftover, "."+name+atomicReadyMarker) {
+			err = c.ChangeFile(ChangeFileInfo{FilePath: leftoverPath, Shared: shared, NewName: name})
+			if err != nil {
+				return fmt.Errorf("Unable to recover %v: %v", leftoverPath, err)
+			}
+			exists = true
+			continue
+		}
+		if err = c.DeleteFile(DeleteFileInfo{FilePath: leftoverPath, Shared: shared}); err != nil {
+			return fmt.Errorf("Unable to delete leftover %v: %v", leftoverPath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,651 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backups are stored in a directory on SAFE holding a manifest per snapshot and the chunks of file contents they
+// reference:
+//
+//	snapshots/<id>.json   The manifest for a snapshot
+//	chunks/ab/abcd...     A chunk, named by the hex SHA-256 of its contents
+//
+// Files are split into chunks at boundaries chosen by their contents, so a change in one part of a file only changes
+// the chunks around it. Each unique chunk is stored once no matter how many files or snapshots contain it.
+
+const (
+	backupMinChunk = 256 * 1024
+	backupMaxChunk = 4 * 1024 * 1024
+	// A boundary is cut when the top 20 bits of the rolling hash are zero, giving chunks of about 1MB on average
+	backupChunkMask = uint64(1<<20-1) << 44
+	// Snapshot and trash entry IDs are their UTC time in this format so they sort in the order they were taken
+	timeIDFormat = "20060102T150405.000Z"
+)
+
+// backupGear is the table of random values for the gear rolling hash. It is generated from a fixed seed since chunk
+// boundaries, and therefore deduplication, depend on it never changing.
+var backupGear [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x5afec11e47)
+	for i := range backupGear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		backupGear[i] = z ^ (z >> 31)
+	}
+}
+
+// BackupSnapshot is the manifest of a single backup
+type BackupSnapshot struct {
+	// The ID of the snapshot, which is also the name of its manifest without the extension
+	ID string `json:"-"`
+	// When the backup was taken
+	Time time.Time `json:"time"`
+	// The local directory that was backed up
+	Source string `json:"source"`
+	// Every directory and file in the backup, parents first
+	Entries []BackupEntry `json:"entries"`
+}
+
+// Size gives the total size of the files in the snapshot
+func (s *BackupSnapshot) Size() int64 {
+	var size int64
+	for _, entry := range s.Entries {
+		size += entry.Size
+	}
+	return size
+}
+
+// BackupEntry is a directory or file in a BackupSnapshot
+type BackupEntry struct {
+	// The slash separated path relative to the backed up directory
+	Path string `json:"path"`
+	// Whether this is a directory
+	Dir bool `json:"dir,omitempty"`
+	// The permission bits of the local file
+	Mode os.FileMode `json:"mode"`
+	// The modification time of the local file
+	ModTime time.Time `json:"modTime"`
+	// The size of the file
+	Size int64 `json:"size,omitempty"`
+	// The hashes of the chunks that make up the file in order
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+// BackupInfo are parameters for Client.Backup
+type BackupInfo struct {
+	// The local directory to back up
+	LocalDir string
+	// The directory on SAFE to store the backup in. It is created if it doesn't exist.
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// If not nil, this is called with the combined progress of all chunk uploads. The total is not known.
+	Progress ProgressFunc
+}
+
+// RestoreBackupInfo are parameters for Client.RestoreBackup
+type RestoreBackupInfo struct {
+	// The directory on SAFE the backup is in
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The snapshot to restore. If empty, the latest snapshot is restored.
+	SnapshotID string
+	// The local directory to restore into. It is created if it doesn't exist and existing files are replaced.
+	LocalDir string
+	// If not nil, this is called with the combined progress of all chunk downloads
+	Progress ProgressFunc
+}
+
+// BackupSnapshotsInfo are parameters for Client.BackupSnapshots
+type BackupSnapshotsInfo struct {
+	// The directory on SAFE the backup is in
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+}
+
+// PruneBackupInfo are parameters for Client.PruneBackup
+type PruneBackupInfo struct {
+	// The directory on SAFE the backup is in
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The number of most recent snapshots to keep. This must be at least 1.
+	KeepLast int
+}
+
+// PruneBackupResult is what Client.PruneBackup removed
+type PruneBackupResult struct {
+	// The IDs of the removed snapshots
+	Snapshots []string
+	// The number of chunks removed because no snapshot referenced them anymore
+	Chunks int
+}
+
+// CheckBackupInfo are parameters for Client.CheckBackup
+type CheckBackupInfo struct {
+	// The directory on SAFE the backup is in
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// If true, every chunk is downloaded and its contents checked against its hash instead of just checking it exists
+	ReadData bool
+}
+
+// CheckBackupError is returned by Client.CheckBackup when the backup has problems
+type CheckBackupError struct {
+	// A description of each problem
+	Problems []string
+}
+
+func (c *CheckBackupError) Error() string {
+	return fmt.Sprintf("Backup has %v problems: %v", len(c.Problems), strings.Join(c.Problems, ", "))
+}
+
+// backupRepo is a backup directory on SAFE and the chunks known to be in it
+type backupRepo struct {
+	c       *Client
+	dirPath string
+	shared  bool
+	// The chunk names in each prefix directory, loaded as needed. A nil map means the directory doesn't exist.
+	chunks   map[string]map[string]bool
+	prefixes map[string]bool
+}
+
+func (c *Client) backupRepo(dirPath string, shared bool) *backupRepo {
+	return &backupRepo{c: c, dirPath: path.Clean("/" + dirPath), shared: shared, chunks: map[string]map[string]bool{}}
+}
+
+func (b *backupRepo) chunkPath(hash string) string {
+	return path.Join(b.dirPath, "chunks", hash[:2], hash)
+}
+
+// loadPrefixes lists the chunk prefix directories once
+func (b *backupRepo) loadPrefixes() error {
+	if b.prefixes != nil {
+		return nil
+	}
+	dir, err := b.c.GetDir(GetDirInfo{DirPath: path.Join(b.dirPath, "chunks"), Shared: b.shared})
+	if err != nil {
+		return fmt.Errorf("Unable to list chunks: %v", err)
+	}
+	b.prefixes = map[string]bool{}
+	for _, sub := range dir.SubDirs {
+		b.prefixes[sub.Name] = true
+	}
+	return nil
+}
+
+// loadChunks gives the chunk names in the prefix directory
+func (b *backupRepo) loadChunks(prefix string) (map[string]bool, error) {
+	if names, ok := b.chunks[prefix]; ok {
+		return names, nil
+	}
+	if err := b.loadPrefixes(); err != nil {
+		return nil, err
+	}
+	var names map[string]bool
+	if b.prefixes[prefix] {
+		dir, err := b.c.GetDir(GetDirInfo{DirPath: path.Join(b.dirPath, "chunks", prefix), Shared: b.shared})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list chunks: %v", err)
+		}
+		names = map[string]bool{}
+		for _, file := range dir.Files {
+			names[file.Name] = true
+		}
+	}
+	b.chunks[prefix] = names
+	return names, nil
+}
+
+// allChunks gives every chunk name in the backup
+func (b *backupRepo) allChunks() (map[string]bool, error) {
+	if err := b.loadPrefixes(); err != nil {
+		return nil, err
+	}
+	all := map[string]bool{}
+	for prefix := range b.prefixes {
+		names, err := b.loadChunks(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for name := range names {
+			all[name] = true
+		}
+	}
+	return all, nil
+}
+
+// putChunk uploads the chunk unless the backup already has it
+func (b *backupRepo) putChunk(contents []byte, agg *progressAggregator) (string, error) {
+	sum := sha256.Sum256(contents)
+	hash := hex.EncodeToString(sum[:])
+	names, err := b.loadChunks(hash[:2])
+	if err != nil {
+		return "", err
+	} else if names[hash] {
+		return hash, nil
+	} else if names == nil {
+		err = b.c.CreateDir(CreateDirInfo{DirPath: path.Join(b.dirPath, "chunks", hash[:2]), Shared: b.shared})
+		if err != nil {
+			return "", fmt.Errorf("Unable to create chunk directory: %v", err)
+		}
+		names = map[string]bool{}
+		b.chunks[hash[:2]] = names
+	}
+	if err = b.c.CreateFile(CreateFileInfo{FilePath: b.chunkPath(hash), Shared: b.shared}); err != nil {
+		return "", fmt.Errorf("Unable to create chunk: %v", err)
+	}
+	err = b.c.WriteFile(WriteFileInfo{
+		FilePath: b.chunkPath(hash),
+		Shared:   b.shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(contents)),
+		Progress: agg.transfer(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to write chunk: %v", err)
+	}
+	names[hash] = true
+	return hash, nil
+}
+
+// getChunk downloads the chunk and checks it against its hash
+func (b *backupRepo) getChunk(hash string, progress ProgressFunc) ([]byte, error) {
+	rc, err := b.c.GetFile(GetFileInfo{FilePath: b.chunkPath(hash), Shared: b.shared, Progress: progress})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get chunk %v: %v", hash, err)
+	}
+	defer rc.Close()
+	contents, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read chunk %v: %v", hash, err)
+	}
+	if sum := sha256.Sum256(contents); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("Chunk %v is corrupt", hash)
+	}
+	return contents, nil
+}
+
+// snapshotIDs gives the IDs of all snapshots, oldest first
+func (b *backupRepo) snapshotIDs() ([]string, error) {
+	dir, err := b.c.GetDir(GetDirInfo{DirPath: path.Join(b.dirPath, "snapshots"), Shared: b.shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list snapshots: %v", err)
+	}
+	ids := []string{}
+	for _, file := range dir.Files {
+		if strings.HasSuffix(file.Name, ".json") {
+			ids = append(ids, strings.TrimSuffix(file.Name, ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (b *backupRepo) snapshot(id string) (*BackupSnapshot, error) {
+	rc, err := b.c.GetFile(GetFileInfo{FilePath: path.Join(b.dirPath, "snapshots", id+".json"), Shared: b.shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get snapshot %v: %v", id, err)
+	}
+	defer rc.Close()
+	snapshot := &BackupSnapshot{ID: id}
+	if err = json.NewDecoder(rc).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("Invalid snapshot %v: %v", id, err)
+	}
+	return snapshot, nil
+}
+
+// ensureDirs creates the backup directories that don't exist yet
+func (b *backupRepo) ensureDirs() error {
+	for _, dir := range []string{path.Join(b.dirPath, "chunks"), path.Join(b.dirPath, "snapshots")} {
+		if err := b.c.MkdirAll(CreateDirInfo{DirPath: dir, Shared: b.shared}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkReader splits what it reads into content defined chunks using a gear rolling hash
+type chunkReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newChunkReader(r io.Reader) *chunkReader {
+	return &chunkReader{r: bufio.NewReaderSize(r, 64*1024), buf: make([]byte, 0, backupMaxChunk)}
+}
+
+// next gives the next chunk, which is only valid until the next call, or io.EOF when there are no more
+func (c *chunkReader) next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for len(c.buf) < backupMaxChunk {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		hash = hash<<1 + backupGear[b]
+		if len(c.buf) >= backupMinChunk && hash&backupChunkMask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
+
+// Backup stores a new snapshot of BackupInfo.LocalDir. Only chunks the backup doesn't already have are uploaded. The
+// manifest is written last so an interrupted backup leaves no snapshot, only chunks that PruneBackup removes.
+// Symbolic links and other special files are skipped.
+func (c *Client) Backup(bi BackupInfo) (*BackupSnapshot, error) {
+	var agg *progressAggregator
+	if bi.Progress != nil {
+		agg = newProgressAggregator(bi.Progress, -1)
+	}
+	repo := c.backupRepo(bi.DirPath, bi.Shared)
+	if err := repo.ensureDirs(); err != nil {
+		return nil, fmt.Errorf("Unable to create backup directory: %v", err)
+	}
+	root, err := filepath.Abs(bi.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &BackupSnapshot{Time: time.Now().UTC(), Source: root, Entries: []BackupEntry{}}
+	snapshot.ID = snapshot.Time.Format(timeIDFormat)
+	err = filepath.Walk(root, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if localPath == root || (!info.IsDir() && !info.Mode().IsRegular()) {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, localPath)
+		if err != nil {
+			return err
+		}
+		entry := BackupEntry{
+			Path:    filepath.ToSlash(relPath),
+			Dir:     info.IsDir(),
+			Mode:    info.Mode().Perm(),
+			ModTime: info.ModTime().UTC(),
+		}
+		if !entry.Dir {
+			if entry.Size, entry.Chunks, err = repo.putFile(localPath, agg); err != nil {
+				return err
+			}
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := path.Join(repo.dirPath, "snapshots", snapshot.ID+".json")
+	if err = c.CreateFile(CreateFileInfo{FilePath: manifestPath, Shared: bi.Shared}); err != nil {
+		return nil, fmt.Errorf("Unable to create snapshot: %v", err)
+	}
+	err = c.WriteFile(WriteFileInfo{
+		FilePath: manifestPath,
+		Shared:   bi.Shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(manifest)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to write snapshot: %v", err)
+	}
+	agg.finish()
+	return snapshot, nil
+}
+
+func (b *backupRepo) putFile(localPath string, agg *progressAggregator) (int64, []string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	var size int64
+	hashes := []string{}
+	chunks := newChunkReader(f)
+	for {
+		chunk, err := chunks.next()
+		if err == io.EOF {
+			return size, hashes, nil
+		} else if err != nil {
+			return 0, nil, fmt.Errorf("Unable to read %v: %v", localPath, err)
+		}
+		hash, err := b.putChunk(chunk, agg)
+		if err != nil {
+			return 0, nil, err
+		}
+		size += int64(len(chunk))
+		hashes = append(hashes, hash)
+	}
+}
+
+// RestoreBackup writes the files and directories of a snapshot under RestoreBackupInfo.LocalDir with their modes and
+// modification times. Each chunk is checked against its hash as it is downloaded.
+func (c *Client) RestoreBackup(ri RestoreBackupInfo) (*BackupSnapshot, error) {
+	repo := c.backupRepo(ri.DirPath, ri.Shared)
+	id := ri.SnapshotID
+	if id == "" {
+		ids, err := repo.snapshotIDs()
+		if err != nil {
+			return nil, err
+		} else if len(ids) == 0 {
+			return nil, fmt.Errorf("No snapshots in %v", repo.dirPath)
+		}
+		id = ids[len(ids)-1]
+	}
+	snapshot, err := repo.snapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	var agg *progressAggregator
+	if ri.Progress != nil {
+		agg = newProgressAggregator(ri.Progress, snapshot.Size())
+	}
+	if err = os.MkdirAll(ri.LocalDir, 0755); err != nil {
+		return nil, err
+	}
+	for _, entry := range snapshot.Entries {
+		// Manifests with paths outside the root are rejected rather than cleaned
+		if entry.Path == "" || path.IsAbs(entry.Path) {
+			return nil, fmt.Errorf("Invalid snapshot entry path: %v", entry.Path)
+		}
+		for _, part := range strings.Split(entry.Path, "/") {
+			if part == ".." {
+				return nil, fmt.Errorf("Invalid snapshot entry path: %v", entry.Path)
+			}
+		}
+		localPath := filepath.Join(ri.LocalDir, filepath.FromSlash(entry.Path))
+		if entry.Dir {
+			err = os.MkdirAll(localPath, entry.Mode|0700)
+		} else {
+			err = repo.restoreFile(localPath, entry, agg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Directory times are set last since restoring what is in them changes them
+	for i := len(snapshot.Entries) - 1; i >= 0; i-- {
+		entry := snapshot.Entries[i]
+		localPath := filepath.Join(ri.LocalDir, filepath.FromSlash(entry.Path))
+		if entry.Dir {
+			if err = os.Chmod(localPath, entry.Mode); err == nil {
+				err = os.Chtimes(localPath, entry.ModTime, entry.ModTime)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	agg.finish()
+	return snapshot, nil
+}
+
+func (b *backupRepo) restoreFile(localPath string, entry BackupEntry, agg *progressAggregator) error {
+	f, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode|0600)
+	if err != nil {
+		return err
+	}
+	for _, hash := range entry.Chunks {
+		var contents []byte
+		if contents, err = b.getChunk(hash, agg.transfer()); err != nil {
+			break
+		}
+		if _, err = f.Write(contents); err != nil {
+			break
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to restore %v: %v", entry.Path, err)
+	}
+	if len(entry.Chunks) == 0 {
+		agg.fileWithoutTransfer()
+	}
+	if err = os.Chmod(localPath, entry.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(localPath, entry.ModTime, entry.ModTime)
+}
+
+// BackupSnapshots gives all snapshots in the backup, oldest first
+func (c *Client) BackupSnapshots(si BackupSnapshotsInfo) ([]*BackupSnapshot, error) {
+	repo := c.backupRepo(si.DirPath, si.Shared)
+	ids, err := repo.snapshotIDs()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]*BackupSnapshot, len(ids))
+	for i, id := range ids {
+		if snapshots[i], err = repo.snapshot(id); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+// PruneBackup removes all but the most recent PruneBackupInfo.KeepLast snapshots and then the chunks no remaining
+// snapshot references. It must not be run while a backup to the same directory is in progress since the chunks that
+// backup has uploaded so far aren't referenced yet.
+func (c *Client) PruneBackup(pi PruneBackupInfo) (PruneBackupResult, error) {
+	result := PruneBackupResult{Snapshots: []string{}}
+	if pi.KeepLast < 1 {
+		return result, fmt.Errorf("Must keep at least 1 snapshot, got %v", pi.KeepLast)
+	}
+	repo := c.backupRepo(pi.DirPath, pi.Shared)
+	ids, err := repo.snapshotIDs()
+	if err != nil {
+		return result, err
+	}
+	// Read what is kept before removing anything so a bad manifest doesn't lose chunks
+	referenced := map[string]bool{}
+	removed := len(ids) - pi.KeepLast
+	if removed < 0 {
+		removed = 0
+	}
+	for _, id := range ids[removed:] {
+		snapshot, err := repo.snapshot(id)
+		if err != nil {
+			return result, err
+		}
+		for _, entry := range snapshot.Entries {
+			for _, hash := range entry.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+	for _, id := range ids[:removed] {
+		manifestPath := path.Join(repo.dirPath, "snapshots", id+".json")
+		if err = c.DeleteFile(DeleteFileInfo{FilePath: manifestPath, Shared: pi.Shared}); err != nil {
+			return result, fmt.Errorf("Unable to remove snapshot %v: %v", id, err)
+		}
+		result.Snapshots = append(result.Snapshots, id)
+	}
+	chunks, err := repo.allChunks()
+	if err != nil {
+		return result, err
+	}
+	for hash := range chunks {
+		if referenced[hash] {
+			continue
+		}
+		if err = c.DeleteFile(DeleteFileInfo{FilePath: repo.chunkPath(hash), Shared: pi.Shared}); err != nil {
+			return result, fmt.Errorf("Unable to remove chunk %v: %v", hash, err)
+		}
+		result.Chunks++
+	}
+	return result, nil
+}
+
+// CheckBackup makes sure every snapshot can be read and every chunk they reference exists, or with
+// CheckBackupInfo.ReadData, is intact. If there are problems, a *CheckBackupError is returned.
+func (c *Client) CheckBackup(ci CheckBackupInfo) error {
+	repo := c.backupRepo(ci.DirPath, ci.Shared)
+	ids, err := repo.snapshotIDs()
+	if err != nil {
+		return err
+	}
+	chunks, err := repo.allChunks()
+	if err != nil {
+		return err
+	}
+	problems := []string{}
+	checked := map[string]bool{}
+	for _, id := range ids {
+		snapshot, err := repo.snapshot(id)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for _, entry := range snapshot.Entries {
+			for _, hash := range entry.Chunks {
+				if checked[hash] {
+					continue
+				}
+				checked[hash] = true
+				if !chunks[hash] {
+					problems = append(problems,
+						fmt.Sprintf("Chunk %v of %v in snapshot %v is missing", hash, entry.Path, id))
+				} else if ci.ReadData {
+					if _, err := repo.getChunk(hash, nil); err != nil {
+						problems = append(problems, err.Error())
+					}
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &CheckBackupError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheMaxEntries is the number of entries kept in memory when CacheConf.MaxEntries is 0
+const DefaultCacheMaxEntries = 1000
+
+// DefaultCacheMaxFileSize is the largest file cached when CacheConf.MaxFileSize is 0
+const DefaultCacheMaxFileSize = 1024 * 1024
+
+// Kinds of cache entries. They are also the top level directories of the on-disk store.
+const (
+	cacheKindDir     = "dir"
+	cacheKindFile    = "file"
+	cacheKindDNSDir  = "dnsdir"
+	cacheKindDNSFile = "dnsfile"
+)
+
+// CacheConf is the configuration for NewCache
+type CacheConf struct {
+	// The maximum number of entries kept in memory. The least recently used are dropped first. If 0,
+	// DefaultCacheMaxEntries is used.
+	MaxEntries int
+	// How long an entry is used without revalidating it. If 0, entries are always revalidated.
+	TTL time.Duration
+	// Files larger than this are not cached. If 0, DefaultCacheMaxFileSize is used.
+	MaxFileSize int64
+	// If set, entries are also stored in this local directory so they can be used by later processes
+	Dir string
+}
+
+// Cache is a read-through cache of directory listings and file contents for a Client. Set Client.Cache to use it.
+//
+// Entries older than CacheConf.TTL are revalidated before use. Directories and files are revalidated by comparing their
+// modification time with the listing of their parent directory, which is itself cached. DNS entries can't be
+// revalidated that way and are fetched again once expired. Mutations made through the client invalidate the affected
+// entries. Changes made by anything else are only seen once entries expire.
+type Cache struct {
+	conf    CacheConf
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// cacheEntry is a single cached value. Only the fields for its kind are set.
+type cacheEntry struct {
+	Key         string       `json:"key"`
+	Stored      time.Time    `json:"stored"`
+	Dir         *DirResponse `json:"dir,omitempty"`
+	File        *FileInfo    `json:"file,omitempty"`
+	ContentType string       `json:"contentType,omitempty"`
+	Contents    []byte       `json:"contents,omitempty"`
+}
+
+// NewCache creates a new cache. If CacheConf.Dir is set it is created if it doesn't exist.
+func NewCache(conf CacheConf) (*Cache, error) {
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = DefaultCacheMaxEntries
+	}
+	if conf.MaxFileSize <= 0 {
+		conf.MaxFileSize = DefaultCacheMaxFileSize
+	}
+	if conf.Dir != "" {
+		if err := os.MkdirAll(conf.Dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{conf: conf, entries: map[string]*list.Element{}, lru: list.New()}, nil
+}
+
+func cacheKey(kind string, shared bool, entryPath string) string {
+	return kind + ":" + strconv.FormatBool(shared) + ":" + path.Clean("/"+entryPath)
+}
+
+func dnsCacheKey(kind string, name string, service string, filePath string) string {
+	return kind + ":" + name + ":" + service + ":" + path.Clean("/"+filePath)
+}
+
+// get returns the entry for the key whether or not it has expired
+func (c *Cache) get(key string) *cacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*cacheEntry)
+	}
+	if c.conf.Dir == "" {
+		return nil
+	}
+	byts, err := ioutil.ReadFile(c.diskPath(key, true))
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(byts, entry); err != nil || entry.Key != key {
+		return nil
+	}
+	c.putInMemory(entry)
+	return entry
+}
+
+func (c *Cache) fresh(entry *cacheEntry) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return time.Since(entry.Stored) < c.conf.TTL
+}
+
+// touch marks a revalidated entry as fresh again
+func (c *Cache) touch(entry *cacheEntry) {
+	c.lock.Lock()
+	entry.Stored = time.Now()
+	c.lock.Unlock()
+	c.writeToDisk(entry)
+}
+
+func (c *Cache) put(entry *cacheEntry) {
+	entry.Stored = time.Now()
+	c.lock.Lock()
+	c.putInMemory(entry)
+	c.lock.Unlock()
+	c.writeToDisk(entry)
+}
+
+func (c *Cache) putInMemory(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.Key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.conf.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+}
+
+func (c *Cache) writeToDisk(entry *cacheEntry) {
+	if c.conf.Dir == "" {
+		return
+	}
+	// The disk store is best effort, a failed write is just a future miss
+	c.lock.Lock()
+	byts, err := json.Marshal(entry)
+	c.lock.Unlock()
+	if err != nil {
+		return
+	}
+	diskPath := c.diskPath(entry.Key, true)
+	if err = os.MkdirAll(filepath.Dir(diskPath), 0700); err == nil {
+		if err = ioutil.WriteFile(diskPath+".tmp", byts, 0600); err == nil {
+			os.Rename(diskPath+".tmp", diskPath)
+		}
+	}
+}
+
+// diskPath gives the location of a key in the on-disk store. The kind is the top directory and each other piece of
+// the key is its own directory so everything under a path can be removed at once. If entry is false, the directory
+// for the key is returned instead.
+func (c *Cache) diskPath(key string, entry bool) string {
+	pieces := strings.SplitN(key, ":/", 2)
+	elems := strings.Split(pieces[0], ":")
+	if len(pieces) == 2 && pieces[1] != "" {
+		elems = append(elems, strings.Split(pieces[1], "/")...)
+	}
+	diskPath := filepath.Join(c.conf.Dir, elems[0])
+	for _, elem := range elems[1:] {
+		// Prefixed so no element can be confused with the entry file or be a relative path
+		diskPath = filepath.Join(diskPath, "p"+url.PathEscape(elem))
+	}
+	if entry {
+		return filepath.Join(diskPath, "entry.json")
+	}
+	return diskPath
+}
+
+// remove removes the entries for the given keys. If tree is true, all entries under the key's path are removed too.
+func (c *Cache) remove(key string, tree bool) {
+	c.lock.Lock()
+	for entryKey, elem := range c.entries {
+		if entryKey == key || (tree && strings.HasPrefix(entryKey, strings.TrimSuffix(key, "/")+"/")) {
+			c.lru.Remove(elem)
+			delete(c.entries, entryKey)
+		}
+	}
+	c.lock.Unlock()
+	if c.conf.Dir != "" {
+		if tree {
+			os.RemoveAll(c.diskPath(key, false))
+		} else {
+			os.Remove(c.diskPath(key, true))
+		}
+	}
+}
+
+// removeKind removes every entry of a kind
+func (c *Cache) removeKind(kind string) {
+	c.lock.Lock()
+	for entryKey, elem := range c.entries {
+		if strings.HasPrefix(entryKey, kind+":") {
+			c.lru.Remove(elem)
+			delete(c.entries, entryKey)
+		}
+	}
+	c.lock.Unlock()
+	if c.conf.Dir != "" {
+		os.RemoveAll(filepath.Join(c.conf.Dir, kind))
+	}
+}
+
+// Invalidate removes the cached entries for the path, everything under it, and the listing of its parent. DNS entries
+// are all removed since any path can be under a DNS service home directory. This is done automatically for changes
+// made through the client.
+func (c *Cache) Invalidate(entryPath string, shared bool) {
+	entryPath = path.Clean("/" + entryPath)
+	c.remove(cacheKey(cacheKindDir, shared, entryPath), true)
+	c.remove(cacheKey(cacheKindFile, shared, entryPath), true)
+	c.remove(cacheKey(cacheKindDir, shared, path.Dir(entryPath)), false)
+	c.removeDNS()
+}
+
+func (c *Cache) removeDNS() {
+	c.removeKind(cacheKindDNSDir)
+	c.removeKind(cacheKindDNSFile)
+}
+
+// Clear removes all cached entries from memory and disk
+func (c *Cache) Clear() {
+	c.lock.Lock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.lock.Unlock()
+	if c.conf.Dir != "" {
+		for _, kind := range []string{cacheKindDir, cacheKindFile, cacheKindDNSDir, cacheKindDNSFile} {
+			os.RemoveAll(filepath.Join(c.conf.Dir, kind))
+		}
+	}
+}
+
+// invalidateCache invalidates the path if there is a cache
+func (c *Client) invalidateCache(entryPath string, shared bool) {
+	if c.Cache != nil {
+		c.Cache.Invalidate(entryPath, shared)
+	}
+}
+
+// invalidateDNSCache removes all DNS entries if there is a cache
+func (c *Client) invalidateDNSCache() {
+	if c.Cache != nil {
+		c.Cache.removeDNS()
+	}
+}
+
+// cachedDir gives the cached listing if it is fresh or its modification time still matches its parent's listing
+func (c *Client) cachedDir(dirPath string, shared bool) (DirResponse, bool) {
+	entry := c.Cache.get(cacheKey(cacheKindDir, shared, dirPath))
+	if entry == nil || entry.Dir == nil {
+		return DirResponse{}, false
+	} else if c.Cache.fresh(entry) {
+		return copyDirResponse(*entry.Dir), true
+	}
+	// Only a fresh parent is used to revalidate, otherwise it'd be as slow as fetching
+	dirPath = path.Clean("/" + dirPath)
+	if dirPath == "/" {
+		return DirResponse{}, false
+	}
+	parent := c.Cache.get(cacheKey(cacheKindDir, shared, path.Dir(dirPath)))
+	if parent == nil || parent.Dir == nil || !c.Cache.fresh(parent) {
+		return DirResponse{}, false
+	}
+	for _, sub := range parent.Dir.SubDirs {
+		if sub.Name == path.Base(dirPath) && sub.ModifiedOn == entry.Dir.Info.ModifiedOn {
+			c.Cache.touch(entry)
+			return copyDirResponse(*entry.Dir), true
+		}
+	}
+	return DirResponse{}, false
+}
+
+// copyDirResponse copies the listing so callers can sort it without changing the cached one
+func copyDirResponse(dir DirResponse) DirResponse {
+	dir.SubDirs = append(Dirs{}, dir.SubDirs...)
+	dir.Files = append(Files{}, dir.Files...)
+	return dir
+}
+
+// cachedFile gives the cached contents if they are fresh or their modification time and size still match the parent
+// directory listing
+func (c *Client) cachedFile(filePath string, shared bool) ([]byte, bool) {
+	entry := c.Cache.get(cacheKey(cacheKindFile, shared, filePath))
+	if entry == nil || entry.File == nil {
+		return nil, false
+	} else if c.Cache.fresh(entry) {
+		return entry.Contents, true
+	}
+	info, err := c.statFile(filePath, shared)
+	if err != nil || info.ModifiedOn != entry.File.ModifiedOn || info.Size != entry.File.Size {
+		return nil, false
+	}
+	c.Cache.touch(entry)
+	return entry.Contents, true
+}
+
+// cachedDNS gives the cached DNS entry if it is fresh
+func (c *Client) cachedDNS(key string) *cacheEntry {
+	if entry := c.Cache.get(key); entry != nil && c.Cache.fresh(entry) {
+		return entry
+	}
+	return nil
+}
+
+// getFileWithCache serves the file from the cache, fetching and caching the whole file first if it isn't cached and
+// isn't too large
+func (c *Client) getFileWithCache(gf GetFileInfo) (io.ReadCloser, error) {
+	contents, ok := c.cachedFile(gf.FilePath, gf.Shared)
+	if !ok {
+		// Stat before reading so a change during the read fails revalidation instead of being trusted
+		info, err := c.statFile(gf.FilePath, gf.Shared)
+		if err != nil || info.Size > c.Cache.conf.MaxFileSize {
+			return c.getFile(gf)
+		}
+		rc, err := c.getFile(GetFileInfo{FilePath: gf.FilePath, Shared: gf.Shared, Progress: gf.Progress})
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		if contents, err = ioutil.ReadAll(rc); err != nil {
+			return nil, err
+		}
+		c.Cache.put(&cacheEntry{Key: cacheKey(cacheKindFile, gf.Shared, gf.FilePath), File: &info, Contents: contents})
+	} else if gf.Progress != nil {
+		size := int64(len(contents))
+		gf.Progress(Progress{Transferred: size, Total: size, Done: true})
+	}
+	return ioutil.NopCloser(bytes.NewReader(byteRange(contents, gf.Offset, gf.Length))), nil
+}
+
+// dnsFileWithCache serves the DNS file from the cache if fresh. Only full reads are cached.
+func (c *Client) dnsFileWithCache(df DNSFileInfo) (*DNSFile, error) {
+	key := dnsCacheKey(cacheKindDNSFile, df.Name, df.Service, df.FilePath)
+	if entry := c.cachedDNS(key); entry != nil && entry.File != nil {
+		if df.Progress != nil {
+			size := int64(len(entry.Contents))
+			df.Progress(Progress{Transferred: size, Total: size, Done: true})
+		}
+		return &DNSFile{
+			Info:        *entry.File,
+			ContentType: entry.ContentType,
+			Body:        ioutil.NopCloser(bytes.NewReader(byteRange(entry.Contents, df.Offset, df.Length))),
+		}, nil
+	}
+	file, err := c.dnsFile(df)
+	if err != nil || df.Offset != 0 || df.Length != 0 || file.Info.Size > c.Cache.conf.MaxFileSize {
+		return file, err
+	}
+	defer file.Body.Close()
+	contents, err := ioutil.ReadAll(file.Body)
+	if err != nil {
+		return nil, err
+	}
+	info := file.Info
+	c.Cache.put(&cacheEntry{Key: key, File: &info, ContentType: file.ContentType, Contents: contents})
+	file.Body = ioutil.NopCloser(bytes.NewReader(contents))
+	return file, nil
+}
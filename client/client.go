@@ -51,6 +51,12 @@ type Client struct {
 	ResponseHandler ResponseHandler
 	// If present, debug logs will be logged here
 	Logger *log.Logger
+	// If present, directory listings and file contents are cached here. See Cache for how entries are kept current.
+	Cache *Cache
+	// If true, changing files in versioned directories first saves the files as they were. See SaveVersion.
+	Versioning bool
+
+	versioned *versionedDirs
 }
 
 // APIError represents a server-side API error on non-2xx responses
@@ -74,6 +80,13 @@ func (a *APIError) Error() string {
 	return fmt.Sprintf("Server error %v: %v", a.HTTPResponse.StatusCode, string(bodyByts))
 }
 
+// IsNotExist reports whether the error is the launcher rejecting a request for a path, which is how it reports that the
+// path does not exist. Auth failures and server errors are not treated as the path not existing.
+func IsNotExist(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.HTTPResponse.StatusCode != 401 && apiErr.HTTPResponse.StatusCode < 500
+}
+
 // NewClient constructs a new client with the given conf.
 func NewClient(conf Conf) *Client {
 	newConf := conf
@@ -90,6 +103,7 @@ func NewClient(conf Conf) *Client {
 		ResponseHandler: func(c *Client, resp *http.Response, decrypt bool, jsonResponse interface{}) error {
 			return c.handleResponse(resp, decrypt, jsonResponse)
 		},
+		versioned: &versionedDirs{dirs: map[string]bool{}},
 	}
 }
 
@@ -114,6 +128,12 @@ type Request struct {
 	JSONResponse interface{}
 	// If true, the request will not be authenticated with Client.Conf.Token
 	DoNotAuth bool
+	// If not nil, this is called as the request body is sent. For encrypted requests, the sizes are of the unencrypted
+	// body.
+	UploadProgress ProgressFunc
+	// If not nil, this is called as the response body is read. For encrypted responses, the sizes are estimates of the
+	// unencrypted sizes.
+	DownloadProgress ProgressFunc
 }
 
 // Do makes the HTTP call to SAFE. Errors can be anything during the request or any non-2xx response.
@@ -131,10 +151,24 @@ func (c *Client) Do(req *Request) (*http.Response, error) {
 	if c.Logger != nil {
 		c.Logger.Printf("Calling %v %v", httpReq.Method, httpReq.URL)
 	}
+	if req.UploadProgress != nil && httpReq.Body != nil {
+		fn := req.UploadProgress
+		if !req.DoNotEncrypt {
+			fn = encryptedProgress(fn, int64(len(req.RawBody)))
+		}
+		httpReq.Body = NewProgressReader(httpReq.Body, httpReq.ContentLength, fn)
+	}
 	httpResp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
+	if req.DownloadProgress != nil {
+		fn := req.DownloadProgress
+		if !req.DoNotEncrypt {
+			fn = encryptedProgress(fn, -1)
+		}
+		httpResp.Body = NewProgressReader(httpResp.Body, httpResp.ContentLength, fn)
+	}
 	if c.ResponseHandler != nil {
 		err = c.ResponseHandler(c, httpResp, !req.DoNotEncrypt, req.JSONResponse)
 	} else {
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MetadataCompression is the Metadata key that holds the codec a file was compressed with by WriteFile
+	MetadataCompression = "compression"
+	// MetadataLogicalSize is the Metadata key that holds the uncompressed size of a file compressed by WriteFile
+	MetadataLogicalSize = "logicalSize"
+	// CompressionGzip is the value for MetadataCompression when the contents are gzip compressed
+	CompressionGzip = "gzip"
+)
+
+// Content types that are already compressed and therefore not worth compressing again. Any "image/", "audio/", or
+// "video/" type is also considered compressed unless it is in uncompressedMediaTypes.
+var compressedContentTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/pdf":              true,
+	"application/x-7z-compressed":  true,
+	"application/x-bzip2":          true,
+	"application/x-gzip":           true,
+	"application/x-rar-compressed": true,
+	"application/x-xz":             true,
+	"application/zip":              true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+var uncompressedMediaTypes = map[string]bool{
+	"image/bmp":     true,
+	"image/svg+xml": true,
+	"image/x-icon":  true,
+	"audio/wave":    true,
+	"audio/wav":     true,
+	"audio/x-wav":   true,
+}
+
+// LogicalSize is the size of the file contents as they were given to WriteFile. This differs from Size for files that
+// were compressed.
+func (f FileInfo) LogicalSize() int64 {
+	if size, err := strconv.ParseInt(ParseMetadata(f.Metadata)[MetadataLogicalSize], 10, 64); err == nil {
+		return size
+	}
+	return f.Size
+}
+
+func isCompressible(filePath string, contents []byte) bool {
+	contentType := mime.TypeByExtension(path.Ext(filePath))
+	if contentType == "" {
+		contentType = http.DetectContentType(contents)
+	}
+	// Remove any params such as charset
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	if compressedContentTypes[contentType] {
+		return false
+	}
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "audio/") ||
+		strings.HasPrefix(contentType, "video/") {
+		return uncompressedMediaTypes[contentType]
+	}
+	return true
+}
+
+// compressContents gives the bytes to store and the codec used. The codec is empty if the contents are left as is
+// because they are not compressible or compressing did not make them smaller.
+func compressContents(filePath string, contents []byte) ([]byte, string, error) {
+	if len(contents) == 0 || !isCompressible(filePath, contents) {
+		return contents, "", nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(contents); err != nil {
+		return nil, "", fmt.Errorf("Unable to compress contents: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("Unable to compress contents: %v", err)
+	}
+	if buf.Len() >= len(contents) {
+		return contents, "", nil
+	}
+	return buf.Bytes(), CompressionGzip, nil
+}
+
+func (c *Client) updateCompressionMetadata(filePath string, shared bool, compression string, logicalSize int64) error {
+	info, err := c.statFile(filePath, shared)
+	if err != nil {
+		return err
+	}
+	meta := ParseMetadata(info.Metadata)
+	existing := meta.String()
+	if compression == "" {
+		delete(meta, MetadataCompression)
+		delete(meta, MetadataLogicalSize)
+	} else {
+		meta[MetadataCompression] = compression
+		meta[MetadataLogicalSize] = strconv.FormatInt(logicalSize, 10)
+	}
+	updated := meta.String()
+	if updated == existing {
+		return nil
+	}
+	// ChangeFile won't accept empty metadata, so an empty object is the best we can do to clear it
+	if updated == "" {
+		updated = "{}"
+	}
+	return c.changeFile(ChangeFileInfo{FilePath: filePath, Shared: shared, Metadata: updated})
+}
+
+func (c *Client) getCompressedFile(gf GetFileInfo, compression string) (io.ReadCloser, error) {
+	if compression != CompressionGzip {
+		return nil, fmt.Errorf("Unsupported compression: %v", compression)
+	}
+	// Compressed content can't be read at an offset, so the whole thing is needed
+	rc, err := c.GetFile(GetFileInfo{FilePath: gf.FilePath, Shared: gf.Shared, Progress: gf.Progress})
+	if err != nil {
+		return nil, err
+	}
+	return decompressContents(rc, gf.Offset, gf.Length)
+}
+
+// decompressContents gives the gzip compressed contents decompressed, at the offset up to the length
+func decompressContents(rc io.ReadCloser, offset int64, length int64) (io.ReadCloser, error) {
+	defer rc.Close()
+	r, err := gzip.NewReader(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decompress file: %v", err)
+	}
+	// A shorter write leaves old bytes after the gzip stream, so stop at the end of it
+	r.Multistream(false)
+	byts, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decompress file: %v", err)
+	}
+	return ioutil.NopCloser(bytes.NewReader(byteRange(byts, offset, length))), nil
+}
+
+// byteRange gives the bytes at the offset up to the length, or all of them if the length is 0
+func byteRange(byts []byte, offset int64, length int64) []byte {
+	if offset > int64(len(byts)) {
+		offset = int64(len(byts))
+	}
+	byts = byts[offset:]
+	if length > 0 && length < int64(len(byts)) {
+		byts = byts[:length]
+	}
+	return byts
+}
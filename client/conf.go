@@ -0,0 +1,63 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// CLIAuthApp is the app the go-safeclient CLI authorizes as. Other programs in this project authorize as it too so they
+// can share the CLI's config file.
+var CLIAuthApp = AuthAppInfo{
+	Name:    "SAFE Client CLI",
+	ID:      "go-safeclient.cretz.github.com",
+	Version: "0.0.1",
+	Vendor:  "cretz",
+}
+
+// LoadConf reads the JSON conf from the given file. An empty conf is returned if the file does not exist.
+func LoadConf(confFile string) (Conf, error) {
+	var conf Conf
+	byts, err := ioutil.ReadFile(confFile)
+	if os.IsNotExist(err) {
+		return conf, nil
+	} else if err != nil {
+		return conf, fmt.Errorf("Unable to read conf: %v", err)
+	}
+	if err = json.Unmarshal(byts, &conf); err != nil {
+		return conf, fmt.Errorf("Invalid conf: %v", err)
+	}
+	return conf, nil
+}
+
+// SaveConf writes the conf as JSON to the given file, readable only by the current user
+func SaveConf(confFile string, conf Conf) error {
+	byts, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(confFile, byts, 0600); err != nil {
+		return fmt.Errorf("Unable to write config at %v: %v", confFile, err)
+	}
+	return nil
+}
+
+// NewClientFromConfFile creates a client from the conf in the given file, runs Client.EnsureAuthed and then saves the
+// possibly updated conf back to the file. The logger is optional and set as Client.Logger before authing.
+func NewClientFromConfFile(confFile string, ai AuthInfo, logger *log.Logger) (*Client, error) {
+	conf, err := LoadConf(confFile)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(conf)
+	c.Logger = logger
+	if err = c.EnsureAuthed(ai); err != nil {
+		return nil, err
+	}
+	if err = SaveConf(confFile, c.Conf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
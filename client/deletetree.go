@@ -0,0 +1,140 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeleteDirRecursiveInfo are parameters for Client.DeleteDirRecursive
+type DeleteDirRecursiveInfo struct {
+	// The directory to delete
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The maximum number of deletes to make at once. If 0, DefaultTreeConcurrency is used.
+	Concurrency int
+	// The already loaded tree for DirPath, e.g. from a preview. It must have been loaded without a MaxDepth. If nil,
+	// the tree is loaded with LoadDirTree first.
+	Tree *DirTree
+}
+
+// DeleteFailure is a single file or directory that could not be deleted
+type DeleteFailure struct {
+	// The full path
+	Path string
+	// Whether this is a directory
+	Dir bool
+	// The error from the delete
+	Err error
+}
+
+// DeleteDirRecursiveError is returned by Client.DeleteDirRecursive when some entries could not be deleted. Directories
+// that were left because something in them failed to delete are not included. Everything else was deleted so calling
+// DeleteDirRecursive again only has to retry what is left.
+type DeleteDirRecursiveError struct {
+	// The failures in path order
+	Failures []DeleteFailure
+}
+
+func (d *DeleteDirRecursiveError) Error() string {
+	paths := make([]string, len(d.Failures))
+	for i, failure := range d.Failures {
+		paths[i] = fmt.Sprintf("%v (%v)", failure.Path, failure.Err)
+	}
+	return fmt.Sprintf("Unable to delete %v entries: %v", len(d.Failures), strings.Join(paths, ", "))
+}
+
+// DeleteDirRecursive deletes the directory at DeleteDirRecursiveInfo.DirPath after deleting all files and directories
+// under it. Deletes are done bottom-up and concurrently. A directory is only deleted once everything in it has been. If
+// any delete fails, the rest continue and a *DeleteDirRecursiveError is returned.
+func (c *Client) DeleteDirRecursive(dd DeleteDirRecursiveInfo) error {
+	concurrency := dd.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTreeConcurrency
+	}
+	tree := dd.Tree
+	if tree == nil {
+		var err error
+		tree, err = c.LoadDirTree(LoadDirTreeInfo{DirPath: dd.DirPath, Shared: dd.Shared, Concurrency: concurrency})
+		if err != nil {
+			return err
+		}
+	}
+	deleter := &dirTreeDeleter{c: c, shared: dd.Shared, sem: make(chan struct{}, concurrency)}
+	if !deleter.delete(tree) {
+		sort.Sort(deleteFailures(deleter.failures))
+		return &DeleteDirRecursiveError{Failures: deleter.failures}
+	}
+	return nil
+}
+
+type dirTreeDeleter struct {
+	c        *Client
+	shared   bool
+	sem      chan struct{}
+	failLock sync.Mutex
+	failures []DeleteFailure
+}
+
+func (d *dirTreeDeleter) fail(entryPath string, dir bool, err error) {
+	d.failLock.Lock()
+	defer d.failLock.Unlock()
+	d.failures = append(d.failures, DeleteFailure{Path: entryPath, Dir: dir, Err: err})
+}
+
+// delete deletes everything in the tree and then the tree's directory, returning false if anything failed
+func (d *dirTreeDeleter) delete(tree *DirTree) bool {
+	var wg sync.WaitGroup
+	var okLock sync.Mutex
+	ok := true
+	failed := func() {
+		okLock.Lock()
+		ok = false
+		okLock.Unlock()
+	}
+	for _, file := range tree.Files {
+		wg.Add(1)
+		go func(filePath string) {
+			defer wg.Done()
+			d.sem <- struct{}{}
+			// No versions are saved since they would be deleted along with the directory
+			err := d.c.deleteFile(DeleteFileInfo{FilePath: filePath, Shared: d.shared})
+			<-d.sem
+			if err != nil {
+				d.fail(filePath, false, err)
+				failed()
+			}
+		}(path.Join(tree.Path, file.Name))
+	}
+	// Sub directories don't hold a slot while waiting on their contents
+	for _, sub := range tree.SubDirs {
+		wg.Add(1)
+		go func(sub *DirTree) {
+			defer wg.Done()
+			if !d.delete(sub) {
+				failed()
+			}
+		}(sub)
+	}
+	wg.Wait()
+	if !ok {
+		return false
+	}
+	d.sem <- struct{}{}
+	err := d.c.DeleteDir(DeleteDirInfo{DirPath: tree.Path, Shared: d.shared})
+	<-d.sem
+	if err != nil {
+		d.fail(tree.Path, true, err)
+		return false
+	}
+	return true
+}
+
+type deleteFailures []DeleteFailure
+
+func (d deleteFailures) Len() int           { return len(d) }
+func (d deleteFailures) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d deleteFailures) Less(i, j int) bool { return d[i].Path < d[j].Path }
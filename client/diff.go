@@ -0,0 +1,282 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotEntry is a single directory or file in a Snapshot
+type SnapshotEntry struct {
+	// The slash-separated path relative to the snapshot root without a leading slash
+	Path string `json:"path"`
+	// Whether this is a directory
+	Dir bool `json:"dir"`
+	// The size of the file contents. For compressed SAFE files this is the logical size.
+	Size int64 `json:"size,omitempty"`
+	// The last modification time. Only millisecond precision is kept so local and SAFE times can be compared.
+	ModifiedOn time.Time `json:"modifiedOn"`
+	// The SAFE metadata. This is always empty for local entries.
+	Metadata string `json:"metadata,omitempty"`
+	// The hex SHA-256 of the file contents. This is only set when hashes were requested.
+	Hash string `json:"hash,omitempty"`
+}
+
+// Snapshot is a flattened directory tree keyed by SnapshotEntry.Path. The root directory itself is not included.
+type Snapshot map[string]SnapshotEntry
+
+// SnapshotInfo are parameters for Client.Snapshot
+type SnapshotInfo struct {
+	// The directory to snapshot
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// Whether to download every file to set SnapshotEntry.Hash
+	Hash bool
+}
+
+// Snapshot walks the SAFE directory tree at SnapshotInfo.DirPath and returns all of its entries
+func (c *Client) Snapshot(si SnapshotInfo) (Snapshot, error) {
+	rootPath := path.Clean("/" + si.DirPath)
+	snap := Snapshot{}
+	err := c.Walk(WalkInfo{DirPath: rootPath, Shared: si.Shared}, func(entryPath string, dir *DirInfo, file *FileInfo,
+		err error) error {
+		if err != nil {
+			return err
+		} else if entryPath == rootPath {
+			return nil
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(entryPath, rootPath), "/")
+		if dir != nil {
+			snap[relPath] = dirSnapshotEntry(relPath, *dir)
+			return nil
+		}
+		entry := fileSnapshotEntry(relPath, *file)
+		if si.Hash {
+			if entry.Hash, err = c.hashFile(entryPath, si.Shared, *file); err != nil {
+				return err
+			}
+		}
+		snap[relPath] = entry
+		return nil
+	})
+	return snap, err
+}
+
+// DNSSnapshotInfo are parameters for Client.DNSSnapshot
+type DNSSnapshotInfo struct {
+	// The DNS name
+	Name string
+	// The service name
+	Service string
+	// Whether to download every file to set SnapshotEntry.Hash
+	Hash bool
+}
+
+// DNSSnapshot returns the entries of the home directory of a DNS service. Directory listings below the home directory
+// aren't available through DNS, so sub directories are included as entries but their contents are not.
+func (c *Client) DNSSnapshot(dsi DNSSnapshotInfo) (Snapshot, error) {
+	dir, err := c.DNSServiceDir(dsi.Name, dsi.Service)
+	if err != nil {
+		return nil, err
+	}
+	snap := Snapshot{}
+	for _, sub := range dir.SubDirs {
+		snap[sub.Name] = dirSnapshotEntry(sub.Name, sub)
+	}
+	for _, file := range dir.Files {
+		entry := fileSnapshotEntry(file.Name, file)
+		if dsi.Hash {
+			dnsFile, err := c.DNSFile(DNSFileInfo{Name: dsi.Name, Service: dsi.Service, FilePath: "/" + file.Name})
+			if err != nil {
+				return nil, err
+			}
+			// Hash what was originally written like hashFile does
+			body := dnsFile.Body
+			if compression := ParseMetadata(file.Metadata)[MetadataCompression]; compression != "" {
+				if compression != CompressionGzip {
+					body.Close()
+					return nil, fmt.Errorf("Unsupported compression: %v", compression)
+				}
+				if body, err = decompressContents(body, 0, 0); err != nil {
+					return nil, err
+				}
+			}
+			entry.Hash, err = hashReader(body)
+			body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read %v: %v", file.Name, err)
+			}
+		}
+		snap[file.Name] = entry
+	}
+	return snap, nil
+}
+
+// LocalSnapshot walks a directory tree on local disk and returns all of its entries
+func LocalSnapshot(dirPath string, hash bool) (Snapshot, error) {
+	snap := Snapshot{}
+	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dirPath, filePath)
+		if err != nil {
+			return err
+		} else if relPath == "." {
+			return nil
+		}
+		entry := SnapshotEntry{
+			Path:       filepath.ToSlash(relPath),
+			Dir:        info.IsDir(),
+			ModifiedOn: info.ModTime().Truncate(time.Millisecond),
+		}
+		if !entry.Dir {
+			entry.Size = info.Size()
+			if hash {
+				f, err := os.Open(filePath)
+				if err != nil {
+					return err
+				}
+				entry.Hash, err = hashReader(f)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("Unable to read %v: %v", filePath, err)
+				}
+			}
+		}
+		snap[entry.Path] = entry
+		return nil
+	})
+	return snap, err
+}
+
+func dirSnapshotEntry(relPath string, dir DirInfo) SnapshotEntry {
+	return SnapshotEntry{Path: relPath, Dir: true, ModifiedOn: dir.ModifiedOn.Time(), Metadata: dir.Metadata}
+}
+
+func fileSnapshotEntry(relPath string, file FileInfo) SnapshotEntry {
+	return SnapshotEntry{
+		Path:       relPath,
+		Size:       file.LogicalSize(),
+		ModifiedOn: file.ModifiedOn.Time(),
+		Metadata:   file.Metadata,
+	}
+}
+
+func (c *Client) hashFile(filePath string, shared bool, file FileInfo) (string, error) {
+	var rc io.ReadCloser
+	var err error
+	// Hash what was originally written, not what is stored
+	if compression := ParseMetadata(file.Metadata)[MetadataCompression]; compression != "" {
+		rc, err = c.getCompressedFile(GetFileInfo{FilePath: filePath, Shared: shared}, compression)
+	} else {
+		rc, err = c.GetFile(GetFileInfo{FilePath: filePath, Shared: shared})
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return hashReader(rc)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DiffChange is the kind of difference in a DiffEntry
+type DiffChange string
+
+const (
+	// DiffAdded is an entry that is only in the second snapshot
+	DiffAdded DiffChange = "added"
+	// DiffRemoved is an entry that is only in the first snapshot
+	DiffRemoved DiffChange = "removed"
+	// DiffChanged is an entry in both snapshots that differs
+	DiffChanged DiffChange = "changed"
+)
+
+// Reasons given in DiffEntry.Reasons
+const (
+	DiffReasonType     = "type"
+	DiffReasonSize     = "size"
+	DiffReasonModified = "modified"
+	DiffReasonHash     = "hash"
+)
+
+// DiffEntry is a single difference between two snapshots
+type DiffEntry struct {
+	// The path relative to the snapshot roots
+	Path string `json:"path"`
+	// The kind of difference
+	Change DiffChange `json:"change"`
+	// For DiffChanged, what differs. See the DiffReason* constants.
+	Reasons []string `json:"reasons,omitempty"`
+	// The entry in the first snapshot if there is one
+	A *SnapshotEntry `json:"a,omitempty"`
+	// The entry in the second snapshot if there is one
+	B *SnapshotEntry `json:"b,omitempty"`
+}
+
+// DiffOptions are options for DiffSnapshots
+type DiffOptions struct {
+	// If true, file modification times are not compared. This is usually wanted when comparing local files with SAFE
+	// files since SAFE sets its own times on write.
+	IgnoreModTime bool
+}
+
+// DiffSnapshots compares two snapshots and returns the differences ordered by path. Directories are only compared by
+// type. Files are compared by size, modification time, and, if both entries have one, hash.
+func DiffSnapshots(a, b Snapshot, do DiffOptions) []DiffEntry {
+	diffs := []DiffEntry{}
+	for entryPath, aEntry := range a {
+		aEntry := aEntry
+		bEntry, ok := b[entryPath]
+		if !ok {
+			diffs = append(diffs, DiffEntry{Path: entryPath, Change: DiffRemoved, A: &aEntry})
+			continue
+		}
+		var reasons []string
+		if aEntry.Dir != bEntry.Dir {
+			reasons = append(reasons, DiffReasonType)
+		} else if !aEntry.Dir {
+			if aEntry.Size != bEntry.Size {
+				reasons = append(reasons, DiffReasonSize)
+			}
+			if !do.IgnoreModTime && !aEntry.ModifiedOn.Equal(bEntry.ModifiedOn) {
+				reasons = append(reasons, DiffReasonModified)
+			}
+			if aEntry.Hash != "" && bEntry.Hash != "" && aEntry.Hash != bEntry.Hash {
+				reasons = append(reasons, DiffReasonHash)
+			}
+		}
+		if len(reasons) > 0 {
+			diffs = append(diffs, DiffEntry{Path: entryPath, Change: DiffChanged, Reasons: reasons, A: &aEntry, B: &bEntry})
+		}
+	}
+	for entryPath, bEntry := range b {
+		bEntry := bEntry
+		if _, ok := a[entryPath]; !ok {
+			diffs = append(diffs, DiffEntry{Path: entryPath, Change: DiffAdded, B: &bEntry})
+		}
+	}
+	sort.Sort(diffEntries(diffs))
+	return diffs
+}
+
+type diffEntries []DiffEntry
+
+func (d diffEntries) Len() int           { return len(d) }
+func (d diffEntries) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d diffEntries) Less(i, j int) bool { return d[i].Path < d[j].Path }
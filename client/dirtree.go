@@ -0,0 +1,135 @@
+package client
+
+import (
+	"path"
+	"sort"
+	"sync"
+)
+
+// DefaultTreeConcurrency is the number of concurrent GetDir calls LoadDirTree makes when
+// LoadDirTreeInfo.Concurrency is 0
+const DefaultTreeConcurrency = 8
+
+// DirTree is a directory and the directories and files under it as loaded by Client.LoadDirTree
+type DirTree struct {
+	// The full path of the directory
+	Path string
+	// Info about the directory
+	Info DirInfo
+	// The files directly in the directory in name order
+	Files Files
+	// The sub directories in name order
+	SubDirs []*DirTree
+	// False if the directory contents were not loaded because of LoadDirTreeInfo.MaxDepth
+	Loaded bool
+}
+
+// LoadDirTreeInfo are parameters for Client.LoadDirTree
+type LoadDirTreeInfo struct {
+	// The directory to load
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// How many levels of sub directories to load the contents of. 0 means no limit.
+	MaxDepth int
+	// The maximum number of GetDir calls to make at once. If 0, DefaultTreeConcurrency is used.
+	Concurrency int
+}
+
+// LoadDirTree loads the directory at LoadDirTreeInfo.DirPath and everything under it, fetching sub directories
+// concurrently. If any directory can't be loaded, the first error is returned.
+func (c *Client) LoadDirTree(ld LoadDirTreeInfo) (*DirTree, error) {
+	concurrency := ld.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTreeConcurrency
+	}
+	loader := &dirTreeLoader{c: c, ld: ld, sem: make(chan struct{}, concurrency)}
+	root := &DirTree{Path: path.Clean("/" + ld.DirPath)}
+	loader.wg.Add(1)
+	loader.load(root, 0)
+	loader.wg.Wait()
+	if loader.err != nil {
+		return nil, loader.err
+	}
+	return root, nil
+}
+
+type dirTreeLoader struct {
+	c       *Client
+	ld      LoadDirTreeInfo
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	errLock sync.Mutex
+	err     error
+}
+
+func (d *dirTreeLoader) failed() bool {
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+	return d.err != nil
+}
+
+func (d *dirTreeLoader) load(tree *DirTree, depth int) {
+	defer d.wg.Done()
+	if d.failed() {
+		return
+	}
+	d.sem <- struct{}{}
+	dir, err := d.c.GetDir(GetDirInfo{DirPath: tree.Path, Shared: d.ld.Shared})
+	<-d.sem
+	if err != nil {
+		d.errLock.Lock()
+		if d.err == nil {
+			d.err = err
+		}
+		d.errLock.Unlock()
+		return
+	}
+	tree.Info = dir.Info
+	tree.Files = dir.Files
+	tree.Loaded = true
+	sort.Sort(tree.Files)
+	sort.Sort(dir.SubDirs)
+	tree.SubDirs = make([]*DirTree, len(dir.SubDirs))
+	for i, sub := range dir.SubDirs {
+		tree.SubDirs[i] = &DirTree{Path: path.Join(tree.Path, sub.Name), Info: sub}
+		if d.ld.MaxDepth <= 0 || depth < d.ld.MaxDepth {
+			d.wg.Add(1)
+			go d.load(tree.SubDirs[i], depth+1)
+		}
+	}
+}
+
+// Size is the total logical size of the files in this directory and all loaded directories under it
+func (d *DirTree) Size() int64 {
+	var size int64
+	for _, file := range d.Files {
+		size += file.LogicalSize()
+	}
+	for _, sub := range d.SubDirs {
+		size += sub.Size()
+	}
+	return size
+}
+
+// StoredSize is the total stored size of the files in this directory and all loaded directories under it. This
+// differs from Size when files are compressed.
+func (d *DirTree) StoredSize() int64 {
+	var size int64
+	for _, file := range d.Files {
+		size += file.Size
+	}
+	for _, sub := range d.SubDirs {
+		size += sub.StoredSize()
+	}
+	return size
+}
+
+// FileCount is the number of files in this directory and all loaded directories under it
+func (d *DirTree) FileCount() int {
+	count := len(d.Files)
+	for _, sub := range d.SubDirs {
+		count += sub.FileCount()
+	}
+	return count
+}
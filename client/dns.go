@@ -41,6 +41,12 @@ func (c *Client) DNSServices(name string) ([]string, error) {
 // DNSServiceDir gets directory detail for the given DNS name and service on the account. See
 // https://maidsafe.readme.io/docs/dns-get-home-dir for more info.
 func (c *Client) DNSServiceDir(name, service string) (DirResponse, error) {
+	key := dnsCacheKey(cacheKindDNSDir, name, service, "/")
+	if c.Cache != nil {
+		if entry := c.cachedDNS(key); entry != nil && entry.Dir != nil {
+			return copyDirResponse(*entry.Dir), nil
+		}
+	}
 	var resp DirResponse
 	req := &Request{
 		Path:         "/dns/" + url.QueryEscape(service) + "/" + url.QueryEscape(name),
@@ -50,6 +56,10 @@ func (c *Client) DNSServiceDir(name, service string) (DirResponse, error) {
 		DoNotAuth:    true,
 	}
 	_, err := c.Do(req)
+	if err == nil && c.Cache != nil {
+		dir := copyDirResponse(resp)
+		c.Cache.put(&cacheEntry{Key: key, Dir: &dir})
+	}
 	return resp, err
 }
 
@@ -65,6 +75,8 @@ type DNSFileInfo struct {
 	Offset int64
 	// The number of bytes to read. 0 means no limit.
 	Length int64
+	// If not nil, this is called with the progress as DNSFile.Body is read
+	Progress ProgressFunc
 }
 
 // DNSFile is returned from the Client.DNSFile function
@@ -79,6 +91,13 @@ type DNSFile struct {
 
 // DNSFile fetches a public file from DNS. See https://maidsafe.readme.io/docs/dns-get-file-unauth for more information.
 func (c *Client) DNSFile(df DNSFileInfo) (*DNSFile, error) {
+	if c.Cache != nil {
+		return c.dnsFileWithCache(df)
+	}
+	return c.dnsFile(df)
+}
+
+func (c *Client) dnsFile(df DNSFileInfo) (*DNSFile, error) {
 	query := map[string][]string{"offset": []string{strconv.FormatInt(df.Offset, 10)}}
 	if df.Length > 0 {
 		query["length"] = []string{strconv.FormatInt(df.Length, 10)}
@@ -86,10 +105,11 @@ func (c *Client) DNSFile(df DNSFileInfo) (*DNSFile, error) {
 	req := &Request{
 		Path: "/dns/" + url.QueryEscape(df.Service) + "/" + url.QueryEscape(df.Name) +
 			"/" + url.QueryEscape(df.FilePath),
-		Method:       "GET",
-		Query:        query,
-		DoNotEncrypt: true,
-		DoNotAuth:    true,
+		Method:           "GET",
+		Query:            query,
+		DoNotEncrypt:     true,
+		DoNotAuth:        true,
+		DownloadProgress: df.Progress,
 	}
 	resp, err := c.Do(req)
 	if err != nil {
@@ -132,6 +152,7 @@ type DNSRegisterInfo struct {
 // DNSRegister registers a DNS top level name, service, and directory. This differs from DNSAddService because it
 // internally calls DNSCreateName. See https://maidsafe.readme.io/docs/dns-register-service for more info.
 func (c *Client) DNSRegister(dr DNSRegisterInfo) error {
+	defer c.invalidateDNSCache()
 	req := &Request{
 		Path:     "/dns",
 		Method:   "POST",
@@ -144,6 +165,7 @@ func (c *Client) DNSRegister(dr DNSRegisterInfo) error {
 // DNSCreateName creates a new top level DNS name for this account. See
 // https://maidsafe.readme.io/docs/dns-create-long-name for more info.
 func (c *Client) DNSCreateName(name string) error {
+	defer c.invalidateDNSCache()
 	req := &Request{
 		Path:   "/dns/" + url.QueryEscape(name),
 		Method: "POST",
@@ -168,6 +190,7 @@ type DNSAddServiceInfo struct {
 // because it expects the name to already exist. This is not documented, see https://maidsafe.atlassian.net/browse/CS-60
 // for more info.
 func (c *Client) DNSAddService(das DNSAddServiceInfo) error {
+	defer c.invalidateDNSCache()
 	req := &Request{
 		Path:     "/dns",
 		Method:   "PUT",
@@ -179,6 +202,7 @@ func (c *Client) DNSAddService(das DNSAddServiceInfo) error {
 
 // DNSDeleteName deletes a top-level DNS name
 func (c *Client) DNSDeleteName(name string) error {
+	defer c.invalidateDNSCache()
 	req := &Request{
 		Path:   "/dns/" + url.QueryEscape(name),
 		Method: "DELETE",
@@ -189,6 +213,7 @@ func (c *Client) DNSDeleteName(name string) error {
 
 // DNSDeleteService deletes a service from the given DNS name
 func (c *Client) DNSDeleteService(name, service string) error {
+	defer c.invalidateDNSCache()
 	req := &Request{
 		Path:   "/dns/" + url.QueryEscape(service) + "/" + url.QueryEscape(name),
 		Method: "DELETE",
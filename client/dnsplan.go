@@ -0,0 +1,205 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DNSService is the home directory of a DNS service
+type DNSService struct {
+	// The home directory path
+	HomeDirPath string
+	// Whether the path is shared
+	Shared bool
+}
+
+// DNS change actions in the order they are planned
+const (
+	DNSActionCreateName     = "create name"
+	DNSActionAddService     = "add service"
+	DNSActionReplaceService = "replace service"
+	DNSActionDeleteService  = "delete service"
+	DNSActionDeleteName     = "delete name"
+)
+
+// DNSChange is a single change to make to DNS
+type DNSChange struct {
+	// One of the DNS change action constants
+	Action string
+	// The DNS name
+	Name string
+	// The service name. Empty for name actions.
+	ServiceName string
+	// The home directory for the service being added or replaced
+	Service DNSService
+}
+
+func (d DNSChange) String() string {
+	switch d.Action {
+	case DNSActionCreateName, DNSActionDeleteName:
+		return fmt.Sprintf("%v %v", d.Action, d.Name)
+	case DNSActionDeleteService:
+		return fmt.Sprintf("%v %v.%v", d.Action, d.ServiceName, d.Name)
+	}
+	area := "app"
+	if d.Service.Shared {
+		area = "shared"
+	}
+	return fmt.Sprintf("%v %v.%v -> %v (%v)", d.Action, d.ServiceName, d.Name, d.Service.HomeDirPath, area)
+}
+
+// DNSPlan is the changes needed to make DNS match what is wanted
+type DNSPlan struct {
+	// The changes to make in order
+	Changes []DNSChange
+	// Names and services, as service.name, that exist but aren't wanted and are left alone since
+	// PlanDNSInfo.Prune is false
+	Unmanaged []string
+}
+
+// PlanDNSInfo are parameters for Client.PlanDNS
+type PlanDNSInfo struct {
+	// The wanted services of each wanted DNS name. A name with no services is still created.
+	Names map[string]map[string]DNSService
+	// If true, names and services that exist but aren't wanted are deleted
+	Prune bool
+}
+
+// PlanDNS compares the wanted DNS names and services with the account's to give what needs to change. The launcher
+// doesn't say which directory a service's home is, only what is in it, so a service is only replaced when its home
+// directory's name or creation time differs from those of the wanted directory.
+func (c *Client) PlanDNS(pd PlanDNSInfo) (*DNSPlan, error) {
+	existingNames, err := c.DNSNames()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list DNS names: %v", err)
+	}
+	existing := map[string]bool{}
+	for _, name := range existingNames {
+		existing[name] = true
+	}
+	plan := &DNSPlan{Changes: []DNSChange{}, Unmanaged: []string{}}
+	var creates, adds, replaces, deletes, nameDeletes []DNSChange
+	for _, name := range sortedDNSNames(pd.Names) {
+		services := pd.Names[name]
+		existingServices := map[string]bool{}
+		if !existing[name] {
+			creates = append(creates, DNSChange{Action: DNSActionCreateName, Name: name})
+		} else {
+			serviceNames, err := c.DNSServices(name)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to list services of %v: %v", name, err)
+			}
+			for _, serviceName := range serviceNames {
+				existingServices[serviceName] = true
+			}
+		}
+		serviceNames := []string{}
+		for serviceName := range services {
+			serviceNames = append(serviceNames, serviceName)
+		}
+		sort.Strings(serviceNames)
+		for _, serviceName := range serviceNames {
+			change := DNSChange{Name: name, ServiceName: serviceName, Service: services[serviceName]}
+			if !existingServices[serviceName] {
+				change.Action = DNSActionAddService
+				adds = append(adds, change)
+				continue
+			}
+			same, err := c.dnsServiceIs(name, serviceName, services[serviceName])
+			if err != nil {
+				return nil, err
+			} else if !same {
+				change.Action = DNSActionReplaceService
+				replaces = append(replaces, change)
+			}
+		}
+		for _, serviceName := range sortedDNSSet(existingServices) {
+			if _, ok := services[serviceName]; ok {
+				continue
+			} else if pd.Prune {
+				change := DNSChange{Action: DNSActionDeleteService, Name: name, ServiceName: serviceName}
+				deletes = append(deletes, change)
+			} else {
+				plan.Unmanaged = append(plan.Unmanaged, serviceName+"."+name)
+			}
+		}
+	}
+	for _, name := range sortedDNSSet(existing) {
+		if _, ok := pd.Names[name]; ok {
+			continue
+		} else if pd.Prune {
+			nameDeletes = append(nameDeletes, DNSChange{Action: DNSActionDeleteName, Name: name})
+		} else {
+			plan.Unmanaged = append(plan.Unmanaged, name)
+		}
+	}
+	for _, changes := range [][]DNSChange{creates, adds, replaces, deletes, nameDeletes} {
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	return plan, nil
+}
+
+// dnsServiceIs checks whether the service's home directory looks like the wanted one
+func (c *Client) dnsServiceIs(name string, serviceName string, service DNSService) (bool, error) {
+	current, err := c.DNSServiceDir(name, serviceName)
+	if err != nil {
+		return false, fmt.Errorf("Unable to get home dir of %v.%v: %v", serviceName, name, err)
+	}
+	wanted, err := c.GetDir(GetDirInfo{DirPath: service.HomeDirPath, Shared: service.Shared})
+	if err != nil {
+		return false, fmt.Errorf("Unable to get dir %v: %v", service.HomeDirPath, err)
+	}
+	return current.Info.Name == wanted.Info.Name && current.Info.CreatedOn == wanted.Info.CreatedOn, nil
+}
+
+func sortedDNSNames(names map[string]map[string]DNSService) []string {
+	keys := []string{}
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedDNSSet(set map[string]bool) []string {
+	strs := []string{}
+	for str := range set {
+		strs = append(strs, str)
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// ApplyDNS makes the changes of a plan from PlanDNS in order, stopping at the first that fails. Replacing a service
+// deletes it and adds it again. Deleting a name deletes its services with it.
+func (c *Client) ApplyDNS(plan *DNSPlan) error {
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Action {
+		case DNSActionCreateName:
+			err = c.DNSCreateName(change.Name)
+		case DNSActionReplaceService:
+			if err = c.DNSDeleteService(change.Name, change.ServiceName); err != nil {
+				break
+			}
+			fallthrough
+		case DNSActionAddService:
+			err = c.DNSAddService(DNSAddServiceInfo{
+				Name:        change.Name,
+				ServiceName: change.ServiceName,
+				HomeDirPath: change.Service.HomeDirPath,
+				Shared:      change.Service.Shared,
+			})
+		case DNSActionDeleteService:
+			err = c.DNSDeleteService(change.Name, change.ServiceName)
+		case DNSActionDeleteName:
+			err = c.DNSDeleteName(change.Name)
+		default:
+			err = fmt.Errorf("Unknown action %v", change.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to %v: %v", change, err)
+		}
+	}
+	return nil
+}
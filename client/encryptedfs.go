@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultEncryptedChunkSize is the number of plaintext bytes in each encrypted chunk when EncryptedFS.ChunkSize is 0
+const DefaultEncryptedChunkSize = 64 * 1024
+
+// MetadataEncryptionKeyID is the Metadata key that holds the ID of the Keyring key used to encrypt a file
+const MetadataEncryptionKeyID = "encryptionKeyId"
+
+// Keyring is a set of keys for EncryptedFS. Keys are never sent to SAFE, only their IDs are.
+type Keyring struct {
+	// The 32-byte keys by ID. Old keys should be kept here as long as there are files encrypted with them.
+	Keys map[string][]byte
+	// The ID of the key in Keys to encrypt new content with
+	CurrentKeyID string
+}
+
+// EncryptedFS wraps a Client to encrypt file contents before they leave this process. The launcher's own encryption
+// only protects the connection to the launcher, so this should be used for anything stored in a place others can read.
+//
+// Contents are sealed in chunks with NaCl secretbox behind a small header, so ranges can be read via GetFileInfo.Offset
+// and GetFileInfo.Length without fetching the whole file. The ID of the key used is stored in the file's Metadata
+// under MetadataEncryptionKeyID.
+type EncryptedFS struct {
+	// The client to make calls with
+	Client *Client
+	// The keys to encrypt and decrypt with
+	Keyring Keyring
+	// The number of plaintext bytes per chunk for new writes. If 0, DefaultEncryptedChunkSize is used. This is stored
+	// in each file so it may be changed without affecting existing files.
+	ChunkSize int
+}
+
+// NewEncryptedFS creates an EncryptedFS for the given client and keyring
+func NewEncryptedFS(c *Client, keyring Keyring) *EncryptedFS {
+	return &EncryptedFS{Client: c, Keyring: keyring}
+}
+
+// The header is a magic value, the chunk size, the plaintext size, and the nonce prefix for the chunks
+var encryptedMagic = []byte("SCE1")
+
+const encryptedHeaderSize = 4 + 4 + 8 + 16
+
+type encryptedHeader struct {
+	chunkSize   int64
+	size        int64
+	noncePrefix [16]byte
+}
+
+func (h *encryptedHeader) chunkCount() int64 {
+	// Empty content is still a single empty chunk so the end can be authenticated
+	if h.size == 0 {
+		return 1
+	}
+	return (h.size + h.chunkSize - 1) / h.chunkSize
+}
+
+func (h *encryptedHeader) nonce(index int64) *[24]byte {
+	var nonce [24]byte
+	copy(nonce[:], h.noncePrefix[:])
+	// The high bit marks the final chunk so truncation can't go unnoticed
+	counter := uint64(index)
+	if index == h.chunkCount()-1 {
+		counter |= 1 << 63
+	}
+	binary.BigEndian.PutUint64(nonce[16:], counter)
+	return &nonce
+}
+
+func (h *encryptedHeader) marshal() []byte {
+	byts := make([]byte, encryptedHeaderSize)
+	copy(byts, encryptedMagic)
+	binary.BigEndian.PutUint32(byts[4:], uint32(h.chunkSize))
+	binary.BigEndian.PutUint64(byts[8:], uint64(h.size))
+	copy(byts[16:], h.noncePrefix[:])
+	return byts
+}
+
+func unmarshalEncryptedHeader(byts []byte) (*encryptedHeader, error) {
+	if len(byts) < encryptedHeaderSize || !bytes.Equal(byts[:4], encryptedMagic) {
+		return nil, errors.New("File is not encrypted")
+	}
+	h := &encryptedHeader{
+		chunkSize: int64(binary.BigEndian.Uint32(byts[4:])),
+		size:      int64(binary.BigEndian.Uint64(byts[8:])),
+	}
+	if h.chunkSize == 0 {
+		return nil, errors.New("Invalid encrypted chunk size")
+	}
+	copy(h.noncePrefix[:], byts[16:])
+	return h, nil
+}
+
+func (e *EncryptedFS) key(id string) (*[32]byte, error) {
+	keyByts, ok := e.Keyring.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Key %q not in keyring", id)
+	} else if len(keyByts) != 32 {
+		return nil, fmt.Errorf("Key %q must be 32 bytes", id)
+	}
+	var key [32]byte
+	copy(key[:], keyByts)
+	return &key, nil
+}
+
+// CreateFile creates a file the same way as Client.CreateFile but records the current key ID in the metadata
+func (e *EncryptedFS) CreateFile(cf CreateFileInfo) error {
+	if _, err := e.key(e.Keyring.CurrentKeyID); err != nil {
+		return err
+	}
+	meta := ParseMetadata(cf.Metadata)
+	meta[MetadataEncryptionKeyID] = e.Keyring.CurrentKeyID
+	cf.Metadata = meta.String()
+	return e.Client.CreateFile(cf)
+}
+
+// WriteFile encrypts the contents with the current key and writes them. The file must already exist. Since each write
+// uses a fresh nonce, the whole file must be written at once; WriteFileInfo.Offset must be 0. If the file was
+// encrypted with a different key, its metadata is updated to the current key ID.
+func (e *EncryptedFS) WriteFile(wf WriteFileInfo) error {
+	defer wf.Contents.Close()
+	if wf.Offset != 0 {
+		return errors.New("Encrypted files can only be written in full from offset 0")
+	}
+	key, err := e.key(e.Keyring.CurrentKeyID)
+	if err != nil {
+		return err
+	}
+	plain, err := ioutil.ReadAll(wf.Contents)
+	if err != nil {
+		return fmt.Errorf("Unable to read contents: %v", err)
+	}
+	h := &encryptedHeader{chunkSize: int64(e.ChunkSize), size: int64(len(plain))}
+	if h.chunkSize <= 0 {
+		h.chunkSize = DefaultEncryptedChunkSize
+	}
+	if _, err = rand.Read(h.noncePrefix[:]); err != nil {
+		return fmt.Errorf("Unable to generate nonce: %v", err)
+	}
+	sealed := h.marshal()
+	for i := int64(0); i < h.chunkCount(); i++ {
+		start := i * h.chunkSize
+		end := start + h.chunkSize
+		if end > h.size {
+			end = h.size
+		}
+		sealed = secretbox.Seal(sealed, plain[start:end], h.nonce(i), key)
+	}
+	err = e.Client.WriteFile(WriteFileInfo{
+		FilePath: wf.FilePath,
+		Shared:   wf.Shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(sealed)),
+	})
+	if err != nil {
+		return err
+	}
+	// Make sure the metadata references the key we just used
+	info, err := e.Client.statFile(wf.FilePath, wf.Shared)
+	if err != nil {
+		return err
+	}
+	meta := ParseMetadata(info.Metadata)
+	if meta[MetadataEncryptionKeyID] == e.Keyring.CurrentKeyID {
+		return nil
+	}
+	meta[MetadataEncryptionKeyID] = e.Keyring.CurrentKeyID
+	return e.Client.ChangeFile(ChangeFileInfo{FilePath: wf.FilePath, Shared: wf.Shared, Metadata: meta.String()})
+}
+
+// GetFile reads and decrypts a file written with WriteFile. GetFileInfo.Offset and GetFileInfo.Length apply to the
+// decrypted contents and only the chunks covering that range are fetched. A file that has never been written is
+// returned as empty.
+func (e *EncryptedFS) GetFile(gf GetFileInfo) (io.ReadCloser, error) {
+	if gf.Offset < 0 || gf.Length < 0 {
+		return nil, errors.New("Offset and length can't be negative")
+	}
+	info, err := e.Client.statFile(gf.FilePath, gf.Shared)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size == 0 {
+		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	}
+	key, err := e.key(ParseMetadata(info.Metadata)[MetadataEncryptionKeyID])
+	if err != nil {
+		return nil, err
+	}
+	headerByts, err := e.readRange(gf, 0, encryptedHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	h, err := unmarshalEncryptedHeader(headerByts)
+	if err != nil {
+		return nil, err
+	}
+	// Determine the plaintext range, and from that, the chunks needed
+	start, end := gf.Offset, h.size
+	if gf.Length > 0 && start+gf.Length < end {
+		end = start + gf.Length
+	}
+	if start >= end {
+		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	}
+	firstChunk, lastChunk := start/h.chunkSize, (end-1)/h.chunkSize
+	sealedChunkSize := h.chunkSize + secretbox.Overhead
+	sealedStart := encryptedHeaderSize + firstChunk*sealedChunkSize
+	sealedEnd := encryptedHeaderSize + lastChunk*sealedChunkSize + secretbox.Overhead
+	if lastChunk == h.chunkCount()-1 {
+		sealedEnd += h.size - lastChunk*h.chunkSize
+	} else {
+		sealedEnd += h.chunkSize
+	}
+	sealed, err := e.readRange(gf, sealedStart, sealedEnd-sealedStart)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, 0, end-start)
+	for i := firstChunk; i <= lastChunk; i++ {
+		chunkEnd := sealedChunkSize
+		if int64(len(sealed)) < chunkEnd {
+			chunkEnd = int64(len(sealed))
+		}
+		chunk, ok := secretbox.Open(nil, sealed[:chunkEnd], h.nonce(i), key)
+		if !ok {
+			return nil, fmt.Errorf("Unable to decrypt chunk %v", i)
+		}
+		sealed = sealed[chunkEnd:]
+		// Trim the first and last chunks to the requested range
+		chunkStart := i * h.chunkSize
+		if i == lastChunk {
+			chunk = chunk[:end-chunkStart]
+		}
+		if i == firstChunk {
+			chunk = chunk[start-chunkStart:]
+		}
+		plain = append(plain, chunk...)
+	}
+	return ioutil.NopCloser(bytes.NewReader(plain)), nil
+}
+
+func (e *EncryptedFS) readRange(gf GetFileInfo, offset int64, length int64) ([]byte, error) {
+	rc, err := e.Client.GetFile(GetFileInfo{FilePath: gf.FilePath, Shared: gf.Shared, Offset: offset, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	byts, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file output: %v", err)
+	}
+	if int64(len(byts)) != length {
+		return nil, errors.New("Encrypted file is truncated")
+	}
+	return byts, nil
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// GlobInfo are parameters for Client.Glob
+type GlobInfo struct {
+	// The pattern to match. Each path element is matched using path.Match syntax, e.g. /site/*.bak or /*/index.html.
+	Pattern string
+	// Whether the path is shared
+	Shared bool
+}
+
+// HasGlobMeta reports whether the path contains any of the special characters recognized by path.Match
+func HasGlobMeta(str string) bool {
+	return strings.ContainsAny(str, `*?[\`)
+}
+
+// Glob returns the paths of all files and directories matching GlobInfo.Pattern in name order. Only the directories
+// needed to resolve pattern elements are listed and directories that don't exist are treated as not matching.
+// Once an element with special characters has been matched, the elements after it are checked to exist even if they
+// have none. Like shells, names starting with a dot are only matched by elements that start with one too, which keeps
+// things like the trash, saved versions and atomic write temp files out of matches. A bad pattern returns
+// path.ErrBadPattern and any other failure listing a directory is returned as is. A pattern with no special characters
+// is returned as is without checking that it exists.
+func (c *Client) Glob(gi GlobInfo) ([]string, error) {
+	cleaned := path.Clean("/" + gi.Pattern)
+	if !HasGlobMeta(cleaned) {
+		return []string{cleaned}, nil
+	}
+	matches := []string{"/"}
+	listing := false
+	elems := strings.Split(strings.TrimPrefix(cleaned, "/"), "/")
+	for i, elem := range elems {
+		last := i == len(elems)-1
+		// No need to list anything for plain elements until there is more than one possible parent
+		if !listing && !HasGlobMeta(elem) {
+			matches[0] = path.Join(matches[0], elem)
+			continue
+		}
+		listing = true
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, dirPath := range matches {
+			dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: gi.Shared})
+			if IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			for _, sub := range dir.SubDirs {
+				if globMatch(elem, sub.Name) {
+					next = append(next, path.Join(dirPath, sub.Name))
+				}
+			}
+			// Files can only match the last element
+			if last {
+				for _, file := range dir.Files {
+					if globMatch(elem, file.Name) {
+						next = append(next, path.Join(dirPath, file.Name))
+					}
+				}
+			}
+		}
+		if len(next) == 0 {
+			return nil, nil
+		}
+		matches = next
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globMatch reports whether the name matches the pattern element, which must be valid
+func globMatch(elem string, name string) bool {
+	if strings.HasPrefix(name, ".") && !strings.HasPrefix(elem, ".") {
+		return false
+	}
+	ok, _ := path.Match(elem, name)
+	return ok
+}
+
+// GlobAll expands each pattern with Glob and returns all matches in the order of the patterns. It is an error for a
+// pattern with special characters to not match anything.
+func (c *Client) GlobAll(patterns []string, shared bool) ([]string, error) {
+	var all []string
+	for _, pattern := range patterns {
+		matches, err := c.Glob(GlobInfo{Pattern: pattern, Shared: shared})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %v: %v", pattern, err)
+		} else if len(matches) == 0 {
+			return nil, fmt.Errorf("No matches for %v", pattern)
+		}
+		all = append(all, matches...)
+	}
+	return all, nil
+}
@@ -0,0 +1,350 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Locks are advisory: they only keep out clients that also take the lock before writing. A lock is a file whose
+// Metadata holds who has it, when it expires and a token only the holder knows.
+//
+// The only thing locks rely on the launcher for is that CreateFile fails if the file already exists. The launcher
+// makes that check and adds the file to its directory in one request, so of two clients creating the same lock file
+// only one gets it, provided both go through launchers that see the same version of the directory. The launcher
+// gives no other conditional operations, so everything else about a lock is done by reading the lock file and then
+// changing or deleting it:
+//
+//   - Renewing and unlocking check the token first, so they can't affect a lock someone else has taken over unless the
+//     takeover happens between the check and the change.
+//   - A lock is only taken over once it has expired. Two clients taking over the same expired lock at the same moment
+//     can both believe they have it if one deletes the lock file just after the other creates it.
+//   - Expiry compares times from different machines, so their clocks must be roughly in sync.
+//
+// To keep these windows from mattering, the TTL should be much longer than a heartbeat interval and than the time it
+// takes to make a request.
+
+// Metadata keys for lock files
+const (
+	// MetadataLockHolder is the Metadata key of who holds a lock
+	MetadataLockHolder = "lockHolder"
+	// MetadataLockExpires is the Metadata key of when a lock expires in RFC 3339 format
+	MetadataLockExpires = "lockExpires"
+	// MetadataLockToken is the Metadata key of the token of a lock
+	MetadataLockToken = "lockToken"
+)
+
+// DefaultLockTTL is how long a lock lasts without being renewed if no TTL is given
+const DefaultLockTTL = time.Minute
+
+const lockRetryInterval = time.Second
+
+// ErrLockNotHeld is returned when renewing or unlocking a lock that has been unlocked or taken over
+var ErrLockNotHeld = errors.New("Lock not held")
+
+// LockHeldError is returned by Client.Lock when someone else holds the lock
+type LockHeldError struct {
+	// Who holds the lock
+	Holder string
+	// When the lock expires unless it is renewed
+	Expires time.Time
+}
+
+func (l *LockHeldError) Error() string {
+	return fmt.Sprintf("Lock held by %v until %v", l.Holder, l.Expires.Format(time.RFC3339))
+}
+
+// LockInfo are parameters for Client.Lock
+type LockInfo struct {
+	// The path of the lock file. It must not exist unless it is a lock file.
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// Who is taking the lock, shown to others who try to take it. If empty, the host name and process ID are used.
+	Holder string
+	// How long the lock lasts without being renewed. If 0, DefaultLockTTL is used.
+	TTL time.Duration
+	// How long to keep trying if the lock is held. If 0, Lock only tries once.
+	Wait time.Duration
+	// If true, the lock is renewed in the background every third of the TTL until it is unlocked
+	Heartbeat bool
+}
+
+// RenewLockInfo are parameters for Client.RenewLock
+type RenewLockInfo struct {
+	// The path of the lock file
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// The token the lock was taken with
+	Token string
+	// How long from now the lock lasts. If 0, DefaultLockTTL is used.
+	TTL time.Duration
+}
+
+// UnlockInfo are parameters for Client.Unlock
+type UnlockInfo struct {
+	// The path of the lock file
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// The token the lock was taken with
+	Token string
+	// If true, the lock is removed whoever holds it and it isn't an error if there is no lock
+	Force bool
+}
+
+// Lock is a held lock
+type Lock struct {
+	c *Client
+	// The path of the lock file
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// Who holds the lock
+	Holder string
+	// The token the lock was taken with, which is needed to renew or unlock it from elsewhere
+	Token string
+	// How long the lock lasts each time it is renewed
+	TTL time.Duration
+
+	lock    sync.Mutex
+	expires time.Time
+	err     error
+	stop    chan struct{}
+	lost    chan struct{}
+}
+
+// lockFile gives the lock file's info or nil if it doesn't exist. It never comes from the cache.
+func (c *Client) lockFile(filePath string, shared bool) (*FileInfo, error) {
+	c.invalidateCache(filePath, shared)
+	dir, err := c.GetDir(GetDirInfo{DirPath: path.Dir(filePath), Shared: shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read lock: %v", err)
+	}
+	for _, file := range dir.Files {
+		if file.Name == path.Base(filePath) {
+			return &file, nil
+		}
+	}
+	return nil, nil
+}
+
+func randomHex(size int) (string, error) {
+	byts := make([]byte, size)
+	if _, err := rand.Read(byts); err != nil {
+		return "", fmt.Errorf("Unable to generate random bytes: %v", err)
+	}
+	return hex.EncodeToString(byts), nil
+}
+
+func isLockFile(file FileInfo) bool {
+	return ParseMetadata(file.Metadata)[MetadataLockToken] != ""
+}
+
+func parseLockFile(file *FileInfo) (Metadata, time.Time, error) {
+	meta := ParseMetadata(file.Metadata)
+	expires, err := time.Parse(time.RFC3339Nano, meta[MetadataLockExpires])
+	if err != nil || meta[MetadataLockToken] == "" {
+		return nil, time.Time{}, fmt.Errorf("%v is not a lock file", file.Name)
+	}
+	return meta, expires, nil
+}
+
+// Lock takes the lock at LockInfo.FilePath, waiting up to LockInfo.Wait for it if someone else holds it. An expired
+// lock is taken over. If the lock isn't available, a *LockHeldError is returned. See the comments at the top of this
+// file for what guarantees a lock gives.
+func (c *Client) Lock(li LockInfo) (*Lock, error) {
+	li.FilePath = path.Clean("/" + li.FilePath)
+	if li.TTL <= 0 {
+		li.TTL = DefaultLockTTL
+	}
+	if li.Holder == "" {
+		host, _ := os.Hostname()
+		li.Holder = fmt.Sprintf("%v:%v", host, os.Getpid())
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lock{c: c, FilePath: li.FilePath, Shared: li.Shared, Holder: li.Holder, Token: token, TTL: li.TTL}
+	deadline := time.Now().Add(li.Wait)
+	for {
+		err := l.tryLock()
+		if err == nil {
+			break
+		} else if _, ok := err.(*LockHeldError); !ok || time.Now().Add(lockRetryInterval).After(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	if li.Heartbeat {
+		l.stop, l.lost = make(chan struct{}), make(chan struct{})
+		go l.heartbeat()
+	}
+	return l, nil
+}
+
+func (l *Lock) tryLock() error {
+	// Once for the lock being free, once more if it's released or taken over from its expired holder in between
+	for attempt := 0; attempt < 2; attempt++ {
+		expires := time.Now().Add(l.TTL)
+		meta := Metadata{
+			MetadataLockHolder:  l.Holder,
+			MetadataLockExpires: expires.UTC().Format(time.RFC3339Nano),
+			MetadataLockToken:   l.Token,
+		}
+		createErr := l.c.CreateFile(CreateFileInfo{FilePath: l.FilePath, Shared: l.Shared, Metadata: meta.String()})
+		if createErr == nil {
+			l.expires = expires
+			return nil
+		}
+		file, err := l.c.lockFile(l.FilePath, l.Shared)
+		if err != nil {
+			return err
+		} else if file == nil {
+			if attempt > 0 {
+				return fmt.Errorf("Unable to create lock: %v", createErr)
+			}
+			continue
+		}
+		existing, existingExpires, err := parseLockFile(file)
+		if err != nil {
+			return err
+		} else if time.Now().Before(existingExpires) || attempt > 0 {
+			return &LockHeldError{Holder: existing[MetadataLockHolder], Expires: existingExpires}
+		}
+		// Take over the expired lock
+		err = l.c.DeleteFile(DeleteFileInfo{FilePath: l.FilePath, Shared: l.Shared})
+		if err != nil {
+			if file, _ := l.c.lockFile(l.FilePath, l.Shared); file != nil {
+				return fmt.Errorf("Unable to take over lock: %v", err)
+			}
+		}
+	}
+	return fmt.Errorf("Unable to take lock %v", l.FilePath)
+}
+
+func (l *Lock) heartbeat() {
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.Renew(); err != nil {
+				l.lock.Lock()
+				l.err = err
+				l.lock.Unlock()
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// Expires gives when the lock expires unless it is renewed
+func (l *Lock) Expires() time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.expires
+}
+
+// Lost gives a channel that is closed if a heartbeat fails to renew the lock, after which the lock should be treated
+// as no longer held. It is nil if the lock wasn't taken with LockInfo.Heartbeat.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err gives the error from the heartbeat that failed to renew the lock, if one has
+func (l *Lock) Err() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.err
+}
+
+// Renew extends the lock to the TTL from now
+func (l *Lock) Renew() error {
+	expires := time.Now().Add(l.TTL)
+	err := l.c.RenewLock(RenewLockInfo{FilePath: l.FilePath, Shared: l.Shared, Token: l.Token, TTL: l.TTL})
+	if err == nil {
+		l.lock.Lock()
+		l.expires = expires
+		l.lock.Unlock()
+	}
+	return err
+}
+
+// Unlock stops any heartbeat and releases the lock
+func (l *Lock) Unlock() error {
+	if l.stop != nil {
+		select {
+		case <-l.stop:
+		default:
+			close(l.stop)
+		}
+	}
+	return l.c.Unlock(UnlockInfo{FilePath: l.FilePath, Shared: l.Shared, Token: l.Token})
+}
+
+// RenewLock extends the lock held with RenewLockInfo.Token, e.g. by an earlier process. If the lock was released or
+// taken over, ErrLockNotHeld is returned.
+func (c *Client) RenewLock(rl RenewLockInfo) error {
+	rl.FilePath = path.Clean("/" + rl.FilePath)
+	if rl.TTL <= 0 {
+		rl.TTL = DefaultLockTTL
+	}
+	file, err := c.lockFile(rl.FilePath, rl.Shared)
+	if err != nil {
+		return err
+	} else if file == nil {
+		return ErrLockNotHeld
+	}
+	meta, _, err := parseLockFile(file)
+	if err != nil {
+		return err
+	} else if meta[MetadataLockToken] != rl.Token {
+		return ErrLockNotHeld
+	}
+	meta[MetadataLockExpires] = time.Now().Add(rl.TTL).UTC().Format(time.RFC3339Nano)
+	if err = c.ChangeFile(ChangeFileInfo{FilePath: rl.FilePath, Shared: rl.Shared, Metadata: meta.String()}); err != nil {
+		return fmt.Errorf("Unable to renew lock: %v", err)
+	}
+	return nil
+}
+
+// Unlock releases the lock held with UnlockInfo.Token, e.g. by an earlier process. If the lock was released or taken
+// over, ErrLockNotHeld is returned unless UnlockInfo.Force is set. Even with UnlockInfo.Force, files that aren't locks
+// are never deleted.
+func (c *Client) Unlock(ul UnlockInfo) error {
+	ul.FilePath = path.Clean("/" + ul.FilePath)
+	file, err := c.lockFile(ul.FilePath, ul.Shared)
+	if err != nil {
+		return err
+	} else if file == nil {
+		if ul.Force {
+			return nil
+		}
+		return ErrLockNotHeld
+	}
+	if ul.Force && !isLockFile(*file) {
+		return fmt.Errorf("%v is not a lock file", file.Name)
+	} else if !ul.Force {
+		meta, _, err := parseLockFile(file)
+		if err != nil {
+			return err
+		} else if meta[MetadataLockToken] != ul.Token {
+			return ErrLockNotHeld
+		}
+	}
+	if err = c.DeleteFile(DeleteFileInfo{FilePath: ul.FilePath, Shared: ul.Shared}); err != nil {
+		return fmt.Errorf("Unable to unlock: %v", err)
+	}
+	return nil
+}
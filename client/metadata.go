@@ -0,0 +1,38 @@
+package client
+
+import "encoding/json"
+
+// Metadata is a set of key/value pairs stored as a JSON object in the metadata string of a file or directory. Features
+// of this library that need to keep information alongside an entry store it here so that multiple features and the
+// application's own values can coexist.
+type Metadata map[string]string
+
+// MetadataValueKey is the key that ParseMetadata places existing metadata under when it is not a JSON object
+const MetadataValueKey = "value"
+
+// ParseMetadata parses the metadata string of a file or directory. An empty string gives an empty Metadata. A string
+// that is not a JSON object of strings is kept unchanged under MetadataValueKey.
+func ParseMetadata(str string) Metadata {
+	ret := Metadata{}
+	if str == "" {
+		return ret
+	}
+	if err := json.Unmarshal([]byte(str), &ret); err != nil {
+		ret = Metadata{MetadataValueKey: str}
+	}
+	return ret
+}
+
+// String gives the metadata string to store for this set of values. If the only value is at MetadataValueKey, it is
+// returned as is so values that were not set by this library are not altered.
+func (m Metadata) String() string {
+	if len(m) == 0 {
+		return ""
+	}
+	if v, ok := m[MetadataValueKey]; ok && len(m) == 1 {
+		return v
+	}
+	// Marshalling a map of strings can't fail and keys are sorted for us
+	byts, _ := json.Marshal(map[string]string(m))
+	return string(byts)
+}
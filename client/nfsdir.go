@@ -3,6 +3,7 @@ package client
 import (
 	"errors"
 	"net/url"
+	"path"
 	"strconv"
 )
 
@@ -22,6 +23,8 @@ type CreateDirInfo struct {
 
 // CreateDir creates a directory. See https://maidsafe.readme.io/docs/nfs-create-directory for more info.
 func (c *Client) CreateDir(cd CreateDirInfo) error {
+	defer c.invalidateCache(cd.DirPath, cd.Shared)
+	c.versioned.forget(cd.DirPath, cd.Shared)
 	req := &Request{
 		Path:     "/nfs/directory",
 		Method:   "POST",
@@ -31,6 +34,32 @@ func (c *Client) CreateDir(cd CreateDirInfo) error {
 	return err
 }
 
+// MkdirAll creates CreateDirInfo.DirPath and any parents that don't exist. Parents are created with the same Shared
+// and Private values and the rest of CreateDirInfo only applies to the directory itself. Nothing is changed for
+// directories that already exist.
+func (c *Client) MkdirAll(cd CreateDirInfo) error {
+	cd.DirPath = path.Clean("/" + cd.DirPath)
+	if cd.DirPath == "/" {
+		return nil
+	}
+	if _, err := c.GetDir(GetDirInfo{DirPath: cd.DirPath, Shared: cd.Shared}); err == nil {
+		return nil
+	} else if !IsNotExist(err) {
+		return err
+	}
+	parent := CreateDirInfo{DirPath: path.Dir(cd.DirPath), Private: cd.Private, Shared: cd.Shared}
+	if err := c.MkdirAll(parent); err != nil {
+		return err
+	}
+	if err := c.CreateDir(cd); err != nil {
+		// Something else may have created it in the meantime
+		if _, getErr := c.GetDir(GetDirInfo{DirPath: cd.DirPath, Shared: cd.Shared}); getErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetDirInfo are parameters for Client.GetDir
 type GetDirInfo struct {
 	// The path to fetch
@@ -41,6 +70,11 @@ type GetDirInfo struct {
 
 // GetDir gets directory information. See https://maidsafe.readme.io/docs/nfs-get-directory for more info.
 func (c *Client) GetDir(gd GetDirInfo) (DirResponse, error) {
+	if c.Cache != nil {
+		if dir, ok := c.cachedDir(gd.DirPath, gd.Shared); ok {
+			return dir, nil
+		}
+	}
 	var resp DirResponse
 	req := &Request{
 		Path:         "/nfs/directory/" + url.QueryEscape(gd.DirPath) + "/" + strconv.FormatBool(gd.Shared),
@@ -48,6 +82,10 @@ func (c *Client) GetDir(gd GetDirInfo) (DirResponse, error) {
 		JSONResponse: &resp,
 	}
 	_, err := c.Do(req)
+	if err == nil && c.Cache != nil {
+		dir := copyDirResponse(resp)
+		c.Cache.put(&cacheEntry{Key: cacheKey(cacheKindDir, gd.Shared, gd.DirPath), Dir: &dir})
+	}
 	return resp, err
 }
 
@@ -61,6 +99,7 @@ type DeleteDirInfo struct {
 
 // DeleteDir deletes a directory. See https://maidsafe.readme.io/docs/nfs-delete-directory for more info.
 func (c *Client) DeleteDir(dd DeleteDirInfo) error {
+	defer c.invalidateCache(dd.DirPath, dd.Shared)
 	req := &Request{
 		Path:   "/nfs/directory/" + url.QueryEscape(dd.DirPath) + "/" + strconv.FormatBool(dd.Shared),
 		Method: "DELETE",
@@ -88,6 +127,7 @@ func (c *Client) ChangeDir(cd ChangeDirInfo) error {
 	if cd.NewName == "" && cd.Metadata == "" {
 		return errors.New("Must provide name or metadata")
 	}
+	defer c.invalidateCache(cd.DirPath, cd.Shared)
 	req := &Request{
 		Path:     "/nfs/directory/" + url.QueryEscape(cd.DirPath) + "/" + strconv.FormatBool(cd.Shared),
 		Method:   "PUT",
@@ -110,6 +150,8 @@ type MoveDirInfo struct {
 // MoveDir moves a directory. This is currently undocumented/unsupported. See
 // https://maidsafe.atlassian.net/browse/CS-60 for more info.
 func (c *Client) MoveDir(md MoveDirInfo) error {
+	defer c.invalidateCache(md.SrcPath, md.SrcShared)
+	defer c.invalidateCache(md.DestPath, md.DestShared)
 	req := &Request{
 		Path:     "/nfs/movedir",
 		Method:   "POST",
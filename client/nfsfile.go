@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"path"
 	"strconv"
 )
 
@@ -22,6 +23,7 @@ type CreateFileInfo struct {
 
 // CreateFile creates a file. See https://maidsafe.readme.io/docs/nfsfile for more information.
 func (c *Client) CreateFile(cf CreateFileInfo) error {
+	defer c.invalidateCache(cf.FilePath, cf.Shared)
 	req := &Request{
 		Path:     "/nfs/file",
 		Method:   "POST",
@@ -45,6 +47,16 @@ type MoveFileInfo struct {
 // for more info.
 func (c *Client) MoveFile(mf MoveFileInfo) error {
 	// TODO: appears broken
+	if !mf.RetainSource {
+		if err := c.versionBeforeChange(mf.SrcPath, mf.SrcShared, false); err != nil {
+			return err
+		}
+	}
+	if err := c.versionBeforeChange(path.Join(mf.DestPath, path.Base(mf.SrcPath)), mf.DestShared, true); err != nil {
+		return err
+	}
+	defer c.invalidateCache(mf.SrcPath, mf.SrcShared)
+	defer c.invalidateCache(mf.DestPath, mf.DestShared)
 	req := &Request{
 		Path:     "/nfs/movefile",
 		Method:   "POST",
@@ -64,6 +76,14 @@ type DeleteFileInfo struct {
 
 // DeleteFile deletes a file. See https://maidsafe.readme.io/docs/nfs-delete-file for more info.
 func (c *Client) DeleteFile(df DeleteFileInfo) error {
+	if err := c.versionBeforeChange(df.FilePath, df.Shared, false); err != nil {
+		return err
+	}
+	return c.deleteFile(df)
+}
+
+func (c *Client) deleteFile(df DeleteFileInfo) error {
+	defer c.invalidateCache(df.FilePath, df.Shared)
 	req := &Request{
 		Path:   "/nfs/file/" + url.QueryEscape(df.FilePath) + "/" + strconv.FormatBool(df.Shared),
 		Method: "DELETE",
@@ -88,6 +108,17 @@ func (c *Client) ChangeFile(cf ChangeFileInfo) error {
 	if cf.NewName == "" && cf.Metadata == "" {
 		return errors.New("Must provide name or metadata")
 	}
+	// Only renames change what is in the directory
+	if cf.NewName != "" {
+		if err := c.versionBeforeChange(cf.FilePath, cf.Shared, false); err != nil {
+			return err
+		}
+	}
+	return c.changeFile(cf)
+}
+
+func (c *Client) changeFile(cf ChangeFileInfo) error {
+	defer c.invalidateCache(cf.FilePath, cf.Shared)
 	req := &Request{
 		Path:     "/nfs/file/metadata/" + url.QueryEscape(cf.FilePath) + "/" + strconv.FormatBool(cf.Shared),
 		Method:   "PUT",
@@ -107,24 +138,53 @@ type WriteFileInfo struct {
 	Contents io.ReadCloser
 	// The byte offset in the file to start writing
 	Offset int64
+	// If true, the contents are gzip compressed unless they appear to already be compressed (e.g. images or zip
+	// files) and the codec and logical size are recorded in the file's Metadata. This requires Offset to be 0 and
+	// costs extra calls to update the metadata. Writes at offset 0 without this set remove the codec and logical size
+	// from the Metadata, which costs an extra call to read it.
+	Compress bool
+	// If not nil, this is called with the progress of the upload. For compressed writes this is the progress of the
+	// compressed contents.
+	Progress ProgressFunc
 }
 
 // WriteFile writes a file. See https://maidsafe.readme.io/docs/nfs-update-file-content for more info.
 func (c *Client) WriteFile(wf WriteFileInfo) error {
 	// TODO: support chunking instead of all in mem
 	defer wf.Contents.Close()
+	defer c.invalidateCache(wf.FilePath, wf.Shared)
+	if wf.Compress && wf.Offset != 0 {
+		return errors.New("Compressed writes must start at offset 0")
+	}
+	// Later writes at an offset are assumed to continue the same change
+	if wf.Offset == 0 {
+		if err := c.versionBeforeChange(wf.FilePath, wf.Shared, true); err != nil {
+			return err
+		}
+	}
 	byts, err := ioutil.ReadAll(wf.Contents)
 	if err != nil {
 		return fmt.Errorf("Unable to read contents: %v", err)
 	}
+	logicalSize := int64(len(byts))
+	compression := ""
+	if wf.Compress {
+		if byts, compression, err = compressContents(wf.FilePath, byts); err != nil {
+			return err
+		}
+	}
 	req := &Request{
-		Path:    "/nfs/file/" + url.QueryEscape(wf.FilePath) + "/" + strconv.FormatBool(wf.Shared),
-		Method:  "PUT",
-		RawBody: byts,
-		Query:   map[string][]string{"offset": []string{strconv.FormatInt(wf.Offset, 10)}},
+		Path:           "/nfs/file/" + url.QueryEscape(wf.FilePath) + "/" + strconv.FormatBool(wf.Shared),
+		Method:         "PUT",
+		RawBody:        byts,
+		Query:          map[string][]string{"offset": []string{strconv.FormatInt(wf.Offset, 10)}},
+		UploadProgress: wf.Progress,
 	}
-	_, err = c.Do(req)
-	return err
+	// Later writes at an offset can't change whether the file is compressed
+	if _, err = c.Do(req); err != nil || wf.Offset != 0 {
+		return err
+	}
+	return c.updateCompressionMetadata(wf.FilePath, wf.Shared, compression, logicalSize)
 }
 
 // GetFileInfo are parameters for Client.GetFile
@@ -137,19 +197,45 @@ type GetFileInfo struct {
 	Offset int64
 	// The amount of bytes to read. If the value is 0 then there is no length constraint
 	Length int64
+	// If true and the file was compressed by WriteFile, the contents are decompressed. Offset and Length then apply to
+	// the decompressed contents. This costs an extra call to read the file's metadata.
+	Decompress bool
+	// If not nil, this is called with the progress of the download. For decompressed files this is the progress of the
+	// compressed contents.
+	Progress ProgressFunc
 }
 
 // GetFile obtains a file's contents. See https://maidsafe.readme.io/docs/nfs-get-file for more info.
 func (c *Client) GetFile(gf GetFileInfo) (io.ReadCloser, error) {
+	if gf.Offset < 0 || gf.Length < 0 {
+		return nil, errors.New("Offset and length can't be negative")
+	}
+	if gf.Decompress {
+		info, err := c.statFile(gf.FilePath, gf.Shared)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get file: %v", err)
+		}
+		if compression := ParseMetadata(info.Metadata)[MetadataCompression]; compression != "" {
+			return c.getCompressedFile(gf, compression)
+		}
+	}
+	if c.Cache != nil {
+		return c.getFileWithCache(gf)
+	}
+	return c.getFile(gf)
+}
+
+func (c *Client) getFile(gf GetFileInfo) (io.ReadCloser, error) {
 	// TODO: support chunking instead of all in mem
 	query := map[string][]string{"offset": []string{strconv.FormatInt(gf.Offset, 10)}}
 	if gf.Length > 0 {
 		query["length"] = []string{strconv.FormatInt(gf.Length, 10)}
 	}
 	req := &Request{
-		Path:   "/nfs/file/" + url.QueryEscape(gf.FilePath) + "/" + strconv.FormatBool(gf.Shared),
-		Method: "GET",
-		Query:  query,
+		Path:             "/nfs/file/" + url.QueryEscape(gf.FilePath) + "/" + strconv.FormatBool(gf.Shared),
+		Method:           "GET",
+		Query:            query,
+		DownloadProgress: gf.Progress,
 	}
 	resp, err := c.Do(req)
 	if err != nil {
@@ -161,3 +247,18 @@ func (c *Client) GetFile(gf GetFileInfo) (io.ReadCloser, error) {
 	}
 	return ioutil.NopCloser(bytes.NewReader(byts)), nil
 }
+
+// statFile finds the info for a single file by listing its parent directory
+func (c *Client) statFile(filePath string, shared bool) (FileInfo, error) {
+	dir, err := c.GetDir(GetDirInfo{DirPath: path.Dir(path.Clean("/" + filePath)), Shared: shared})
+	if err != nil {
+		return FileInfo{}, err
+	}
+	name := path.Base(filePath)
+	for _, file := range dir.Files {
+		if file.Name == name {
+			return file, nil
+		}
+	}
+	return FileInfo{}, fmt.Errorf("File not found: %v", filePath)
+}
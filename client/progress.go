@@ -0,0 +1,163 @@
+package client
+
+import (
+	"golang.org/x/crypto/nacl/secretbox"
+	"io"
+	"time"
+)
+
+// Progress is reported to a ProgressFunc as bytes are transferred
+type Progress struct {
+	// The bytes transferred so far
+	Transferred int64
+	// The total bytes to transfer or -1 if not known
+	Total int64
+	// The average bytes per second since the transfer started
+	Rate float64
+	// For tree operations, the number of files completed so far
+	Files int
+	// Whether the transfer is complete. This is only reported once.
+	Done bool
+}
+
+// ProgressFunc is called with the progress of a transfer. It is called from the goroutine doing the transfer so it
+// should return quickly. It can be called very often, so implementers should throttle any output themselves.
+type ProgressFunc func(p Progress)
+
+// ProgressReader is an io.ReadCloser that reports progress as it is read. Completion is reported at EOF or, if it is
+// closed first, at close.
+type ProgressReader struct {
+	r           io.Reader
+	total       int64
+	fn          ProgressFunc
+	transferred int64
+	start       time.Time
+	done        bool
+}
+
+// NewProgressReader wraps the reader to report to fn as it is read. The total can be -1 if not known.
+func NewProgressReader(r io.Reader, total int64, fn ProgressFunc) *ProgressReader {
+	return &ProgressReader{r: r, total: total, fn: fn}
+}
+
+// Read reads from the underlying reader and reports progress
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	n, err := p.r.Read(b)
+	p.transferred += int64(n)
+	if err == io.EOF {
+		p.finish()
+	} else if n > 0 {
+		p.report()
+	}
+	return n, err
+}
+
+// Close reports completion if not already reported and closes the underlying reader if it is an io.Closer
+func (p *ProgressReader) Close() error {
+	p.finish()
+	if closer, ok := p.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (p *ProgressReader) report() {
+	progress := Progress{Transferred: p.transferred, Total: p.total, Done: p.done}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		progress.Rate = float64(p.transferred) / elapsed
+	}
+	p.fn(progress)
+}
+
+func (p *ProgressReader) finish() {
+	if !p.done {
+		p.done = true
+		if p.start.IsZero() {
+			p.start = time.Now()
+		}
+		p.report()
+	}
+}
+
+// encryptedProgress converts progress on base 64 encoded encrypted bodies to unencrypted sizes. If plainTotal is -1,
+// the sizes are estimated from the encrypted sizes.
+func encryptedProgress(fn ProgressFunc, plainTotal int64) ProgressFunc {
+	return func(p Progress) {
+		if plainTotal >= 0 && p.Total > 0 {
+			p.Transferred = p.Transferred * plainTotal / p.Total
+			p.Rate = p.Rate * float64(plainTotal) / float64(p.Total)
+			p.Total = plainTotal
+		} else {
+			if p.Total >= 0 {
+				p.Total = estimatePlainSize(p.Total)
+			}
+			p.Transferred = estimatePlainSize(p.Transferred)
+			p.Rate = p.Rate * 3 / 4
+		}
+		if p.Done && p.Total >= 0 {
+			p.Transferred = p.Total
+		}
+		fn(p)
+	}
+}
+
+func estimatePlainSize(encodedSize int64) int64 {
+	if size := encodedSize/4*3 - secretbox.Overhead; size > 0 {
+		return size
+	}
+	return 0
+}
+
+// progressAggregator combines the progress of transfers made one after another into a single progress
+type progressAggregator struct {
+	fn        ProgressFunc
+	total     int64
+	completed int64
+	files     int
+	start     time.Time
+}
+
+func newProgressAggregator(fn ProgressFunc, total int64) *progressAggregator {
+	return &progressAggregator{fn: fn, total: total, start: time.Now()}
+}
+
+func (p *progressAggregator) progress(transferred int64, done bool) Progress {
+	progress := Progress{Transferred: transferred, Total: p.total, Files: p.files, Done: done}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		progress.Rate = float64(transferred) / elapsed
+	}
+	return progress
+}
+
+// transfer gives the ProgressFunc for the next file. It returns nil if there is no ProgressFunc to report to.
+func (p *progressAggregator) transfer() ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return func(fp Progress) {
+		if fp.Done {
+			p.completed += fp.Transferred
+			p.files++
+			p.fn(p.progress(p.completed, false))
+		} else {
+			p.fn(p.progress(p.completed+fp.Transferred, false))
+		}
+	}
+}
+
+// fileWithoutTransfer counts a file that had nothing to transfer
+func (p *progressAggregator) fileWithoutTransfer() {
+	if p != nil {
+		p.files++
+	}
+}
+
+// finish reports completion
+func (p *progressAggregator) finish() {
+	if p != nil {
+		p.fn(p.progress(p.completed, true))
+	}
+}
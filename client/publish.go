@@ -0,0 +1,354 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PublishEventType is the kind of change in a PublishEvent
+type PublishEventType string
+
+const (
+	// PublishWritten is a file or directory that was created or replaced on SAFE
+	PublishWritten PublishEventType = "written"
+	// PublishDeleted is a file or directory that was deleted from SAFE
+	PublishDeleted PublishEventType = "deleted"
+	// PublishRenamed is a file that was renamed on SAFE instead of written again
+	PublishRenamed PublishEventType = "renamed"
+	// PublishFailed is a path that couldn't be published and will be retried by the next Publisher.Publish
+	PublishFailed PublishEventType = "failed"
+)
+
+// PublishEvent is a single change made, or that failed to be made, by Publisher.Publish
+type PublishEvent struct {
+	// The kind of change
+	Type PublishEventType
+	// The slash-separated path relative to the published directories
+	Path string
+	// For PublishRenamed, the relative path the file was renamed from
+	OldPath string
+	// Whether this is a directory
+	Dir bool
+	// For PublishFailed, why it failed
+	Err error
+}
+
+// PublisherInfo are parameters for Client.NewPublisher
+type PublisherInfo struct {
+	// The local directory to publish
+	LocalDirPath string
+	// The existing SAFE directory to publish to
+	DirPath string
+	// Whether the SAFE directory is shared
+	Shared bool
+	// Name patterns in filepath.Match syntax of files and directories to never publish. Anything on SAFE matching them
+	// is left alone, as are the trash, saved versions and the temp files of atomic writes.
+	Ignore []string
+	// If true, files are replaced with WriteFileAtomic so they are never seen partially written
+	Atomic bool
+}
+
+// Publisher makes a SAFE directory match a local one for the paths it is told have changed. Create with
+// Client.NewPublisher. It is not safe for concurrent use.
+type Publisher struct {
+	c  *Client
+	pi PublisherInfo
+	// What is on SAFE keyed by relative path. For files we wrote, ModifiedOn is the local time of what was written.
+	published Snapshot
+	// Relative paths that changed since the last publish
+	pending map[string]bool
+	// Relative paths that failed to publish
+	retries  map[string]bool
+	failures int
+}
+
+// NewPublisher snapshots the SAFE directory at PublisherInfo.DirPath to know what is already published. Nothing is
+// published until paths are queued and Publisher.Publish is called.
+func (c *Client) NewPublisher(pi PublisherInfo) (*Publisher, error) {
+	for _, pattern := range pi.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid ignore pattern %v: %v", pattern, err)
+		}
+	}
+	p := &Publisher{c: c, pi: pi, pending: map[string]bool{}, retries: map[string]bool{}}
+	p.pi.LocalDirPath = filepath.Clean(pi.LocalDirPath)
+	p.pi.DirPath = path.Clean("/" + pi.DirPath)
+	var err error
+	if p.published, err = c.Snapshot(SnapshotInfo{DirPath: p.pi.DirPath, Shared: pi.Shared}); err != nil {
+		return nil, err
+	}
+	for relPath := range p.published {
+		if p.Ignored(relPath) {
+			delete(p.published, relPath)
+		}
+	}
+	return p, nil
+}
+
+// RelPath gives the slash-separated path of a local path relative to PublisherInfo.LocalDirPath, or an empty string
+// for the directory itself
+func (p *Publisher) RelPath(localPath string) string {
+	relPath, err := filepath.Rel(p.pi.LocalDirPath, localPath)
+	if err != nil || relPath == "." {
+		return ""
+	}
+	return filepath.ToSlash(relPath)
+}
+
+func (p *Publisher) localPath(relPath string) string {
+	return filepath.Join(p.pi.LocalDirPath, filepath.FromSlash(relPath))
+}
+
+// Ignored reports whether the relative path or any directory it is in matches a PublisherInfo.Ignore pattern or is
+// kept by the client itself, i.e. the trash, saved versions and the temp files of atomic writes
+func (p *Publisher) Ignored(relPath string) bool {
+	safePath := path.Join(p.pi.DirPath, relPath)
+	if safePath == TrashDirPath || strings.HasPrefix(safePath, TrashDirPath+"/") {
+		return true
+	}
+	for _, name := range strings.Split(relPath, "/") {
+		if name == versionsDirName || (strings.HasPrefix(name, ".") &&
+			(strings.Contains(name, atomicTempMarker) || strings.Contains(name, atomicReadyMarker))) {
+			return true
+		}
+		for _, pattern := range p.pi.Ignore {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Queue marks the relative path as changed so the next Publish checks it. Ignored paths are not queued.
+func (p *Publisher) Queue(relPath string) {
+	if relPath != "" && !p.Ignored(relPath) {
+		p.pending[relPath] = true
+	}
+}
+
+// QueueDir queues the local directory and everything under it
+func (p *Publisher) QueueDir(localPath string) error {
+	return filepath.Walk(localPath, func(entryPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if relPath := p.RelPath(entryPath); relPath != "" {
+			if p.Ignored(relPath) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			p.pending[relPath] = true
+		}
+		return nil
+	})
+}
+
+// QueueAll queues everything local and everything published so the next Publish brings SAFE up to date with the
+// local directory. Only what differs gets published.
+func (p *Publisher) QueueAll() error {
+	for relPath := range p.published {
+		p.pending[relPath] = true
+	}
+	return p.QueueDir(p.pi.LocalDirPath)
+}
+
+// Retrying reports whether there are paths that failed to publish that the next Publish will retry
+func (p *Publisher) Retrying() bool {
+	return len(p.retries) > 0
+}
+
+// Failures is the number of consecutive calls to Publish that had a path fail
+func (p *Publisher) Failures() int {
+	return p.failures
+}
+
+// Publish publishes all queued paths and previously failed paths, keeping the ones that fail for retry. The changes
+// made and the paths that failed are returned with renames first and the rest in path order.
+func (p *Publisher) Publish() []PublishEvent {
+	for relPath := range p.retries {
+		p.pending[relPath] = true
+	}
+	relPaths := make([]string, 0, len(p.pending))
+	for relPath := range p.pending {
+		relPaths = append(relPaths, relPath)
+	}
+	p.pending, p.retries = map[string]bool{}, map[string]bool{}
+	// Sorting puts parents before their children
+	sort.Strings(relPaths)
+	events, renamed := p.publishRenames(relPaths)
+	for _, relPath := range relPaths {
+		if renamed[relPath] {
+			continue
+		}
+		pathEvents, err := p.publishPath(relPath)
+		events = append(events, pathEvents...)
+		if err != nil {
+			events = append(events, PublishEvent{Type: PublishFailed, Path: relPath, Err: err})
+			p.retries[relPath] = true
+		}
+	}
+	if len(p.retries) > 0 {
+		p.failures++
+	} else {
+		p.failures = 0
+	}
+	return events
+}
+
+// publishRenames finds files that are gone locally and unpublished files in the same directory with the same size and
+// modification time. These are renames, so they are renamed on SAFE. The paths that were handled are returned.
+func (p *Publisher) publishRenames(relPaths []string) ([]PublishEvent, map[string]bool) {
+	var gone, appeared []string
+	stats := map[string]os.FileInfo{}
+	for _, relPath := range relPaths {
+		stat, err := os.Stat(p.localPath(relPath))
+		prev, wasPublished := p.published[relPath]
+		if os.IsNotExist(err) && wasPublished && !prev.Dir {
+			gone = append(gone, relPath)
+		} else if err == nil && !stat.IsDir() && !wasPublished {
+			appeared = append(appeared, relPath)
+			stats[relPath] = stat
+		}
+	}
+	events := []PublishEvent{}
+	renamed := map[string]bool{}
+	for _, newPath := range appeared {
+		stat := stats[newPath]
+		for _, oldPath := range gone {
+			prev := p.published[oldPath]
+			if renamed[oldPath] || path.Dir(oldPath) != path.Dir(newPath) || prev.Size != stat.Size() ||
+				stat.ModTime().After(prev.ModifiedOn) {
+				continue
+			}
+			err := p.c.ChangeFile(ChangeFileInfo{
+				FilePath: path.Join(p.pi.DirPath, oldPath),
+				Shared:   p.pi.Shared,
+				NewName:  path.Base(newPath),
+			})
+			// If it can't be renamed, it'll be deleted and uploaded instead
+			if err == nil {
+				events = append(events, PublishEvent{Type: PublishRenamed, Path: newPath, OldPath: oldPath})
+				prev.Path = newPath
+				p.published[newPath] = prev
+				delete(p.published, oldPath)
+				renamed[oldPath], renamed[newPath] = true, true
+			}
+			break
+		}
+	}
+	return events, renamed
+}
+
+// publishPath makes SAFE match the local path if it doesn't already
+func (p *Publisher) publishPath(relPath string) ([]PublishEvent, error) {
+	events := []PublishEvent{}
+	stat, err := os.Stat(p.localPath(relPath))
+	if err != nil && !os.IsNotExist(err) {
+		return events, err
+	}
+	prev, wasPublished := p.published[relPath]
+	// Remove what's there if it's gone or changed type
+	if wasPublished && (err != nil || prev.Dir != stat.IsDir()) {
+		if err := p.unpublish(relPath, prev.Dir); err != nil {
+			return events, err
+		}
+		events = append(events, PublishEvent{Type: PublishDeleted, Path: relPath, Dir: prev.Dir})
+		wasPublished = false
+	}
+	if err != nil {
+		return events, nil
+	}
+	if stat.IsDir() {
+		dirEvents, err := p.ensureDir(relPath)
+		return append(events, dirEvents...), err
+	}
+	if wasPublished && prev.Size == stat.Size() && !stat.ModTime().After(prev.ModifiedOn) {
+		return events, nil
+	}
+	dirEvents, err := p.ensureDir(path.Dir(relPath))
+	events = append(events, dirEvents...)
+	if err != nil {
+		return events, err
+	}
+	if err = p.writeFile(relPath, wasPublished, stat.Size()); err != nil {
+		return events, err
+	}
+	p.published[relPath] = SnapshotEntry{Path: relPath, Size: stat.Size(), ModifiedOn: stat.ModTime()}
+	return append(events, PublishEvent{Type: PublishWritten, Path: relPath}), nil
+}
+
+func (p *Publisher) unpublish(relPath string, dir bool) error {
+	safePath := path.Join(p.pi.DirPath, relPath)
+	if !dir {
+		if err := p.c.DeleteFile(DeleteFileInfo{FilePath: safePath, Shared: p.pi.Shared}); err != nil {
+			return err
+		}
+		delete(p.published, relPath)
+		return nil
+	}
+	if err := p.c.DeleteDirRecursive(DeleteDirRecursiveInfo{DirPath: safePath, Shared: p.pi.Shared}); err != nil {
+		return err
+	}
+	for entryPath := range p.published {
+		if entryPath == relPath || strings.HasPrefix(entryPath, relPath+"/") {
+			delete(p.published, entryPath)
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) ensureDir(relPath string) ([]PublishEvent, error) {
+	if relPath == "." || relPath == "" || p.published[relPath].Dir {
+		return nil, nil
+	}
+	events, err := p.ensureDir(path.Dir(relPath))
+	if err != nil {
+		return events, err
+	}
+	safePath := path.Join(p.pi.DirPath, relPath)
+	if err := p.c.MkdirAll(CreateDirInfo{DirPath: safePath, Shared: p.pi.Shared}); err != nil {
+		return events, err
+	}
+	p.published[relPath] = SnapshotEntry{Path: relPath, Dir: true}
+	return append(events, PublishEvent{Type: PublishWritten, Path: relPath, Dir: true}), nil
+}
+
+func (p *Publisher) writeFile(relPath string, exists bool, size int64) error {
+	input, err := os.Open(p.localPath(relPath))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	safePath := path.Join(p.pi.DirPath, relPath)
+	if p.pi.Atomic {
+		return p.c.WriteFileAtomic(WriteFileAtomicInfo{FilePath: safePath, Shared: p.pi.Shared, Contents: input})
+	}
+	// Existing files are replaced instead of written over so no old content is left behind
+	if exists {
+		if err = p.c.DeleteFile(DeleteFileInfo{FilePath: safePath, Shared: p.pi.Shared}); err != nil {
+			return err
+		}
+		delete(p.published, relPath)
+	}
+	createInfo := CreateFileInfo{FilePath: safePath, Shared: p.pi.Shared}
+	if err = p.c.CreateFile(createInfo); err != nil {
+		// We may not have known it was there
+		if delErr := p.c.DeleteFile(DeleteFileInfo{FilePath: safePath, Shared: p.pi.Shared}); delErr != nil {
+			return err
+		}
+		if err = p.c.CreateFile(createInfo); err != nil {
+			return err
+		}
+	}
+	if size == 0 {
+		return nil
+	}
+	return p.c.WriteFile(WriteFileInfo{FilePath: safePath, Shared: p.pi.Shared, Contents: input})
+}
@@ -0,0 +1,328 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashDirPath is the directory trashed files and directories are kept in. Each area, shared or not, has its own.
+// Every call to Client.Trash makes a directory in it named by the time that holds a copy of what was trashed at its
+// original path, with the original path recorded in the directory's Metadata. Entries are copied instead of moved since
+// moving isn't reliable.
+const TrashDirPath = "/.trash"
+
+// DefaultTrashRetention is how long trashed entries are usually kept before being purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// Metadata keys for trash entry directories
+const (
+	// MetadataTrashPath is the Metadata key of the original path of a trashed entry
+	MetadataTrashPath = "trashPath"
+	// MetadataTrashDir is the Metadata key of whether a trashed entry is a directory
+	MetadataTrashDir = "trashDir"
+)
+
+// TrashEntry is a trashed file or directory
+type TrashEntry struct {
+	// The ID to restore the entry with, which is the name of its directory in TrashDirPath
+	ID string
+	// The original path
+	Path string
+	// Whether it is a directory
+	Dir bool
+	// When it was trashed
+	Time time.Time
+}
+
+// TrashInfo are parameters for Client.Trash
+type TrashInfo struct {
+	// The path of the file or directory to trash
+	Path string
+	// Whether the path is shared
+	Shared bool
+	// If not 0, trash entries older than this are purged after trashing
+	PurgeOlderThan time.Duration
+}
+
+// Trash deletes the file or directory at TrashInfo.Path and everything under it after copying it to the trash so it
+// can be restored with RestoreTrash. If it can't all be copied, nothing is deleted. If it can't all be deleted, what
+// is left stays in place as well as in the trash.
+func (c *Client) Trash(ti TrashInfo) (*TrashEntry, error) {
+	entryPath := path.Clean("/" + ti.Path)
+	if entryPath == "/" || entryPath == TrashDirPath || strings.HasPrefix(entryPath, TrashDirPath+"/") {
+		return nil, fmt.Errorf("Can't trash %v", entryPath)
+	}
+	file, dir, err := c.findEntry(entryPath, ti.Shared)
+	if err != nil {
+		return nil, err
+	} else if file == nil && dir == nil {
+		return nil, fmt.Errorf("%v not found", entryPath)
+	}
+	var tree *DirTree
+	if dir != nil {
+		if tree, err = c.LoadDirTree(LoadDirTreeInfo{DirPath: entryPath, Shared: ti.Shared}); err != nil {
+			return nil, err
+		}
+	}
+	entry, err := c.createTrashEntry(entryPath, dir != nil, ti.Shared)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy it, giving up on the trash entry if that fails
+	entryDirPath := path.Join(TrashDirPath, entry.ID)
+	copyPath := path.Join(entryDirPath, entryPath)
+	err = c.MkdirAll(CreateDirInfo{DirPath: path.Dir(copyPath), Shared: ti.Shared})
+	if err == nil && tree != nil {
+		err = c.copyTree(tree, copyPath, ti.Shared)
+	} else if err == nil {
+		err = c.copyFile(entryPath, copyPath, ti.Shared, file.Metadata)
+	}
+	if err != nil {
+		c.DeleteDirRecursive(DeleteDirRecursiveInfo{DirPath: entryDirPath, Shared: ti.Shared})
+		return nil, fmt.Errorf("Unable to copy to trash: %v", err)
+	}
+
+	// Now delete it
+	if tree != nil {
+		err = c.DeleteDirRecursive(DeleteDirRecursiveInfo{DirPath: entryPath, Shared: ti.Shared, Tree: tree})
+	} else {
+		err = c.DeleteFile(DeleteFileInfo{FilePath: entryPath, Shared: ti.Shared})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Copied to trash as %v but unable to delete: %v", entry.ID, err)
+	}
+	if ti.PurgeOlderThan > 0 {
+		if _, err = c.PurgeTrash(PurgeTrashInfo{Shared: ti.Shared, OlderThan: ti.PurgeOlderThan}); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// findEntry gives the file or directory at the path, with both nil if neither exists
+func (c *Client) findEntry(entryPath string, shared bool) (*FileInfo, *DirInfo, error) {
+	parent, err := c.GetDir(GetDirInfo{DirPath: path.Dir(entryPath), Shared: shared})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read dir: %v", err)
+	}
+	for _, file := range parent.Files {
+		if file.Name == path.Base(entryPath) {
+			return &file, nil, nil
+		}
+	}
+	for _, dir := range parent.SubDirs {
+		if dir.Name == path.Base(entryPath) {
+			return nil, &dir, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func (c *Client) createTrashEntry(entryPath string, dir bool, shared bool) (*TrashEntry, error) {
+	if err := c.MkdirAll(CreateDirInfo{DirPath: TrashDirPath, Shared: shared}); err != nil {
+		return nil, err
+	}
+	meta := Metadata{MetadataTrashPath: entryPath, MetadataTrashDir: strconv.FormatBool(dir)}
+	// Names are only taken by creating them, so another entry at the same time gets the next millisecond
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		now := time.Now().UTC().Add(time.Duration(attempt) * time.Millisecond)
+		entry := &TrashEntry{ID: now.Format(timeIDFormat), Path: entryPath, Dir: dir, Time: now.Truncate(time.Millisecond)}
+		err = c.CreateDir(CreateDirInfo{DirPath: path.Join(TrashDirPath, entry.ID), Shared: shared, Metadata: meta.String()})
+		if err == nil {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("Unable to create trash entry: %v", err)
+}
+
+// copyFile copies the file's raw contents, so compressed files stay compressed
+func (c *Client) copyFile(srcPath string, destPath string, shared bool, metadata string) error {
+	rc, err := c.GetFile(GetFileInfo{FilePath: srcPath, Shared: shared})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	byts, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("Unable to read %v: %v", srcPath, err)
+	}
+	if err = c.CreateFile(CreateFileInfo{FilePath: destPath, Shared: shared, Metadata: metadata}); err != nil {
+		return fmt.Errorf("Unable to create %v: %v", destPath, err)
+	}
+	if len(byts) == 0 {
+		return nil
+	}
+	contents := ioutil.NopCloser(bytes.NewReader(byts))
+	return c.WriteFile(WriteFileInfo{FilePath: destPath, Shared: shared, Contents: contents})
+}
+
+// copyTree copies the directory and everything under it to the path, which must not exist
+func (c *Client) copyTree(tree *DirTree, destPath string, shared bool) error {
+	err := c.CreateDir(CreateDirInfo{
+		DirPath:   destPath,
+		Shared:    shared,
+		Private:   tree.Info.Private,
+		Versioned: tree.Info.Versioned,
+		Metadata:  tree.Info.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to create %v: %v", destPath, err)
+	}
+	for _, file := range tree.Files {
+		err = c.copyFile(path.Join(tree.Path, file.Name), path.Join(destPath, file.Name), shared, file.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+	for _, sub := range tree.SubDirs {
+		if err = c.copyTree(sub, path.Join(destPath, path.Base(sub.Path)), shared); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTrashInfo are parameters for Client.ListTrash
+type ListTrashInfo struct {
+	// Whether to list the trash of the shared area
+	Shared bool
+}
+
+// ListTrash gives the trashed entries, oldest first
+func (c *Client) ListTrash(lt ListTrashInfo) ([]TrashEntry, error) {
+	entries := []TrashEntry{}
+	_, trashDir, err := c.findEntry(TrashDirPath, lt.Shared)
+	if err != nil || trashDir == nil {
+		return entries, err
+	}
+	dir, err := c.GetDir(GetDirInfo{DirPath: TrashDirPath, Shared: lt.Shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list trash: %v", err)
+	}
+	for _, sub := range dir.SubDirs {
+		meta := ParseMetadata(sub.Metadata)
+		entryTime, err := time.Parse(timeIDFormat, sub.Name)
+		// Anything else in the trash isn't an entry
+		if err != nil || meta[MetadataTrashPath] == "" {
+			continue
+		}
+		entries = append(entries, TrashEntry{
+			ID:   sub.Name,
+			Path: meta[MetadataTrashPath],
+			Dir:  meta[MetadataTrashDir] == "true",
+			Time: entryTime,
+		})
+	}
+	sort.Sort(trashEntries(entries))
+	return entries, nil
+}
+
+type trashEntries []TrashEntry
+
+func (t trashEntries) Len() int           { return len(t) }
+func (t trashEntries) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t trashEntries) Less(i, j int) bool { return t[i].ID < t[j].ID }
+
+// ErrTrashEntryNotFound is returned when restoring a trash entry that doesn't exist
+var ErrTrashEntryNotFound = errors.New("Trash entry not found")
+
+// RestoreTrashInfo are parameters for Client.RestoreTrash
+type RestoreTrashInfo struct {
+	// The ID of the entry
+	ID string
+	// Whether the entry is in the trash of the shared area
+	Shared bool
+	// Where to restore the entry to. It must not exist. If empty, the original path is used.
+	DestPath string
+}
+
+// RestoreTrash copies a trashed entry back to its original path or RestoreTrashInfo.DestPath, creating any missing
+// parent directories, and then removes it from the trash
+func (c *Client) RestoreTrash(rt RestoreTrashInfo) (*TrashEntry, error) {
+	entries, err := c.ListTrash(ListTrashInfo{Shared: rt.Shared})
+	if err != nil {
+		return nil, err
+	}
+	var entry *TrashEntry
+	for i := range entries {
+		if entries[i].ID == rt.ID {
+			entry = &entries[i]
+		}
+	}
+	if entry == nil {
+		return nil, ErrTrashEntryNotFound
+	}
+	destPath := entry.Path
+	if rt.DestPath != "" {
+		destPath = path.Clean("/" + rt.DestPath)
+	}
+	if err = c.MkdirAll(CreateDirInfo{DirPath: path.Dir(destPath), Shared: rt.Shared}); err != nil {
+		return nil, err
+	}
+	if file, dir, err := c.findEntry(destPath, rt.Shared); err != nil {
+		return nil, err
+	} else if file != nil || dir != nil {
+		return nil, fmt.Errorf("%v already exists", destPath)
+	}
+	entryDirPath := path.Join(TrashDirPath, entry.ID)
+	copyPath := path.Join(entryDirPath, entry.Path)
+	if entry.Dir {
+		var tree *DirTree
+		if tree, err = c.LoadDirTree(LoadDirTreeInfo{DirPath: copyPath, Shared: rt.Shared}); err == nil {
+			err = c.copyTree(tree, destPath, rt.Shared)
+		}
+	} else {
+		var file *FileInfo
+		if file, _, err = c.findEntry(copyPath, rt.Shared); err == nil && file == nil {
+			err = fmt.Errorf("Trash entry %v has no file", entry.ID)
+		} else if err == nil {
+			err = c.copyFile(copyPath, destPath, rt.Shared, file.Metadata)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to restore: %v", err)
+	}
+	if err = c.DeleteDirRecursive(DeleteDirRecursiveInfo{DirPath: entryDirPath, Shared: rt.Shared}); err != nil {
+		return nil, fmt.Errorf("Restored but unable to remove from trash: %v", err)
+	}
+	return entry, nil
+}
+
+// PurgeTrashInfo are parameters for Client.PurgeTrash
+type PurgeTrashInfo struct {
+	// Whether to purge the trash of the shared area
+	Shared bool
+	// Only entries trashed longer ago than this are purged. If 0, all are.
+	OlderThan time.Duration
+}
+
+// PurgeTrash permanently deletes trashed entries, giving the ones deleted. If one fails to delete, the ones deleted
+// before it are given with the error.
+func (c *Client) PurgeTrash(pt PurgeTrashInfo) ([]TrashEntry, error) {
+	entries, err := c.ListTrash(ListTrashInfo{Shared: pt.Shared})
+	if err != nil {
+		return nil, err
+	}
+	purged := []TrashEntry{}
+	cutoff := time.Now().Add(-pt.OlderThan)
+	for _, entry := range entries {
+		if !entry.Time.Before(cutoff) {
+			continue
+		}
+		err = c.DeleteDirRecursive(DeleteDirRecursiveInfo{DirPath: path.Join(TrashDirPath, entry.ID), Shared: pt.Shared})
+		if err != nil {
+			return purged, fmt.Errorf("Unable to purge %v: %v", entry.ID, err)
+		}
+		purged = append(purged, entry)
+	}
+	return purged, nil
+}
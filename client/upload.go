@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultUploadChunkSize is the number of bytes written per call by ResumableUpload when
+// ResumableUploadInfo.ChunkSize is 0
+const DefaultUploadChunkSize = 1024 * 1024
+
+// UploadJournal is the state of a resumable upload that is saved locally after every chunk
+type UploadJournal struct {
+	// The SAFE path being written
+	FilePath string `json:"filePath"`
+	// Whether the path is shared
+	Shared bool `json:"shared"`
+	// The hex SHA-256 of the source contents
+	SourceHash string `json:"sourceHash"`
+	// The size of the source contents
+	Size int64 `json:"size"`
+	// The size of each write
+	ChunkSize int64 `json:"chunkSize"`
+	// The offset up to which the contents have been confirmed written
+	Offset int64 `json:"offset"`
+}
+
+// ResumableUploadInfo are parameters for Client.ResumableUpload
+type ResumableUploadInfo struct {
+	// The path to write to. It must already exist.
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// The contents to write. Seeking is used to skip what was already written.
+	Contents io.ReadSeeker
+	// The local file to keep the UploadJournal in. It is removed once the upload completes.
+	JournalPath string
+	// The number of bytes to write per call. If 0, DefaultUploadChunkSize is used.
+	ChunkSize int64
+	// If not nil, this is called with the progress of the whole upload including what was already written
+	Progress ProgressFunc
+}
+
+// ResumableUpload writes the contents in chunks, recording each confirmed chunk in a journal at
+// ResumableUploadInfo.JournalPath. If the journal is from a previous attempt of the same upload with the same contents,
+// the upload continues where it left off. Before continuing, the file's size on SAFE is checked with GetDir so chunks
+// the journal claims but SAFE doesn't have are written again.
+func (c *Client) ResumableUpload(ru ResumableUploadInfo) error {
+	chunkSize := ru.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	size, err := ru.Contents.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("Unable to read contents: %v", err)
+	}
+	if _, err = ru.Contents.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Unable to read contents: %v", err)
+	}
+	sourceHash, err := hashReader(ru.Contents)
+	if err != nil {
+		return fmt.Errorf("Unable to read contents: %v", err)
+	}
+	journal := &UploadJournal{FilePath: ru.FilePath, Shared: ru.Shared, SourceHash: sourceHash, Size: size,
+		ChunkSize: chunkSize}
+	if journal.Offset, err = c.resumeOffset(ru.JournalPath, *journal); err != nil {
+		return err
+	}
+	// Save right away so a stale journal isn't left behind if the first chunk fails
+	if err = saveUploadJournal(ru.JournalPath, journal); err != nil {
+		return err
+	}
+	if _, err = ru.Contents.Seek(journal.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("Unable to read contents: %v", err)
+	}
+	start, startOffset := time.Now(), journal.Offset
+	buf := make([]byte, chunkSize)
+	for journal.Offset < size {
+		n, err := io.ReadFull(ru.Contents, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("Unable to read contents: %v", err)
+		}
+		info := WriteFileInfo{
+			FilePath: ru.FilePath,
+			Shared:   ru.Shared,
+			Contents: ioutil.NopCloser(bytes.NewReader(buf[:n])),
+			Offset:   journal.Offset,
+		}
+		if ru.Progress != nil {
+			offset := journal.Offset
+			info.Progress = func(p Progress) {
+				ru.Progress(uploadProgress(start, startOffset, offset+p.Transferred, size))
+			}
+		}
+		if err = c.WriteFile(info); err != nil {
+			return fmt.Errorf("Unable to write at offset %v: %v", journal.Offset, err)
+		}
+		journal.Offset += int64(n)
+		if err = saveUploadJournal(ru.JournalPath, journal); err != nil {
+			return err
+		}
+	}
+	if ru.Progress != nil {
+		progress := uploadProgress(start, startOffset, size, size)
+		progress.Done = true
+		ru.Progress(progress)
+	}
+	if err = os.Remove(ru.JournalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove journal: %v", err)
+	}
+	return nil
+}
+
+// resumeOffset gives the offset to continue from based on the journal at journalPath, or 0 if there isn't a matching
+// journal
+func (c *Client) resumeOffset(journalPath string, expected UploadJournal) (int64, error) {
+	byts, err := ioutil.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("Unable to read journal: %v", err)
+	}
+	var journal UploadJournal
+	if err = json.Unmarshal(byts, &journal); err != nil {
+		return 0, fmt.Errorf("Invalid journal at %v: %v", journalPath, err)
+	}
+	offset := journal.Offset
+	journal.Offset = 0
+	if journal != expected {
+		return 0, nil
+	}
+	// Only trust chunks that SAFE actually has
+	info, err := c.statFile(expected.FilePath, expected.Shared)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to check file size: %v", err)
+	}
+	if info.Size < offset {
+		offset = info.Size / expected.ChunkSize * expected.ChunkSize
+	}
+	return offset, nil
+}
+
+func saveUploadJournal(journalPath string, journal *UploadJournal) error {
+	if journalPath == "" {
+		return errors.New("Journal path required")
+	}
+	byts, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a partial journal
+	tmpPath := journalPath + ".tmp"
+	if err = os.MkdirAll(filepath.Dir(journalPath), 0700); err != nil {
+		return fmt.Errorf("Unable to create journal dir: %v", err)
+	}
+	if err = ioutil.WriteFile(tmpPath, byts, 0600); err != nil {
+		return fmt.Errorf("Unable to write journal: %v", err)
+	}
+	if err = os.Rename(tmpPath, journalPath); err != nil {
+		return fmt.Errorf("Unable to write journal: %v", err)
+	}
+	return nil
+}
+
+func uploadProgress(start time.Time, startOffset int64, transferred int64, total int64) Progress {
+	progress := Progress{Transferred: transferred, Total: total}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		progress.Rate = float64(transferred-startOffset) / elapsed
+	}
+	return progress
+}
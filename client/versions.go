@@ -0,0 +1,432 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The launcher keeps no history of versioned directories that can be read back, so it is kept by the client instead.
+// When Client.Versioning is set, any change made through the client to a file directly in a directory created as
+// versioned first saves the directory's files as they were into its .versions subdirectory. Each saved version is a
+// numbered JSON manifest there listing the files, with their contents in .versions/blobs named by their SHA-256 so
+// unchanged contents are only stored once. Hidden files, i.e. those whose names start with a dot, and anything in
+// hidden directories are never versioned. This keeps the history itself and the temp files of atomic writes out of
+// it. Lock files are never versioned either. Only changes that could lose something save a version first, so creating
+// files, changing only metadata and writing to empty files don't. Changes made by other clients or while Versioning is
+// off are only captured as part of the next saved version.
+
+const (
+	versionsDirName      = ".versions"
+	versionsBlobsDirName = "blobs"
+	versionsNameFormat   = "%010d.json"
+)
+
+// DirVersion is a saved prior version of a directory
+type DirVersion struct {
+	// The version number, starting at 1 for the oldest
+	Version int64
+	// When the version was saved, i.e. when the change after it was made
+	Time time.Time
+}
+
+type versionManifest struct {
+	Files []versionFile `json:"files"`
+}
+
+type versionFile struct {
+	FileInfo
+	Blob string `json:"blob"`
+}
+
+// ListVersionsInfo are parameters for Client.ListVersions
+type ListVersionsInfo struct {
+	// The path of the directory
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+}
+
+// ListVersions gives the saved prior versions of a directory, oldest first
+func (c *Client) ListVersions(lv ListVersionsInfo) ([]DirVersion, error) {
+	versionsPath := path.Join(lv.DirPath, versionsDirName)
+	c.invalidateCache(versionsPath, lv.Shared)
+	parent, err := c.GetDir(GetDirInfo{DirPath: lv.DirPath, Shared: lv.Shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read dir: %v", err)
+	} else if !hasVersionsDir(parent) {
+		return []DirVersion{}, nil
+	}
+	dir, err := c.GetDir(GetDirInfo{DirPath: versionsPath, Shared: lv.Shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list versions: %v", err)
+	}
+	versions := []DirVersion{}
+	for _, file := range dir.Files {
+		// Empty manifests are from saves that failed part way
+		if version, ok := parseVersionName(file.Name); ok && file.Size > 0 {
+			versions = append(versions, DirVersion{Version: version, Time: file.CreatedOn.Time()})
+		}
+	}
+	sort.Sort(dirVersions(versions))
+	return versions, nil
+}
+
+func hasVersionsDir(dir DirResponse) bool {
+	for _, subDir := range dir.SubDirs {
+		if subDir.Name == versionsDirName {
+			return true
+		}
+	}
+	return false
+}
+
+type dirVersions []DirVersion
+
+func (d dirVersions) Len() int           { return len(d) }
+func (d dirVersions) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d dirVersions) Less(i, j int) bool { return d[i].Version < d[j].Version }
+
+func parseVersionName(name string) (int64, bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+	return version, err == nil && version > 0
+}
+
+// GetDirAtVersionInfo are parameters for Client.GetDirAtVersion
+type GetDirAtVersionInfo struct {
+	// The path of the directory
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The version from Client.ListVersions
+	Version int64
+}
+
+// GetDirAtVersion gives a directory as it was at a saved version. Only files directly in the directory are versioned,
+// so SubDirs is always empty. Info is the directory as it is now.
+func (c *Client) GetDirAtVersion(gd GetDirAtVersionInfo) (DirResponse, error) {
+	dir, err := c.GetDir(GetDirInfo{DirPath: gd.DirPath, Shared: gd.Shared})
+	if err != nil {
+		return DirResponse{}, err
+	}
+	manifest, err := c.versionManifest(gd.DirPath, gd.Shared, gd.Version)
+	if err != nil {
+		return DirResponse{}, err
+	}
+	res := DirResponse{Info: dir.Info, Files: Files{}, SubDirs: Dirs{}}
+	for _, file := range manifest.Files {
+		res.Files = append(res.Files, file.FileInfo)
+	}
+	return res, nil
+}
+
+// GetFileAtVersionInfo are parameters for Client.GetFileAtVersion
+type GetFileAtVersionInfo struct {
+	// The path of the file
+	FilePath string
+	// Whether the path is shared
+	Shared bool
+	// The version of the file's directory from Client.ListVersions
+	Version int64
+	// If true and the file was compressed by WriteFile, the contents are decompressed
+	Decompress bool
+	// If not nil, this is called with the progress of the download
+	Progress ProgressFunc
+}
+
+// GetFileAtVersion obtains a file's contents as they were at a saved version of its directory
+func (c *Client) GetFileAtVersion(gf GetFileAtVersionInfo) (io.ReadCloser, error) {
+	dirPath := path.Dir(gf.FilePath)
+	manifest, err := c.versionManifest(dirPath, gf.Shared, gf.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range manifest.Files {
+		if file.Name != path.Base(gf.FilePath) {
+			continue
+		}
+		rc, err := c.GetFile(GetFileInfo{
+			FilePath: path.Join(dirPath, versionsDirName, versionsBlobsDirName, file.Blob),
+			Shared:   gf.Shared,
+			Progress: gf.Progress,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if compression := ParseMetadata(file.Metadata)[MetadataCompression]; gf.Decompress && compression != "" {
+			if compression != CompressionGzip {
+				rc.Close()
+				return nil, fmt.Errorf("Unsupported compression: %v", compression)
+			}
+			return decompressContents(rc, 0, 0)
+		}
+		return rc, nil
+	}
+	return nil, fmt.Errorf("File %v not in version %v", gf.FilePath, gf.Version)
+}
+
+func (c *Client) versionManifest(dirPath string, shared bool, version int64) (*versionManifest, error) {
+	rc, err := c.GetFile(GetFileInfo{
+		FilePath: path.Join(dirPath, versionsDirName, fmt.Sprintf(versionsNameFormat, version)),
+		Shared:   shared,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get version %v: %v", version, err)
+	}
+	defer rc.Close()
+	manifest := &versionManifest{}
+	if err = json.NewDecoder(rc).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("Unable to read version %v: %v", version, err)
+	}
+	return manifest, nil
+}
+
+// SaveVersionInfo are parameters for Client.SaveVersion
+type SaveVersionInfo struct {
+	// The path of the directory
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+}
+
+// SaveVersion saves the files of a directory as a new version unless they are unchanged since the last one. This is
+// done automatically before changes to versioned directories when Client.Versioning is set, but it can be used on any
+// directory.
+func (c *Client) SaveVersion(sv SaveVersionInfo) error {
+	c.invalidateCache(sv.DirPath, sv.Shared)
+	dir, err := c.GetDir(GetDirInfo{DirPath: sv.DirPath, Shared: sv.Shared})
+	if err != nil {
+		return fmt.Errorf("Unable to read dir: %v", err)
+	}
+	return c.saveVersion(sv.DirPath, sv.Shared, dir)
+}
+
+// versionBeforeChange saves the version of the file's directory before it is changed if it should be. If overwrite is
+// true, the change is to the file's contents and nothing is saved if the file is empty.
+func (c *Client) versionBeforeChange(filePath string, shared bool, overwrite bool) error {
+	if !c.Versioning {
+		return nil
+	}
+	for _, name := range strings.Split(filePath, "/") {
+		if strings.HasPrefix(name, ".") {
+			return nil
+		}
+	}
+	dirPath := path.Dir(filePath)
+	if versioned, known := c.versioned.get(dirPath, shared); known && !versioned {
+		return nil
+	}
+	dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: shared})
+	// If the directory can't be read, the change itself will fail
+	if err != nil {
+		return nil
+	}
+	c.versioned.set(dirPath, shared, dir.Info.Versioned)
+	if !dir.Info.Versioned {
+		return nil
+	}
+	for _, file := range dir.Files {
+		if file.Name == path.Base(filePath) {
+			if isLockFile(file) || (overwrite && file.Size == 0) {
+				return nil
+			}
+			break
+		}
+	}
+	if err = c.saveVersion(dirPath, shared, dir); err != nil {
+		return fmt.Errorf("Unable to save version of %v: %v", dirPath, err)
+	}
+	return nil
+}
+
+// versionedDirs remembers which directories are versioned, which can't change, to save a call on every change. A nil
+// versionedDirs remembers nothing.
+type versionedDirs struct {
+	lock sync.Mutex
+	dirs map[string]bool
+}
+
+func versionedKey(dirPath string, shared bool) string {
+	return strconv.FormatBool(shared) + ":" + path.Clean("/"+dirPath)
+}
+
+func (v *versionedDirs) get(dirPath string, shared bool) (versioned bool, known bool) {
+	if v == nil {
+		return false, false
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	versioned, known = v.dirs[versionedKey(dirPath, shared)]
+	return
+}
+
+func (v *versionedDirs) set(dirPath string, shared bool, versioned bool) {
+	if v == nil {
+		return
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.dirs[versionedKey(dirPath, shared)] = versioned
+}
+
+// forget forgets whether the directory is versioned for when it is created again
+func (v *versionedDirs) forget(dirPath string, shared bool) {
+	if v == nil {
+		return
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.dirs, versionedKey(dirPath, shared))
+}
+
+func (c *Client) saveVersion(dirPath string, shared bool, dir DirResponse) error {
+	versionsPath := path.Join(dirPath, versionsDirName)
+	blobsPath := path.Join(versionsPath, versionsBlobsDirName)
+	if !hasVersionsDir(dir) {
+		if err := c.MkdirAll(CreateDirInfo{DirPath: blobsPath, Shared: shared, Private: dir.Info.Private}); err != nil {
+			return err
+		}
+	}
+	versions, err := c.ListVersions(ListVersionsInfo{DirPath: dirPath, Shared: shared})
+	if err != nil {
+		return err
+	}
+	var latestVersion int64
+	latest := &versionManifest{}
+	if len(versions) > 0 {
+		latestVersion = versions[len(versions)-1].Version
+		if latest, err = c.versionManifest(dirPath, shared, latestVersion); err != nil {
+			return err
+		}
+	}
+	previous := map[string]versionFile{}
+	for _, file := range latest.Files {
+		previous[file.Name] = file
+	}
+	blobsDir, err := c.GetDir(GetDirInfo{DirPath: blobsPath, Shared: shared})
+	if err != nil {
+		return err
+	}
+	blobs := map[string]bool{}
+	for _, file := range blobsDir.Files {
+		// Empty blobs other than for empty contents are from saves that failed part way
+		blobs[file.Name] = file.Size > 0
+	}
+
+	// Build the manifest, only reading files that changed since the latest version
+	manifest := &versionManifest{Files: []versionFile{}}
+	changed := false
+	for _, file := range dir.Files {
+		if strings.HasPrefix(file.Name, ".") || isLockFile(file) {
+			continue
+		}
+		if prev, ok := previous[file.Name]; ok && prev.FileInfo == file {
+			manifest.Files = append(manifest.Files, prev)
+			continue
+		}
+		changed = true
+		blob, err := c.saveBlob(path.Join(dirPath, file.Name), shared, blobsPath, blobs)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, versionFile{FileInfo: file, Blob: blob})
+	}
+	if !changed && len(manifest.Files) == len(latest.Files) && len(versions) > 0 {
+		return nil
+	}
+	byts, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	// Creating fails if someone else just saved a version with the same number, so take the next one. Any number of
+	// versions may be saved at once, e.g. when files are deleted concurrently, so this only stops on other failures.
+	for version := latestVersion + 1; ; version++ {
+		manifestPath := path.Join(versionsPath, fmt.Sprintf(versionsNameFormat, version))
+		if err = c.CreateFile(CreateFileInfo{FilePath: manifestPath, Shared: shared}); err != nil {
+			if exists, existsErr := c.versionFileExists(versionsPath, path.Base(manifestPath), shared); existsErr != nil {
+				return existsErr
+			} else if !exists {
+				return fmt.Errorf("Unable to create version: %v", err)
+			}
+			continue
+		}
+		return c.WriteFile(WriteFileInfo{
+			FilePath: manifestPath,
+			Shared:   shared,
+			Contents: ioutil.NopCloser(bytes.NewReader(byts)),
+		})
+	}
+}
+
+// saveBlob stores the file's contents as they are in the blobs directory if not already there
+func (c *Client) saveBlob(filePath string, shared bool, blobsPath string, blobs map[string]bool) (string, error) {
+	rc, err := c.GetFile(GetFileInfo{FilePath: filePath, Shared: shared})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	byts, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read file: %v", err)
+	}
+	hash := sha256.Sum256(byts)
+	blob := hex.EncodeToString(hash[:])
+	complete, hasBlob := blobs[blob]
+	if complete || (len(byts) == 0 && hasBlob) {
+		return blob, nil
+	}
+	blobPath := path.Join(blobsPath, blob)
+	if hasBlob {
+		if err = c.DeleteFile(DeleteFileInfo{FilePath: blobPath, Shared: shared}); err != nil {
+			return "", fmt.Errorf("Unable to delete partial blob: %v", err)
+		}
+	}
+	if err = c.CreateFile(CreateFileInfo{FilePath: blobPath, Shared: shared}); err != nil {
+		// Someone else saving a version may have just stored the same contents
+		if exists, existsErr := c.versionFileExists(blobsPath, blob, shared); existsErr != nil {
+			return "", existsErr
+		} else if !exists {
+			return "", fmt.Errorf("Unable to create blob: %v", err)
+		}
+		blobs[blob] = true
+		return blob, nil
+	}
+	if len(byts) > 0 {
+		contents := ioutil.NopCloser(bytes.NewReader(byts))
+		if err = c.WriteFile(WriteFileInfo{FilePath: blobPath, Shared: shared, Contents: contents}); err != nil {
+			c.DeleteFile(DeleteFileInfo{FilePath: blobPath, Shared: shared})
+			return "", fmt.Errorf("Unable to write blob: %v", err)
+		}
+	}
+	blobs[blob] = true
+	return blob, nil
+}
+
+// versionFileExists is whether the named manifest or blob is in the directory, which is read fresh
+func (c *Client) versionFileExists(dirPath string, name string, shared bool) (bool, error) {
+	c.invalidateCache(dirPath, shared)
+	dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: shared})
+	if err != nil {
+		return false, fmt.Errorf("Unable to read dir: %v", err)
+	}
+	for _, file := range dir.Files {
+		if file.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"errors"
+	"path"
+	"sort"
+)
+
+// WalkFunc is called by Client.Walk for each directory and file visited. Exactly one of dir and file is set on a normal
+// visit. If a directory listing could not be obtained, it is called again for that directory with only err set and
+// the returned error is handled the same way.
+type WalkFunc func(entryPath string, dir *DirInfo, file *FileInfo, err error) error
+
+// SkipDir can be returned from a WalkFunc to skip the contents of the directory being visited. When returned while
+// visiting a file, the remaining entries in that file's directory are skipped.
+var SkipDir = errors.New("Skip this directory")
+
+// WalkInfo are parameters for Client.Walk
+type WalkInfo struct {
+	// The directory to start at
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+}
+
+// Walk visits the directory at WalkInfo.DirPath and everything under it, calling fn for each entry. Entries in a
+// directory are visited in name order with files before sub directories. A non-nil error other than SkipDir from fn
+// stops the walk and is returned.
+func (c *Client) Walk(wi WalkInfo, fn WalkFunc) error {
+	dirPath := path.Clean("/" + wi.DirPath)
+	dir, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: wi.Shared})
+	if err != nil {
+		err = fn(dirPath, nil, nil, err)
+	} else {
+		err = c.walkDir(dirPath, wi.Shared, dir.Info, &dir, fn)
+	}
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) walkDir(dirPath string, shared bool, info DirInfo, dir *DirResponse, fn WalkFunc) error {
+	if err := fn(dirPath, &info, nil, nil); err != nil {
+		return err
+	}
+	// We wait until after visiting to get the listing so skipped directories don't cost a call
+	if dir == nil {
+		listing, err := c.GetDir(GetDirInfo{DirPath: dirPath, Shared: shared})
+		if err != nil {
+			return fn(dirPath, nil, nil, err)
+		}
+		dir = &listing
+	}
+	sort.Sort(dir.Files)
+	for i := range dir.Files {
+		if err := fn(path.Join(dirPath, dir.Files[i].Name), nil, &dir.Files[i], nil); err == SkipDir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	sort.Sort(dir.SubDirs)
+	for _, sub := range dir.SubDirs {
+		if err := c.walkDir(path.Join(dirPath, sub.Name), shared, sub, nil, fn); err != nil && err != SkipDir {
+			return err
+		}
+	}
+	return nil
+}
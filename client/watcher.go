@@ -0,0 +1,213 @@
+package client
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher polls when WatcherInfo.Interval is 0
+const DefaultWatchInterval = 10 * time.Second
+
+// WatchEventType is the kind of change in a WatchEvent
+type WatchEventType string
+
+const (
+	// WatchCreated is a file or directory that didn't exist at the last poll
+	WatchCreated WatchEventType = "created"
+	// WatchModified is a file whose contents changed
+	WatchModified WatchEventType = "modified"
+	// WatchDeleted is a file or directory that existed at the last poll
+	WatchDeleted WatchEventType = "deleted"
+	// WatchMetadataChanged is a file or directory whose metadata changed
+	WatchMetadataChanged WatchEventType = "metadataChanged"
+)
+
+// WatchEvent is a single change seen by a Watcher
+type WatchEvent struct {
+	// The kind of change
+	Type WatchEventType
+	// The full path of the file or directory
+	Path string
+	// Whether this is a directory
+	Dir bool
+	// The entry at the last poll. This is nil for WatchCreated.
+	Old *SnapshotEntry
+	// The entry now. This is nil for WatchDeleted.
+	New *SnapshotEntry
+}
+
+// WatcherInfo are parameters for Client.NewWatcher
+type WatcherInfo struct {
+	// The directories to watch
+	DirPaths []string
+	// Whether the directories are shared
+	Shared bool
+	// How often to poll. If 0, DefaultWatchInterval is used.
+	Interval time.Duration
+	// How many levels of sub directories to watch the contents of. 0 means no limit.
+	MaxDepth int
+	// The maximum number of GetDir calls to make at once when polling. If 0, DefaultTreeConcurrency is used.
+	Concurrency int
+}
+
+// Watcher polls directories and reports changes between polls. Create with Client.NewWatcher.
+type Watcher struct {
+	// Changes are sent here in path order for each poll. It is closed once the watcher is closed. Polling waits on
+	// this channel, so it must be read.
+	Events <-chan WatchEvent
+	// Polls that fail are sent here and no events are reported for them. It is closed once the watcher is closed.
+	// Polling waits on this channel too, so it must be read.
+	Errors <-chan error
+
+	c         *Client
+	wi        WatcherInfo
+	events    chan WatchEvent
+	errors    chan error
+	last      Snapshot
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatcher polls the directories once to have something to compare to and then starts polling every
+// WatcherInfo.Interval in the background. The first poll must succeed. Changes in a directory's contents are reported
+// as events on the entries in it, not as WatchModified on the directory itself.
+func (c *Client) NewWatcher(wi WatcherInfo) (*Watcher, error) {
+	if len(wi.DirPaths) == 0 {
+		return nil, errors.New("At least one directory required")
+	}
+	if wi.Interval <= 0 {
+		wi.Interval = DefaultWatchInterval
+	}
+	events, errs := make(chan WatchEvent), make(chan error)
+	w := &Watcher{
+		Events:  events,
+		Errors:  errs,
+		c:       c,
+		wi:      wi,
+		events:  events,
+		errors:  errs,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var err error
+	if w.last, err = w.snapshot(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops polling and waits for the background goroutine to finish
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.closing) })
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.errors)
+	defer close(w.events)
+	ticker := time.NewTicker(w.wi.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closing:
+			return
+		case <-ticker.C:
+		}
+		snap, err := w.snapshot()
+		if err != nil {
+			select {
+			case w.errors <- err:
+				continue
+			case <-w.closing:
+				return
+			}
+		}
+		for _, event := range watchEvents(w.last, snap) {
+			select {
+			case w.events <- event:
+			case <-w.closing:
+				return
+			}
+		}
+		w.last = snap
+	}
+}
+
+// snapshot loads all watched directories into a single snapshot keyed by full path
+func (w *Watcher) snapshot() (Snapshot, error) {
+	snap := Snapshot{}
+	for _, dirPath := range w.wi.DirPaths {
+		tree, err := w.c.LoadDirTree(LoadDirTreeInfo{
+			DirPath:     dirPath,
+			Shared:      w.wi.Shared,
+			MaxDepth:    w.wi.MaxDepth,
+			Concurrency: w.wi.Concurrency,
+		})
+		if err != nil {
+			return nil, err
+		}
+		addTreeToSnapshot(snap, tree)
+	}
+	return snap, nil
+}
+
+func addTreeToSnapshot(snap Snapshot, tree *DirTree) {
+	for _, file := range tree.Files {
+		filePath := path.Join(tree.Path, file.Name)
+		snap[filePath] = fileSnapshotEntry(filePath, file)
+	}
+	for _, sub := range tree.SubDirs {
+		snap[sub.Path] = dirSnapshotEntry(sub.Path, sub.Info)
+		addTreeToSnapshot(snap, sub)
+	}
+}
+
+// watchEvents gives the events between two snapshots in path order. An entry that changed between file and directory
+// is reported as deleted and created. A file whose metadata changed is only also reported as modified if its size
+// changed.
+func watchEvents(a, b Snapshot) []WatchEvent {
+	events := []WatchEvent{}
+	for entryPath, aEntry := range a {
+		aEntry := aEntry
+		bEntry, ok := b[entryPath]
+		if !ok || aEntry.Dir != bEntry.Dir {
+			events = append(events, WatchEvent{Type: WatchDeleted, Path: entryPath, Dir: aEntry.Dir, Old: &aEntry})
+			if ok {
+				events = append(events, WatchEvent{Type: WatchCreated, Path: entryPath, Dir: bEntry.Dir, New: &bEntry})
+			}
+			continue
+		}
+		// Metadata changes update the modification time too, so only size says the contents changed with it
+		metadataChanged := aEntry.Metadata != bEntry.Metadata
+		timeChanged := !aEntry.ModifiedOn.Equal(bEntry.ModifiedOn)
+		if !aEntry.Dir && (aEntry.Size != bEntry.Size || (timeChanged && !metadataChanged)) {
+			events = append(events, WatchEvent{Type: WatchModified, Path: entryPath, Old: &aEntry, New: &bEntry})
+		}
+		if metadataChanged {
+			events = append(events, WatchEvent{Type: WatchMetadataChanged, Path: entryPath, Dir: aEntry.Dir,
+				Old: &aEntry, New: &bEntry})
+		}
+	}
+	for entryPath, bEntry := range b {
+		bEntry := bEntry
+		if _, ok := a[entryPath]; !ok {
+			events = append(events, WatchEvent{Type: WatchCreated, Path: entryPath, Dir: bEntry.Dir, New: &bEntry})
+		}
+	}
+	// Stable so deleted stays before created for the same path
+	sort.Stable(watchEventsByPath(events))
+	return events
+}
+
+type watchEventsByPath []WatchEvent
+
+func (w watchEventsByPath) Len() int           { return len(w) }
+func (w watchEventsByPath) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w watchEventsByPath) Less(i, j int) bool { return w[i].Path < w[j].Path }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var backupShared bool
+var backupProgress bool
+
+var backupCmd = &cobra.Command{
+	Use:   "backup [local dir] [dir]",
+	Short: "Back up local directory as a new snapshot",
+	Long: `Back up local directory as a new snapshot in dir, which is created if it doesn't exist.
+
+Files are split into chunks by their contents and only chunks that aren't already in dir from earlier snapshots are
+uploaded. Use restore to get a snapshot back, snapshots to list them and prune to remove old ones.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Exactly two arguments required for local directory and directory")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		info := client.BackupInfo{LocalDir: args[0], DirPath: args[1], Shared: backupShared}
+		if backupProgress {
+			info.Progress = newProgressFunc(args[0])
+		}
+		snapshot, err := c.Backup(info)
+		if err != nil {
+			log.Fatalf("Failed to back up: %v", err)
+		}
+		fmt.Printf("Created snapshot %v\n", snapshot.ID)
+		return nil
+	},
+}
+
+func init() {
+	backupCmd.Flags().BoolVarP(&backupShared, "shared", "s", false, "Use shared area for user/app")
+	backupCmd.Flags().BoolVar(&backupProgress, "progress", false, "Show upload progress on stderr")
+	RootCmd.AddCommand(backupCmd)
+}
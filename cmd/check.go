@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var checkShared bool
+var checkReadData bool
+
+var checkCmd = &cobra.Command{
+	Use:   "check [dir]",
+	Short: "Check backup snapshots for missing or corrupt chunks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		err = c.CheckBackup(client.CheckBackupInfo{DirPath: args[0], Shared: checkShared, ReadData: checkReadData})
+		if checkErr, ok := err.(*client.CheckBackupError); ok {
+			for _, problem := range checkErr.Problems {
+				fmt.Println(problem)
+			}
+			log.Fatalf("Found %v problems", len(checkErr.Problems))
+		} else if err != nil {
+			log.Fatalf("Failed to check backup: %v", err)
+		}
+		fmt.Println("No problems found")
+		return nil
+	},
+}
+
+func init() {
+	checkCmd.Flags().BoolVarP(&checkShared, "shared", "s", false, "Use shared area for user/app")
+	checkCmd.Flags().BoolVar(&checkReadData, "read-data", false, "Download every chunk to check its contents")
+	RootCmd.AddCommand(checkCmd)
+}
@@ -11,12 +11,12 @@ var cpShared bool
 var cpDestChangeShared bool
 
 var cpCmd = &cobra.Command{
-	Use: "cp [src file] [dest dir]",
+	Use: "cp [src file...] [dest dir]",
 	// TODO: https://maidsafe.atlassian.net/browse/CS-60
 	Short: "Copy file [NOT YET WORKING]",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 2 {
-			return errors.New("Exactly two arguments required for source and destination")
+		if len(args) < 2 {
+			return errors.New("At least two arguments required for source and destination")
 		}
 		c, err := getClient()
 		if err != nil {
@@ -26,15 +26,21 @@ var cpCmd = &cobra.Command{
 		if cpDestChangeShared {
 			destShared = !cpShared
 		}
-		info := client.MoveFileInfo{
-			SrcPath:      args[0],
-			SrcShared:    cpShared,
-			DestPath:     args[1],
-			DestShared:   destShared,
-			RetainSource: true,
+		srcPaths, err := c.GlobAll(args[:len(args)-1], cpShared)
+		if err != nil {
+			log.Fatalf("Failed to expand paths: %v", err)
 		}
-		if err = c.MoveFile(info); err != nil {
-			log.Fatalf("Failed to copy file: %v", err)
+		for _, srcPath := range srcPaths {
+			info := client.MoveFileInfo{
+				SrcPath:      srcPath,
+				SrcShared:    cpShared,
+				DestPath:     args[len(args)-1],
+				DestShared:   destShared,
+				RetainSource: true,
+			}
+			if err = c.MoveFile(info); err != nil {
+				log.Fatalf("Failed to copy file %v: %v", srcPath, err)
+			}
 		}
 		return nil
 	},
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+	"strings"
+)
+
+var diffHash bool
+var diffJSON bool
+var diffIgnoreTimes bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [a] [b]",
+	Short: "Compare two directory trees",
+	Long: `Compare two directory trees and print what was added, removed, or changed going from a to b.
+
+Each side can be a SAFE path, a shared SAFE path prefixed with "shared:", a local path prefixed with "local:", or a
+DNS service home directory in the form "dns://name/service".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Exactly two arguments required for the trees to compare")
+		}
+		var c *client.Client
+		snaps := make([]client.Snapshot, 2)
+		for i, arg := range args {
+			// Only get a client if a side needs one
+			if c == nil && !strings.HasPrefix(arg, "local:") {
+				var err error
+				if c, err = getClient(); err != nil {
+					log.Fatalf("Unable to obtain client: %v", err)
+				}
+			}
+			snap, err := diffSnapshot(c, arg)
+			if err != nil {
+				log.Fatalf("Unable to read %v: %v", arg, err)
+			}
+			snaps[i] = snap
+		}
+		diffs := client.DiffSnapshots(snaps[0], snaps[1], client.DiffOptions{IgnoreModTime: diffIgnoreTimes})
+		if diffJSON {
+			byts, err := json.MarshalIndent(diffs, "", "  ")
+			if err != nil {
+				log.Fatalf("Unable to write JSON: %v", err)
+			}
+			fmt.Println(string(byts))
+			return nil
+		}
+		for _, diff := range diffs {
+			switch diff.Change {
+			case client.DiffAdded:
+				fmt.Printf("+ %v\n", diffDisplayPath(diff.Path, diff.B))
+			case client.DiffRemoved:
+				fmt.Printf("- %v\n", diffDisplayPath(diff.Path, diff.A))
+			default:
+				fmt.Printf("~ %v (%v)\n", diffDisplayPath(diff.Path, diff.B), strings.Join(diff.Reasons, ", "))
+			}
+		}
+		return nil
+	},
+}
+
+func diffSnapshot(c *client.Client, arg string) (client.Snapshot, error) {
+	switch {
+	case strings.HasPrefix(arg, "local:"):
+		return client.LocalSnapshot(strings.TrimPrefix(arg, "local:"), diffHash)
+	case strings.HasPrefix(arg, "shared:"):
+		return c.Snapshot(client.SnapshotInfo{DirPath: strings.TrimPrefix(arg, "shared:"), Shared: true, Hash: diffHash})
+	case strings.HasPrefix(arg, "dns://"):
+		pieces := strings.Split(strings.Trim(strings.TrimPrefix(arg, "dns://"), "/"), "/")
+		if len(pieces) != 2 {
+			return nil, errors.New("DNS paths must be in the form dns://name/service")
+		}
+		return c.DNSSnapshot(client.DNSSnapshotInfo{Name: pieces[0], Service: pieces[1], Hash: diffHash})
+	default:
+		return c.Snapshot(client.SnapshotInfo{DirPath: arg, Hash: diffHash})
+	}
+}
+
+func diffDisplayPath(entryPath string, entry *client.SnapshotEntry) string {
+	if entry != nil && entry.Dir {
+		return entryPath + "/"
+	}
+	return entryPath
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffHash, "hash", false, "Compare content hashes (downloads every file)")
+	diffCmd.Flags().BoolVar(&diffJSON, "json", false, "Output JSON instead of text")
+	diffCmd.Flags().BoolVar(&diffIgnoreTimes, "ignore-times", false, "Do not compare modification times")
+	RootCmd.AddCommand(diffCmd)
+}
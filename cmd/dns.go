@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"strings"
+)
+
+var dnsFile string
+var dnsPrune bool
+var dnsYes bool
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Plan and apply DNS names and services from a sites file",
+	Long: `Make the account's DNS names and services match a sites file, which looks like:
+
+    names:
+      mysite:
+        www:
+          home: /mysitedir
+        git:
+          home: /repos
+          shared: true
+
+"dns plan" shows what would change and "dns apply" changes it. Names and services not in the file are left alone
+unless --prune is given. The launcher doesn't say which directory a service's home is, so a service is replaced when
+its home directory differs in name or creation time from the one in the file.`,
+}
+
+var dnsPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show changes needed to match the sites file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		_, plan := dnsLoadPlan()
+		dnsPrintPlan(plan)
+		return nil
+	},
+}
+
+var dnsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Change DNS names and services to match the sites file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		c, plan := dnsLoadPlan()
+		dnsPrintPlan(plan)
+		if len(plan.Changes) == 0 || (!dnsYes && !confirm(fmt.Sprintf("Make %v changes?", len(plan.Changes)))) {
+			return nil
+		}
+		if err := c.ApplyDNS(plan); err != nil {
+			log.Fatalf("Failed to apply: %v", err)
+		}
+		fmt.Printf("Made %v changes\n", len(plan.Changes))
+		return nil
+	},
+}
+
+// dnsSites is the format of the sites file
+type dnsSites struct {
+	Names map[string]map[string]dnsSiteService `yaml:"names"`
+}
+
+type dnsSiteService struct {
+	Home   string `yaml:"home"`
+	Shared bool   `yaml:"shared"`
+}
+
+func dnsLoadPlan() (*client.Client, *client.DNSPlan) {
+	f, err := os.Open(dnsFile)
+	if err != nil {
+		log.Fatalf("Unable to open sites file: %v", err)
+	}
+	defer f.Close()
+	var sites dnsSites
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&sites); err != nil {
+		log.Fatalf("Unable to read sites file: %v", err)
+	}
+	info := client.PlanDNSInfo{Names: map[string]map[string]client.DNSService{}, Prune: dnsPrune}
+	for name, services := range sites.Names {
+		info.Names[name] = map[string]client.DNSService{}
+		for serviceName, service := range services {
+			if service.Home == "" {
+				log.Fatalf("Service %v.%v has no home", serviceName, name)
+			}
+			info.Names[name][serviceName] = client.DNSService{HomeDirPath: service.Home, Shared: service.Shared}
+		}
+	}
+	c, err := getClient()
+	if err != nil {
+		log.Fatalf("Unable to obtain client: %v", err)
+	}
+	plan, err := c.PlanDNS(info)
+	if err != nil {
+		log.Fatalf("Failed to plan: %v", err)
+	}
+	return c, plan
+}
+
+func dnsPrintPlan(plan *client.DNSPlan) {
+	for _, change := range plan.Changes {
+		fmt.Println(change)
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes")
+	}
+	if len(plan.Unmanaged) > 0 {
+		fmt.Printf("Not in the sites file, use --prune to delete: %v\n", strings.Join(plan.Unmanaged, ", "))
+	}
+}
+
+func init() {
+	dnsCmd.PersistentFlags().StringVarP(&dnsFile, "file", "f", "safe-sites.yaml", "Sites file")
+	dnsCmd.PersistentFlags().BoolVar(&dnsPrune, "prune", false, "Delete names and services not in the sites file")
+	dnsApplyCmd.Flags().BoolVarP(&dnsYes, "yes", "y", false, "Do not ask before making changes")
+	dnsCmd.AddCommand(dnsPlanCmd, dnsApplyCmd)
+	RootCmd.AddCommand(dnsCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var duShared bool
+var duMaxDepth int
+var duHuman bool
+var duStored bool
+
+var duCmd = &cobra.Command{
+	Use:   "du [dir]",
+	Short: "Show total size of each directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		// Totals need everything loaded regardless of how deep we show
+		tree, err := c.LoadDirTree(client.LoadDirTreeInfo{DirPath: args[0], Shared: duShared})
+		if err != nil {
+			log.Fatalf("Failed to load dir: %v", err)
+		}
+		writeDu(tree, 0)
+		return nil
+	},
+}
+
+func writeDu(tree *client.DirTree, depth int) {
+	// Like du, children come before their parent
+	if duMaxDepth < 0 || depth < duMaxDepth {
+		for _, sub := range tree.SubDirs {
+			writeDu(sub, depth+1)
+		}
+	}
+	size := tree.Size()
+	if duStored {
+		size = tree.StoredSize()
+	}
+	fmt.Printf("%v\t%v\n", formatSize(size, duHuman), tree.Path)
+}
+
+func init() {
+	duCmd.Flags().BoolVarP(&duShared, "shared", "s", false, "Use shared area for user/app")
+	duCmd.Flags().IntVarP(&duMaxDepth, "max-depth", "d", -1, "Only show directories this many levels deep (-1 for no limit)")
+	duCmd.Flags().BoolVar(&duHuman, "human", false, "Show sizes in human readable units")
+	duCmd.Flags().BoolVar(&duStored, "stored", false, "Show stored sizes instead of logical sizes of compressed files")
+	RootCmd.AddCommand(duCmd)
+}
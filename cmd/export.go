@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+var exportShared bool
+var exportToFile string
+var exportFormat string
+var exportProgress bool
+
+var exportCmd = &cobra.Command{
+	Use:   "export [dir]",
+	Short: "Export directory tree to a tar or zip archive",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		format, err := archiveFormat(exportFormat, exportToFile)
+		if err != nil {
+			return err
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		outFile := os.Stdout
+		if exportToFile != "" {
+			if outFile, err = os.Create(exportToFile); err != nil {
+				log.Fatalf("Unable to create output file: %v", err)
+			}
+			defer outFile.Close()
+		}
+		info := client.ExportInfo{DirPath: args[0], Shared: exportShared}
+		if exportProgress {
+			info.Progress = newProgressFunc(args[0])
+		}
+		if format == "zip" {
+			err = c.ExportZip(outFile, info)
+		} else {
+			err = c.ExportTar(outFile, info)
+		}
+		if err != nil {
+			log.Fatalf("Failed to export dir: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().BoolVarP(&exportShared, "shared", "s", false, "Use shared area for user/app")
+	exportCmd.Flags().StringVarP(&exportToFile, "file", "f", "", "Write to file instead of stdout")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "Archive format, tar or zip (default based on file extension or tar)")
+	exportCmd.Flags().BoolVar(&exportProgress, "progress", false, "Show download progress on stderr")
+	RootCmd.AddCommand(exportCmd)
+}
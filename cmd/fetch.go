@@ -7,53 +7,100 @@ import (
 	"io"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 )
 
 var fetchShared bool
 var fetchToFile string
 var fetchOffset int64
 var fetchLength int64
+var fetchRaw bool
+var fetchProgress bool
+var fetchVersion int64
 
 var fetchCmd = &cobra.Command{
-	Use:   "fetch [file path]",
+	Use:   "fetch [file path...]",
 	Short: "Fetch file contents",
+	Long: `Fetch file contents to stdout or to a local file. When multiple files are given, their contents are written to
+stdout one after another or, if --file is given, --file must be a local directory to write each file into.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("One and only one argument allowed")
+		if len(args) == 0 {
+			return errors.New("At least one argument required")
+		} else if fetchVersion != 0 && (fetchOffset != 0 || fetchLength != 0) {
+			return errors.New("Can't fetch a version with an offset or length")
 		}
 		c, err := getClient()
 		if err != nil {
 			log.Fatalf("Unable to obtain client: %v", err)
 		}
-		info := client.GetFileInfo{
-			FilePath: args[0],
-			Shared:   fetchShared,
-			Offset:   fetchOffset,
-			Length:   fetchLength,
-		}
-		rc, err := c.GetFile(info)
+		paths, err := c.GlobAll(args, fetchShared)
 		if err != nil {
-			log.Fatalf("Failed to read file: %v", err)
+			log.Fatalf("Failed to expand paths: %v", err)
 		}
-		defer rc.Close()
-		outFile := os.Stdout
-		if fetchToFile != "" {
-			if outFile, err = os.Create(fetchToFile); err != nil {
-				log.Fatalf("Unable to create output file: %v", err)
+		if len(paths) > 1 && fetchToFile != "" {
+			if stat, err := os.Stat(fetchToFile); err != nil || !stat.IsDir() {
+				log.Fatalf("Output must be an existing directory when fetching multiple files")
 			}
-			defer outFile.Close()
 		}
-		if _, err = io.Copy(outFile, rc); err != nil {
-			log.Fatalf("Unable to write to stdout: %v", err)
+		for _, filePath := range paths {
+			info := client.GetFileInfo{
+				FilePath:   filePath,
+				Shared:     fetchShared,
+				Offset:     fetchOffset,
+				Length:     fetchLength,
+				Decompress: !fetchRaw,
+			}
+			if fetchProgress {
+				info.Progress = newProgressFunc(filePath)
+			}
+			switch {
+			case fetchToFile == "":
+				err = fetchToWriter(c, info, fetchVersion, os.Stdout)
+			case len(paths) > 1:
+				err = fetchToLocalFile(c, info, fetchVersion, filepath.Join(fetchToFile, path.Base(filePath)))
+			default:
+				err = fetchToLocalFile(c, info, fetchVersion, fetchToFile)
+			}
+			if err != nil {
+				log.Fatalf("Failed to fetch file %v: %v", filePath, err)
+			}
 		}
 		return nil
 	},
 }
 
+func fetchToWriter(c *client.Client, info client.GetFileInfo, version int64, w io.Writer) error {
+	rc, err := fetchFile(c, info, version)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// fetchFile gets the file or, if the version isn't 0, the file at that version
+func fetchFile(c *client.Client, info client.GetFileInfo, version int64) (io.ReadCloser, error) {
+	if version == 0 {
+		return c.GetFile(info)
+	}
+	return c.GetFileAtVersion(client.GetFileAtVersionInfo{
+		FilePath:   info.FilePath,
+		Shared:     info.Shared,
+		Version:    version,
+		Decompress: info.Decompress,
+		Progress:   info.Progress,
+	})
+}
+
 func init() {
 	fetchCmd.Flags().BoolVarP(&fetchShared, "shared", "s", false, "Use shared area for user/app")
-	fetchCmd.Flags().StringVarP(&fetchToFile, "file", "f", "", "Write to file instead of stdout")
+	fetchCmd.Flags().StringVarP(&fetchToFile, "file", "f", "", "Write to file (or directory for multiple files) instead of stdout")
 	fetchCmd.Flags().Int64VarP(&fetchOffset, "offset", "o", 0, "Offset to start writing from")
 	fetchCmd.Flags().Int64VarP(&fetchLength, "length", "l", 0, "Amount of bytes to read")
+	fetchCmd.Flags().BoolVar(&fetchRaw, "raw", false, "Do not decompress compressed files")
+	fetchCmd.Flags().BoolVar(&fetchProgress, "progress", false, "Show download progress on stderr")
+	fetchCmd.Flags().Int64Var(&fetchVersion, "version", 0, "Fetch the file as it was in this version of its directory")
 	RootCmd.AddCommand(fetchCmd)
 }
@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var findShared bool
+var findName string
+var findType string
+var findSize string
+var findNewer string
+var findMetadata string
+var findPrivate bool
+var findVersioned bool
+var findDelete bool
+var findFetchTo string
+
+var findCmd = &cobra.Command{
+	Use:   "find [dir]",
+	Short: "Find files and directories matching predicates",
+	Long: `Recursively find files and directories under a directory. Every given predicate must match. Matching paths are
+printed unless --delete or --fetch is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		pred, err := newFindPredicate(findFlags{
+			name:      findName,
+			typ:       findType,
+			size:      findSize,
+			newer:     findNewer,
+			metadata:  findMetadata,
+			private:   findPrivate,
+			versioned: findVersioned,
+		})
+		if err != nil {
+			return err
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		rootPath := path.Clean("/" + args[0])
+		var matches []findMatch
+		// Directories holding entries that didn't match, which must not be deleted
+		unmatchedDirs := map[string]bool{}
+		err = c.Walk(client.WalkInfo{DirPath: rootPath, Shared: findShared}, func(entryPath string, dir *client.DirInfo,
+			file *client.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !pred.matches(entryPath, dir, file) {
+				if entryPath != rootPath {
+					markUnmatched(unmatchedDirs, rootPath, path.Dir(entryPath))
+				}
+				return nil
+			} else if entryPath == rootPath && findDelete {
+				// The directory being searched is never deleted
+				return nil
+			}
+			match := findMatch{entryPath: entryPath, dir: dir != nil}
+			if findDelete || findFetchTo != "" {
+				matches = append(matches, match)
+			} else {
+				fmt.Println(match.displayPath())
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to find: %v", err)
+		}
+		if findFetchTo != "" {
+			if err = findFetch(c, rootPath, matches); err != nil {
+				log.Fatalf("Failed to fetch: %v", err)
+			}
+		}
+		if findDelete {
+			if err = findRemove(c, matches, unmatchedDirs); err != nil {
+				log.Fatalf("Failed to delete: %v", err)
+			}
+		}
+		return nil
+	},
+}
+
+// markUnmatched marks the directory and every directory above it up to the root as holding an unmatched entry
+func markUnmatched(unmatchedDirs map[string]bool, rootPath string, dirPath string) {
+	for ; !unmatchedDirs[dirPath]; dirPath = path.Dir(dirPath) {
+		unmatchedDirs[dirPath] = true
+		if dirPath == rootPath || dirPath == "/" {
+			return
+		}
+	}
+}
+
+type findMatch struct {
+	entryPath string
+	dir       bool
+}
+
+func (f findMatch) displayPath() string {
+	if f.dir && f.entryPath != "/" {
+		return f.entryPath + "/"
+	}
+	return f.entryPath
+}
+
+// findFlags are the predicate flags as given
+type findFlags struct {
+	name      string
+	typ       string
+	size      string
+	newer     string
+	metadata  string
+	private   bool
+	versioned bool
+}
+
+type findPredicate struct {
+	findFlags
+	sizeCmp      int
+	size         int64
+	newer        time.Time
+	metadataKey  string
+	metadataVal  string
+	hasSize      bool
+	hasMetadata  bool
+	hasNewerTime bool
+}
+
+func newFindPredicate(flags findFlags) (*findPredicate, error) {
+	pred := &findPredicate{findFlags: flags}
+	if flags.typ != "" && flags.typ != "f" && flags.typ != "d" {
+		return nil, errors.New("Type must be f or d")
+	}
+	if flags.name != "" {
+		if _, err := path.Match(flags.name, ""); err != nil {
+			return nil, fmt.Errorf("Invalid name pattern: %v", err)
+		}
+	}
+	if flags.size != "" {
+		sizeStr := flags.size
+		if strings.HasPrefix(sizeStr, "+") {
+			pred.sizeCmp = 1
+		} else if strings.HasPrefix(sizeStr, "-") {
+			pred.sizeCmp = -1
+		}
+		size, err := parseSize(strings.TrimLeft(sizeStr, "+-"))
+		if err != nil {
+			return nil, err
+		}
+		pred.size, pred.hasSize = size, true
+	}
+	if flags.newer != "" {
+		// Either a time or how long ago
+		if newer, err := time.Parse(time.RFC3339, flags.newer); err == nil {
+			pred.newer = newer
+		} else if ago, err := time.ParseDuration(flags.newer); err == nil {
+			pred.newer = time.Now().Add(-ago)
+		} else {
+			return nil, errors.New("Newer must be an RFC 3339 time or a duration")
+		}
+		pred.hasNewerTime = true
+	}
+	if flags.metadata != "" {
+		pieces := strings.SplitN(flags.metadata, "=", 2)
+		if len(pieces) != 2 {
+			return nil, errors.New("Metadata must be in the form key=value")
+		}
+		pred.metadataKey, pred.metadataVal, pred.hasMetadata = pieces[0], pieces[1], true
+	}
+	return pred, nil
+}
+
+func (f *findPredicate) matches(entryPath string, dir *client.DirInfo, file *client.FileInfo) bool {
+	var modifiedOn client.Time
+	var metadata string
+	if dir != nil {
+		if f.typ == "f" || f.hasSize || (f.private && !dir.Private) || (f.versioned && !dir.Versioned) {
+			return false
+		}
+		modifiedOn, metadata = dir.ModifiedOn, dir.Metadata
+	} else {
+		// Only directories can be private or versioned
+		if f.typ == "d" || f.private || f.versioned {
+			return false
+		}
+		if f.hasSize {
+			size := file.LogicalSize()
+			if (f.sizeCmp > 0 && size <= f.size) || (f.sizeCmp < 0 && size >= f.size) || (f.sizeCmp == 0 && size != f.size) {
+				return false
+			}
+		}
+		modifiedOn, metadata = file.ModifiedOn, file.Metadata
+	}
+	if f.name != "" {
+		if ok, _ := path.Match(f.name, path.Base(entryPath)); !ok {
+			return false
+		}
+	}
+	if f.hasNewerTime && !modifiedOn.Time().After(f.newer) {
+		return false
+	}
+	if f.hasMetadata {
+		if val, ok := client.ParseMetadata(metadata)[f.metadataKey]; !ok || val != f.metadataVal {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSize parses a byte count with an optional k, M, or G suffix
+func parseSize(str string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(str, "k"):
+		multiplier = 1024
+	case strings.HasSuffix(str, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(str, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		str = str[:len(str)-1]
+	}
+	size, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size: %v", str)
+	}
+	return size * multiplier, nil
+}
+
+func findFetch(c *client.Client, rootPath string, matches []findMatch) error {
+	for _, match := range matches {
+		if match.dir {
+			continue
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(match.entryPath, rootPath), "/")
+		localPath := filepath.Join(findFetchTo, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		if err := fetchToLocalFile(c, client.GetFileInfo{FilePath: match.entryPath, Shared: findShared,
+			Decompress: true}, 0, localPath); err != nil {
+			return fmt.Errorf("Unable to fetch %v: %v", match.entryPath, err)
+		}
+		fmt.Println(match.displayPath())
+	}
+	return nil
+}
+
+// findRemove deletes the matches except for directories that hold entries that didn't match, since deleting a
+// directory deletes everything in it
+func findRemove(c *client.Client, matches []findMatch, unmatchedDirs map[string]bool) error {
+	// Walk order has every directory before its contents, so going backwards deletes contents first
+	for i := len(matches) - 1; i >= 0; i-- {
+		match := matches[i]
+		var err error
+		if match.dir && unmatchedDirs[match.entryPath] {
+			log.Printf("Not deleting %v since it holds entries that didn't match", match.displayPath())
+			continue
+		} else if match.dir {
+			err = c.DeleteDir(client.DeleteDirInfo{DirPath: match.entryPath, Shared: findShared})
+		} else {
+			err = c.DeleteFile(client.DeleteFileInfo{FilePath: match.entryPath, Shared: findShared})
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to delete %v: %v", match.entryPath, err)
+		}
+		fmt.Println(match.displayPath())
+	}
+	return nil
+}
+
+func fetchToLocalFile(c *client.Client, info client.GetFileInfo, version int64, localPath string) error {
+	rc, err := fetchFile(c, info, version)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	outFile, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	_, err = io.Copy(outFile, rc)
+	return err
+}
+
+func init() {
+	findCmd.Flags().BoolVarP(&findShared, "shared", "s", false, "Use shared area for user/app")
+	findCmd.Flags().StringVar(&findName, "name", "", "Only entries whose name matches this glob")
+	findCmd.Flags().StringVar(&findType, "type", "", "Only files (f) or directories (d)")
+	findCmd.Flags().StringVar(&findSize, "size", "", "Only files of this size in bytes, prefix with + for larger or - for smaller, suffix k, M, or G for units")
+	findCmd.Flags().StringVar(&findNewer, "newer", "", "Only entries modified after this RFC 3339 time or this long ago (e.g. 24h)")
+	findCmd.Flags().StringVar(&findMetadata, "metadata", "", "Only entries with this key=value in their metadata")
+	findCmd.Flags().BoolVar(&findPrivate, "private", false, "Only private directories")
+	findCmd.Flags().BoolVar(&findVersioned, "versioned", false, "Only versioned directories")
+	findCmd.Flags().BoolVar(&findDelete, "delete", false, "Delete matches instead of printing them")
+	findCmd.Flags().StringVar(&findFetchTo, "fetch", "", "Fetch matching files into this local directory")
+	RootCmd.AddCommand(findCmd)
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFindPredicateParsing(t *testing.T) {
+	// Sizes can be larger, smaller or exact with units
+	pred, err := newFindPredicate(findFlags{size: "+2k"})
+	require.NoError(t, err)
+	require.Equal(t, 1, pred.sizeCmp)
+	require.Equal(t, int64(2048), pred.size)
+	pred, err = newFindPredicate(findFlags{size: "-3M"})
+	require.NoError(t, err)
+	require.Equal(t, -1, pred.sizeCmp)
+	require.Equal(t, int64(3*1024*1024), pred.size)
+	pred, err = newFindPredicate(findFlags{size: "10"})
+	require.NoError(t, err)
+	require.Equal(t, 0, pred.sizeCmp)
+	require.Equal(t, int64(10), pred.size)
+
+	// Newer is a time or how long ago
+	pred, err = newFindPredicate(findFlags{newer: "2016-01-02T03:04:05Z"})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC), pred.newer.UTC())
+	pred, err = newFindPredicate(findFlags{newer: "24h"})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(-24*time.Hour), pred.newer, time.Minute)
+
+	// Metadata values can have equals signs
+	pred, err = newFindPredicate(findFlags{metadata: "foo=bar=baz"})
+	require.NoError(t, err)
+	require.Equal(t, "foo", pred.metadataKey)
+	require.Equal(t, "bar=baz", pred.metadataVal)
+
+	// Bad values fail
+	for _, flags := range []findFlags{
+		{typ: "x"},
+		{name: "["},
+		{size: "+k"},
+		{size: "2T"},
+		{newer: "yesterday"},
+		{metadata: "foo"},
+	} {
+		_, err = newFindPredicate(flags)
+		require.Error(t, err, "%+v", flags)
+	}
+}
+
+func TestFindPredicateMatches(t *testing.T) {
+	now := time.Now()
+	toTime := func(t time.Time) client.Time { return client.Time(t.UnixNano() / int64(time.Millisecond)) }
+	file := &client.FileInfo{
+		Name:       "a.txt",
+		Size:       100,
+		ModifiedOn: toTime(now.Add(-time.Hour)),
+		Metadata:   `{"foo":"bar"}`,
+	}
+	// Compressed files are matched on their logical size
+	compressed := &client.FileInfo{Name: "b.txt", Size: 10, Metadata: `{"compression":"gzip","logicalSize":"2048"}`}
+	dir := &client.DirInfo{Name: "d", Private: true, ModifiedOn: toTime(now)}
+	matches := func(flags findFlags, entryPath string, dir *client.DirInfo, file *client.FileInfo) bool {
+		pred, err := newFindPredicate(flags)
+		require.NoError(t, err)
+		return pred.matches(entryPath, dir, file)
+	}
+
+	// Sizes only match files
+	require.True(t, matches(findFlags{size: "100"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{size: "99"}, "/a.txt", nil, file))
+	require.True(t, matches(findFlags{size: "+99"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{size: "+100"}, "/a.txt", nil, file))
+	require.True(t, matches(findFlags{size: "-101"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{size: "-100"}, "/a.txt", nil, file))
+	require.True(t, matches(findFlags{size: "2k"}, "/b.txt", nil, compressed))
+	require.False(t, matches(findFlags{size: "+0"}, "/d", dir, nil))
+
+	// Newer compares modification times
+	require.True(t, matches(findFlags{newer: "2h"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{newer: "30m"}, "/a.txt", nil, file))
+	require.True(t, matches(findFlags{newer: "30m"}, "/d", dir, nil))
+
+	// Metadata must have the key with the exact value
+	require.True(t, matches(findFlags{metadata: "foo=bar"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{metadata: "foo=baz"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{metadata: "qux=bar"}, "/a.txt", nil, file))
+	require.False(t, matches(findFlags{metadata: "foo=bar"}, "/d", dir, nil))
+
+	// Names, types, private and versioned
+	require.True(t, matches(findFlags{name: "*.txt", typ: "f"}, "/x/a.txt", nil, file))
+	require.False(t, matches(findFlags{name: "*.txt", typ: "d"}, "/x/a.txt", nil, file))
+	require.True(t, matches(findFlags{typ: "d", private: true}, "/d", dir, nil))
+	require.False(t, matches(findFlags{versioned: true}, "/d", dir, nil))
+	require.False(t, matches(findFlags{private: true}, "/a.txt", nil, file))
+}
+
+func TestFindMarkUnmatched(t *testing.T) {
+	unmatched := map[string]bool{}
+	markUnmatched(unmatched, "/site", "/site/a/b")
+	require.Equal(t, map[string]bool{"/site": true, "/site/a": true, "/site/a/b": true}, unmatched)
+	markUnmatched(unmatched, "/site", "/site/c")
+	require.True(t, unmatched["/site/c"])
+	require.False(t, unmatched["/"])
+}
@@ -0,0 +1,500 @@
+// Command git-remote-safe is a git remote helper for repositories stored on SAFE. Once it is on the PATH, git uses it
+// for remotes with URLs like safe://mydir/repo.git. The path is in the app area unless the URL has a "shared" query
+// parameter (e.g. safe://mydir/repo.git?shared). Public repositories can be cloned without authorization with a "dns"
+// query parameter giving the service and name (e.g. safe://repo.git?dns=www.mysite) where the path is then relative to
+// the service's home directory. Repositories reached through DNS are read only.
+//
+// The repository is stored as:
+//
+//	HEAD                  The symbolic ref for the default branch
+//	info/refs             Each ref's name and object name
+//	objects/info/packs    Each pack's name and the objects pushed with it
+//	objects/pack/*.pack   A pack per push holding the objects the remote didn't have
+//
+// Ref updates are compare-and-swap: the refs are read again right before they are written and a ref that has changed
+// since git listed it is rejected so the user can fetch first, unless the push is forced. SAFE has no atomic writes
+// though, so two pushes at the same instant can still lose one's update.
+//
+// The client config is taken from the "safe.config" git config value and is "conf.json" if unset. It is shared with
+// the go-safeclient CLI. Public clones only use it for the launcher address.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("git-remote-safe: ")
+	if len(os.Args) != 3 {
+		log.Fatalf("Usage: git-remote-safe <remote> <url>")
+	}
+	r, err := newRemote(os.Args[2])
+	if err != nil {
+		log.Fatalf("Invalid remote: %v", err)
+	}
+	if err = r.run(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// remote is a repository on SAFE and the state of a single helper session for it
+type remote struct {
+	c      *client.Client
+	dir    string
+	shared bool
+	// Only set for public read only access
+	dnsName    string
+	dnsService string
+	// The refs as last listed to git, which pushes are compared against
+	listed map[string]string
+}
+
+func newRemote(rawURL string) (*remote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "safe" {
+		return nil, fmt.Errorf("Expected safe:// URL, got %v", rawURL)
+	}
+	r := &remote{dir: path.Clean("/" + u.Host + u.Path)}
+	query := u.Query()
+	_, r.shared = query["shared"]
+	configFile := "conf.json"
+	if out, err := exec.Command("git", "config", "--path", "safe.config").Output(); err == nil {
+		configFile = strings.TrimSpace(string(out))
+	}
+	dns := query.Get("dns")
+	if dns == "" {
+		authInfo := client.AuthInfo{App: client.CLIAuthApp, Permissions: []string{client.AuthPermSafeDriveAccess}}
+		if r.c, err = client.NewClientFromConfFile(configFile, authInfo, nil); err != nil {
+			return nil, fmt.Errorf("Unable to obtain client: %v", err)
+		}
+		return r, nil
+	}
+	pieces := strings.SplitN(dns, ".", 2)
+	if len(pieces) != 2 {
+		return nil, fmt.Errorf("DNS must be in the form service.name, got %v", dns)
+	}
+	r.dnsService, r.dnsName = pieces[0], pieces[1]
+	// Public files don't need an authed client, but the config may still say where the launcher is
+	conf, err := client.LoadConf(configFile)
+	if err != nil {
+		return nil, err
+	}
+	r.c = client.NewClient(conf)
+	return r, nil
+}
+
+// run answers git's commands until git is done. See
+// https://git-scm.com/docs/gitremote-helpers for the protocol.
+func (r *remote) run(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
+	for {
+		line, err := readLine(reader)
+		if err != nil || line == "" {
+			return err
+		}
+		switch {
+		case line == "capabilities":
+			fmt.Fprint(writer, "fetch\npush\n\n")
+		case line == "list" || line == "list for-push":
+			err = r.list(writer)
+		case strings.HasPrefix(line, "fetch "):
+			if err = r.fetch(batch(reader, line)); err == nil {
+				fmt.Fprintln(writer)
+			}
+		case strings.HasPrefix(line, "push "):
+			err = r.push(writer, batch(reader, line))
+		default:
+			err = fmt.Errorf("Unknown command: %v", line)
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err == io.EOF {
+		return "", nil
+	}
+	return strings.TrimRight(line, "\n"), err
+}
+
+// batch gives the arguments of the first line and those of the lines after it up to the blank line ending the batch
+func batch(reader *bufio.Reader, first string) []string {
+	args := []string{first[strings.Index(first, " ")+1:]}
+	for {
+		line, err := readLine(reader)
+		if err != nil || line == "" {
+			return args
+		}
+		args = append(args, line[strings.Index(line, " ")+1:])
+	}
+}
+
+func (r *remote) list(writer io.Writer) error {
+	refs, err := r.readRefs()
+	if err != nil {
+		return err
+	}
+	r.listed = refs
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(writer, "%v %v\n", refs[name], name)
+	}
+	head, _, err := r.readFile("HEAD")
+	if err != nil {
+		return err
+	}
+	if target := strings.TrimSpace(strings.TrimPrefix(string(head), "ref:")); refs[target] != "" {
+		fmt.Fprintf(writer, "@%v HEAD\n", target)
+	}
+	fmt.Fprintln(writer)
+	return nil
+}
+
+// fetch gets the packs whose objects aren't all here already. A pack is skipped when the objects pushed with it are
+// present since everything they reference was either already here or came with them.
+func (r *remote) fetch(args []string) error {
+	packs, err := r.readPacks()
+	if err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		have := true
+		for _, obj := range pack.tips {
+			if !gitHasObject(obj) {
+				have = false
+				break
+			}
+		}
+		if have {
+			continue
+		}
+		contents, _, err := r.readFile("objects/pack/" + pack.name)
+		if err != nil {
+			return err
+		}
+		index := exec.Command("git", "index-pack", "--stdin")
+		index.Stdin, index.Stderr = bytes.NewReader(contents), os.Stderr
+		if err = index.Run(); err != nil {
+			return fmt.Errorf("Unable to index %v: %v", pack.name, err)
+		}
+	}
+	for _, arg := range args {
+		if obj := strings.Fields(arg)[0]; !gitHasObject(obj) {
+			return fmt.Errorf("Object %v not in any pack", obj)
+		}
+	}
+	return nil
+}
+
+// refUpdate is a single ref of a push
+type refUpdate struct {
+	src   string
+	dst   string
+	force bool
+	// Empty when deleting
+	obj string
+	// Why the update was rejected, if it was
+	err string
+}
+
+func (r *remote) push(writer io.Writer, args []string) error {
+	if r.dnsName != "" {
+		return errors.New("Repositories reached through DNS are read only")
+	}
+	updates := make([]*refUpdate, len(args))
+	for i, arg := range args {
+		update := &refUpdate{force: strings.HasPrefix(arg, "+")}
+		pieces := strings.SplitN(strings.TrimPrefix(arg, "+"), ":", 2)
+		if len(pieces) != 2 {
+			return fmt.Errorf("Invalid push: %v", arg)
+		}
+		update.src, update.dst = pieces[0], pieces[1]
+		if update.src != "" {
+			out, err := exec.Command("git", "rev-parse", "--verify", update.src).Output()
+			if err != nil {
+				return fmt.Errorf("Unable to resolve %v: %v", update.src, err)
+			}
+			update.obj = strings.TrimSpace(string(out))
+		}
+		updates[i] = update
+	}
+	if len(r.listed) == 0 {
+		// The repository may not exist yet
+		if err := r.mkdirs(); err != nil {
+			return err
+		}
+	}
+	if err := r.pushObjects(updates); err != nil {
+		return err
+	}
+	if err := r.updateRefs(updates); err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if update.err == "" {
+			fmt.Fprintf(writer, "ok %v\n", update.dst)
+		} else {
+			fmt.Fprintf(writer, "error %v %v\n", update.dst, update.err)
+		}
+	}
+	fmt.Fprintln(writer)
+	return nil
+}
+
+// pushObjects uploads a pack of what the updates need that isn't reachable from the remote's refs
+func (r *remote) pushObjects(updates []*refUpdate) error {
+	revs := ""
+	tips := []string{}
+	for _, update := range updates {
+		if update.obj != "" {
+			revs += update.obj + "\n"
+			tips = append(tips, update.obj)
+		}
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+	for _, obj := range r.listed {
+		if gitHasObject(obj) {
+			revs += "^" + obj + "\n"
+		}
+	}
+	packObjects := exec.Command("git", "pack-objects", "--stdout", "--revs", "--quiet")
+	packObjects.Stdin, packObjects.Stderr = strings.NewReader(revs), os.Stderr
+	contents, err := packObjects.Output()
+	if err != nil {
+		return fmt.Errorf("Unable to pack objects: %v", err)
+	} else if len(contents) < 32 {
+		return errors.New("Unable to pack objects: pack too short")
+	} else if bytes.Equal(contents[8:12], []byte{0, 0, 0, 0}) {
+		// Nothing new
+		return nil
+	}
+	// Packs are named by their trailing checksum like git does
+	name := "pack-" + hex.EncodeToString(contents[len(contents)-20:]) + ".pack"
+	if err = r.writeFile("objects/pack/"+name, contents); err != nil {
+		return err
+	}
+	// The list is read and written again if a concurrent push replaced it before ours was seen
+	for attempt := 0; attempt < 3; attempt++ {
+		packs, err := r.readPacks()
+		if err != nil {
+			return err
+		}
+		for _, pack := range packs {
+			if pack.name == name {
+				return nil
+			}
+		}
+		packs = append(packs, packInfo{name: name, tips: tips})
+		if err = r.writeFile("objects/info/packs", packs.bytes()); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("Unable to add %v to the pack list", name)
+}
+
+// updateRefs applies the updates that are still valid against the refs as they are now
+func (r *remote) updateRefs(updates []*refUpdate) error {
+	refs, err := r.readRefs()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, update := range updates {
+		old := refs[update.dst]
+		if !update.force && old != r.listed[update.dst] {
+			update.err = "fetch first"
+		} else if !update.force && old != "" && update.obj != "" &&
+			exec.Command("git", "merge-base", "--is-ancestor", old, update.obj).Run() != nil {
+			update.err = "non-fast-forward"
+		} else if update.obj == "" {
+			delete(refs, update.dst)
+			changed = true
+		} else {
+			refs[update.dst] = update.obj
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%v\t%v\n", refs[name], name)
+	}
+	if err = r.writeFile("info/refs", buf.Bytes()); err != nil {
+		return err
+	}
+	r.listed = refs
+	// The first branch pushed becomes the default, preferring master
+	if _, exists, err := r.readFile("HEAD"); err != nil || exists {
+		return err
+	}
+	head := ""
+	for _, update := range updates {
+		if update.err == "" && strings.HasPrefix(update.dst, "refs/heads/") &&
+			(head == "" || update.dst == "refs/heads/master") {
+			head = update.dst
+		}
+	}
+	if head == "" {
+		return nil
+	}
+	return r.writeFile("HEAD", []byte("ref: "+head+"\n"))
+}
+
+func (r *remote) readRefs() (map[string]string, error) {
+	contents, _, err := r.readFile("info/refs")
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if pieces := strings.Fields(line); len(pieces) == 2 {
+			refs[pieces[1]] = pieces[0]
+		}
+	}
+	return refs, nil
+}
+
+// packInfo is a line in the pack list
+type packInfo struct {
+	name string
+	tips []string
+}
+
+type packInfos []packInfo
+
+func (p packInfos) bytes() []byte {
+	var buf bytes.Buffer
+	for _, pack := range p {
+		fmt.Fprintf(&buf, "P %v %v\n", pack.name, strings.Join(pack.tips, " "))
+	}
+	return buf.Bytes()
+}
+
+func (r *remote) readPacks() (packInfos, error) {
+	contents, _, err := r.readFile("objects/info/packs")
+	if err != nil {
+		return nil, err
+	}
+	packs := packInfos{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if pieces := strings.Fields(line); len(pieces) >= 2 && pieces[0] == "P" {
+			packs = append(packs, packInfo{name: pieces[1], tips: pieces[2:]})
+		}
+	}
+	return packs, nil
+}
+
+// readFile gives the contents of the file in the repository and whether it exists
+func (r *remote) readFile(name string) ([]byte, bool, error) {
+	var rc io.ReadCloser
+	if r.dnsName != "" {
+		file, err := r.c.DNSFile(client.DNSFileInfo{Name: r.dnsName, Service: r.dnsService,
+			FilePath: path.Join(r.dir, name)})
+		if client.IsNotExist(err) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, fmt.Errorf("Unable to read %v: %v", name, err)
+		}
+		rc = file.Body
+	} else {
+		exists, err := r.exists(name)
+		if err != nil || !exists {
+			return nil, false, err
+		}
+		if rc, err = r.c.GetFile(client.GetFileInfo{FilePath: path.Join(r.dir, name), Shared: r.shared}); err != nil {
+			return nil, false, fmt.Errorf("Unable to read %v: %v", name, err)
+		}
+	}
+	defer rc.Close()
+	contents, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to read %v: %v", name, err)
+	}
+	return contents, true, nil
+}
+
+// exists checks for the file in its parent's listing since the launcher doesn't say why a read fails
+func (r *remote) exists(name string) (bool, error) {
+	filePath := path.Join(r.dir, name)
+	dir, err := r.c.GetDir(client.GetDirInfo{DirPath: path.Dir(filePath), Shared: r.shared})
+	if client.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Unable to list %v: %v", path.Dir(name), err)
+	}
+	for _, file := range dir.Files {
+		if file.Name == path.Base(filePath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeFile replaces the file in the repository with the contents. It is written atomically so fetches never see it
+// partially written and a failure never loses the existing file.
+func (r *remote) writeFile(name string, contents []byte) error {
+	err := r.c.WriteFileAtomic(client.WriteFileAtomicInfo{
+		FilePath: path.Join(r.dir, name),
+		Shared:   r.shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(contents)),
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to write %v: %v", name, err)
+	}
+	return nil
+}
+
+// mkdirs creates the repository's directories that don't exist
+func (r *remote) mkdirs() error {
+	for _, dir := range []string{"info", "objects/info", "objects/pack"} {
+		dir = path.Join(r.dir, dir)
+		if err := r.c.MkdirAll(client.CreateDirInfo{DirPath: dir, Shared: r.shared}); err != nil {
+			return fmt.Errorf("Unable to create %v: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+func gitHasObject(obj string) bool {
+	return exec.Command("git", "cat-file", "-e", obj).Run() == nil
+}
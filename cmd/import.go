@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+var importShared bool
+var importFormat string
+var importProgress bool
+
+var importCmd = &cobra.Command{
+	Use:   "import [archive file or - for stdin] [dir]",
+	Short: "Import tar or zip archive into directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Exactly two arguments required for archive and directory")
+		}
+		archivePath := args[0]
+		if archivePath == "-" {
+			archivePath = ""
+		}
+		format, err := archiveFormat(importFormat, archivePath)
+		if err != nil {
+			return err
+		} else if format == "zip" && archivePath == "" {
+			return errors.New("Zip archives can't be read from stdin")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		input := os.Stdin
+		if archivePath != "" {
+			if input, err = os.Open(archivePath); err != nil {
+				log.Fatalf("Unable to read file: %v", err)
+			}
+			defer input.Close()
+		}
+		info := client.ImportInfo{DirPath: args[1], Shared: importShared}
+		if importProgress {
+			info.Progress = newProgressFunc(args[1])
+		}
+		if format == "zip" {
+			var stat os.FileInfo
+			if stat, err = input.Stat(); err != nil {
+				log.Fatalf("Unable to read file: %v", err)
+			}
+			err = c.ImportZip(input, stat.Size(), info)
+		} else {
+			err = c.ImportTar(input, info)
+		}
+		if err != nil {
+			log.Fatalf("Failed to import archive: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	importCmd.Flags().BoolVarP(&importShared, "shared", "s", false, "Use shared area for user/app")
+	importCmd.Flags().StringVar(&importFormat, "format", "", "Archive format, tar or zip (default based on file extension or tar)")
+	importCmd.Flags().BoolVar(&importProgress, "progress", false, "Show upload progress on stderr")
+	RootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/kv"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+var kvDir string
+var kvShared bool
+var kvVersion int64
+var kvLong bool
+
+var kvCmd = &cobra.Command{
+	Use:   "kv",
+	Short: "Get and put values in a key/value store",
+	Long: `Get and put values in a key/value store kept in a directory.
+
+Values have a version that goes up with each put. Give --version to put or rm to only change the value if it is still
+at that version, with 0 meaning the key must not have a value yet.`,
+}
+
+var kvGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Write value to stdout",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		value, version, err := getKVStore().Get(args[0])
+		if err != nil {
+			log.Fatalf("Failed to get value: %v", err)
+		}
+		if kvLong {
+			fmt.Fprintf(os.Stderr, "Version %v\n", version)
+		}
+		os.Stdout.Write(value)
+		return nil
+	},
+}
+
+var kvPutCmd = &cobra.Command{
+	Use:   "put [key] [value]",
+	Short: "Set value, reading it from stdin if not given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 && len(args) != 2 {
+			return errors.New("Key and optional value required")
+		}
+		var value []byte
+		if len(args) == 2 {
+			value = []byte(args[1])
+		} else {
+			var err error
+			if value, err = ioutil.ReadAll(os.Stdin); err != nil {
+				log.Fatalf("Unable to read stdin: %v", err)
+			}
+		}
+		version, err := getKVStore().Put(args[0], value, kvVersion)
+		if err != nil {
+			log.Fatalf("Failed to put value: %v", err)
+		}
+		if kvLong {
+			fmt.Printf("Version %v\n", version)
+		}
+		return nil
+	},
+}
+
+var kvRmCmd = &cobra.Command{
+	Use:   "rm [key]",
+	Short: "Delete value",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		if err := getKVStore().Delete(args[0], kvVersion); err != nil {
+			log.Fatalf("Failed to delete value: %v", err)
+		}
+		return nil
+	},
+}
+
+var kvLsCmd = &cobra.Command{
+	Use:   "ls [prefix]",
+	Short: "List keys, optionally only those starting with prefix",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("At most one argument allowed")
+		}
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		entries, err := getKVStore().List(prefix)
+		if err != nil {
+			log.Fatalf("Failed to list keys: %v", err)
+		}
+		for _, entry := range entries {
+			if kvLong {
+				fmt.Printf("%v\t%v\t%v\n", entry.Version, entry.Size, entry.Key)
+			} else {
+				fmt.Println(entry.Key)
+			}
+		}
+		return nil
+	},
+}
+
+func getKVStore() *kv.Store {
+	c, err := getClient()
+	if err != nil {
+		log.Fatalf("Unable to obtain client: %v", err)
+	}
+	store, err := kv.NewStore(c, kv.StoreInfo{DirPath: kvDir, Shared: kvShared})
+	if err != nil {
+		log.Fatalf("Unable to open store: %v", err)
+	}
+	return store
+}
+
+func init() {
+	kvCmd.PersistentFlags().StringVar(&kvDir, "dir", "/kv", "Directory the store is in")
+	kvCmd.PersistentFlags().BoolVarP(&kvShared, "shared", "s", false, "Use shared area for user/app")
+	kvGetCmd.Flags().BoolVarP(&kvLong, "long", "l", false, "Show the version on stderr")
+	kvPutCmd.Flags().Int64Var(&kvVersion, "version", kv.AnyVersion, "Only put if the value is at this version")
+	kvPutCmd.Flags().BoolVarP(&kvLong, "long", "l", false, "Show the new version")
+	kvRmCmd.Flags().Int64Var(&kvVersion, "version", kv.AnyVersion, "Only delete if the value is at this version")
+	kvLsCmd.Flags().BoolVarP(&kvLong, "long", "l", false, "Show the version and size of each value")
+	kvCmd.AddCommand(kvGetCmd, kvPutCmd, kvRmCmd, kvLsCmd)
+	RootCmd.AddCommand(kvCmd)
+}
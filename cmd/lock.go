@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+var lockShared bool
+var lockHolder string
+var lockTTL time.Duration
+var lockWait time.Duration
+var lockRenew string
+
+var lockCmd = &cobra.Command{
+	Use:   "lock [file path]",
+	Short: "Take or renew a lock",
+	Long: `Take the lock at the given file path and print its token, which is needed to renew it with --renew or
+release it with unlock. The lock expires if it isn't renewed within the TTL.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		if lockRenew != "" {
+			info := client.RenewLockInfo{
+				FilePath: args[0],
+				Shared:   lockShared,
+				Token:    lockRenew,
+				TTL:      lockTTL,
+			}
+			if err = c.RenewLock(info); err != nil {
+				log.Fatalf("Failed to renew lock: %v", err)
+			}
+			return nil
+		}
+		info := client.LockInfo{
+			FilePath: args[0],
+			Shared:   lockShared,
+			Holder:   lockHolder,
+			TTL:      lockTTL,
+			Wait:     lockWait,
+		}
+		l, err := c.Lock(info)
+		if err != nil {
+			log.Fatalf("Failed to take lock: %v", err)
+		}
+		fmt.Println(l.Token)
+		return nil
+	},
+}
+
+func init() {
+	lockCmd.Flags().BoolVarP(&lockShared, "shared", "s", false, "Use shared area for user/app")
+	lockCmd.Flags().StringVar(&lockHolder, "holder", "", "Who is taking the lock (default host name and process ID)")
+	lockCmd.Flags().DurationVar(&lockTTL, "ttl", client.DefaultLockTTL, "How long the lock lasts without renewal")
+	lockCmd.Flags().DurationVar(&lockWait, "wait", 0, "How long to keep trying if the lock is held")
+	lockCmd.Flags().StringVar(&lockRenew, "renew", "", "Renew the lock held with this token instead of taking it")
+	RootCmd.AddCommand(lockCmd)
+}
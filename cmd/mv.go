@@ -11,12 +11,12 @@ var mvShared bool
 var mvDestChangeShared bool
 
 var mvCmd = &cobra.Command{
-	Use: "mv [src file] [dest dir]",
+	Use: "mv [src file...] [dest dir]",
 	// TODO: https://maidsafe.atlassian.net/browse/CS-60
 	Short: "Move file [NOT YET WORKING]",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 2 {
-			return errors.New("Exactly two arguments required for source and destination")
+		if len(args) < 2 {
+			return errors.New("At least two arguments required for source and destination")
 		}
 		c, err := getClient()
 		if err != nil {
@@ -26,15 +26,21 @@ var mvCmd = &cobra.Command{
 		if mvDestChangeShared {
 			destShared = !mvShared
 		}
-		info := client.MoveFileInfo{
-			SrcPath:      args[0],
-			SrcShared:    mvShared,
-			DestPath:     args[1],
-			DestShared:   destShared,
-			RetainSource: false,
+		srcPaths, err := c.GlobAll(args[:len(args)-1], mvShared)
+		if err != nil {
+			log.Fatalf("Failed to expand paths: %v", err)
 		}
-		if err = c.MoveFile(info); err != nil {
-			log.Fatalf("Failed to move file: %v", err)
+		for _, srcPath := range srcPaths {
+			info := client.MoveFileInfo{
+				SrcPath:      srcPath,
+				SrcShared:    mvShared,
+				DestPath:     args[len(args)-1],
+				DestShared:   destShared,
+				RetainSource: false,
+			}
+			if err = c.MoveFile(info); err != nil {
+				log.Fatalf("Failed to move file %v: %v", srcPath, err)
+			}
 		}
 		return nil
 	},
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// newProgressFunc gives a progress func that draws a bar on stderr if it is a terminal or otherwise logs a line every
+// few seconds. The label is shown with each update.
+func newProgressFunc(label string) client.ProgressFunc {
+	stat, err := os.Stderr.Stat()
+	tty := err == nil && stat.Mode()&os.ModeCharDevice != 0
+	// Log lines start after the first interval so short transfers only log once
+	interval, last := 5*time.Second, time.Now()
+	if tty {
+		interval, last = 200*time.Millisecond, time.Time{}
+	}
+	return func(p client.Progress) {
+		if !p.Done && time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+		if !tty {
+			log.Print(formatProgress(label, p, false))
+		} else if p.Done {
+			fmt.Fprintf(os.Stderr, "\r%v\n", formatProgress(label, p, true))
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%v", formatProgress(label, p, true))
+		}
+	}
+}
+
+func formatProgress(label string, p client.Progress, bar bool) string {
+	pieces := []string{label}
+	if p.Total >= 0 {
+		percent := 100
+		if p.Total > 0 {
+			percent = int(p.Transferred * 100 / p.Total)
+		}
+		if bar {
+			filled := percent * progressBarWidth / 100
+			pieces = append(pieces, "["+strings.Repeat("=", filled)+strings.Repeat(" ", progressBarWidth-filled)+"]")
+		}
+		pieces = append(pieces, fmt.Sprintf("%3d%%", percent),
+			formatSize(p.Transferred, true)+"/"+formatSize(p.Total, true))
+	} else {
+		pieces = append(pieces, formatSize(p.Transferred, true))
+	}
+	if p.Files > 0 {
+		pieces = append(pieces, fmt.Sprintf("%v files", p.Files))
+	}
+	pieces = append(pieces, formatSize(int64(p.Rate), true)+"/s")
+	return strings.Join(pieces, " ")
+}
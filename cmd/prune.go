@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var pruneShared bool
+var pruneKeepLast int
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [dir]",
+	Short: "Remove old backup snapshots and unused chunks",
+	Long: `Remove all but the most recent backup snapshots in dir and then the chunks no remaining snapshot uses.
+
+Don't run this while a backup to the same directory is in progress.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		} else if pruneKeepLast < 1 {
+			return errors.New("Keep last must be at least 1")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		result, err := c.PruneBackup(client.PruneBackupInfo{
+			DirPath:  args[0],
+			Shared:   pruneShared,
+			KeepLast: pruneKeepLast,
+		})
+		if err != nil {
+			log.Fatalf("Failed to prune: %v", err)
+		}
+		for _, id := range result.Snapshots {
+			fmt.Printf("Removed snapshot %v\n", id)
+		}
+		fmt.Printf("Removed %v unused chunks\n", result.Chunks)
+		return nil
+	},
+}
+
+func init() {
+	pruneCmd.Flags().BoolVarP(&pruneShared, "shared", "s", false, "Use shared area for user/app")
+	pruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "Number of most recent snapshots to keep")
+	RootCmd.AddCommand(pruneCmd)
+}
@@ -1,16 +1,26 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/cretz/go-safeclient/client"
 	"github.com/spf13/cobra"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 )
 
 var putShared bool
 var putFromFile string
 var putOffset int64
+var putCompress bool
+var putProgress bool
+var putResume bool
+var putStateDir string
+var putChunkSize int64
+var putAtomic bool
 
 var putCmd = &cobra.Command{
 	Use:   "put [file path]",
@@ -19,6 +29,13 @@ var putCmd = &cobra.Command{
 		if len(args) != 1 {
 			return errors.New("One and only one argument allowed")
 		}
+		if putResume && putFromFile == "" {
+			return errors.New("Resumable uploads must read from a file")
+		} else if putResume && (putOffset != 0 || putCompress) {
+			return errors.New("Resumable uploads can't have an offset or be compressed")
+		} else if putAtomic && (putResume || putOffset != 0) {
+			return errors.New("Atomic writes can't be resumable or have an offset")
+		}
 		c, err := getClient()
 		if err != nil {
 			log.Fatalf("Unable to obtain client: %v", err)
@@ -31,11 +48,46 @@ var putCmd = &cobra.Command{
 			}
 			defer input.Close()
 		}
+		if putResume {
+			info := client.ResumableUploadInfo{
+				FilePath:    args[0],
+				Shared:      putShared,
+				Contents:    input,
+				JournalPath: putJournalPath(args[0], putShared),
+				ChunkSize:   putChunkSize,
+			}
+			if putProgress {
+				info.Progress = newProgressFunc(args[0])
+			}
+			if err = c.ResumableUpload(info); err != nil {
+				log.Fatalf("Failed to write file, run again to resume: %v", err)
+			}
+			return nil
+		}
+		if putAtomic {
+			info := client.WriteFileAtomicInfo{
+				FilePath: args[0],
+				Shared:   putShared,
+				Contents: input,
+				Compress: putCompress,
+			}
+			if putProgress {
+				info.Progress = newProgressFunc(args[0])
+			}
+			if err = c.WriteFileAtomic(info); err != nil {
+				log.Fatalf("Failed to write file: %v", err)
+			}
+			return nil
+		}
 		info := client.WriteFileInfo{
 			FilePath: args[0],
 			Shared:   putShared,
 			Contents: input,
 			Offset:   putOffset,
+			Compress: putCompress,
+		}
+		if putProgress {
+			info.Progress = newProgressFunc(args[0])
 		}
 		if err = c.WriteFile(info); err != nil {
 			log.Fatalf("Failed to write file: %v", err)
@@ -44,9 +96,25 @@ var putCmd = &cobra.Command{
 	},
 }
 
+// putJournalPath gives the journal location for uploads to the given SAFE file
+func putJournalPath(filePath string, shared bool) string {
+	stateDir := putStateDir
+	if stateDir == "" {
+		stateDir = filepath.Join(filepath.Dir(cfgFile), ".go-safeclient-uploads")
+	}
+	hash := sha256.Sum256([]byte(strconv.FormatBool(shared) + ":" + filePath))
+	return filepath.Join(stateDir, hex.EncodeToString(hash[:])+".json")
+}
+
 func init() {
 	putCmd.Flags().BoolVarP(&putShared, "shared", "s", false, "Use shared area for user/app")
 	putCmd.Flags().StringVarP(&putFromFile, "file", "f", "", "Read from a file instead of stdin")
 	putCmd.Flags().Int64VarP(&putOffset, "offset", "o", 0, "Offset to start writing from")
+	putCmd.Flags().BoolVar(&putCompress, "compress", false, "Compress the contents unless already compressed")
+	putCmd.Flags().BoolVar(&putProgress, "progress", false, "Show upload progress on stderr")
+	putCmd.Flags().BoolVar(&putResume, "resume", false, "Upload in chunks and continue a previously failed upload of the same file")
+	putCmd.Flags().StringVar(&putStateDir, "state-dir", "", "Directory for resumable upload journals (default .go-safeclient-uploads next to the config file)")
+	putCmd.Flags().Int64Var(&putChunkSize, "chunk-size", client.DefaultUploadChunkSize, "Bytes per write for resumable uploads")
+	putCmd.Flags().BoolVar(&putAtomic, "atomic", false, "Replace the whole file via a temp file so it's never seen partially written")
 	RootCmd.AddCommand(putCmd)
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var restoreShared bool
+var restoreSnapshot string
+var restoreProgress bool
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [dir] [local dir]",
+	Short: "Restore backup snapshot to local directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Exactly two arguments required for directory and local directory")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		info := client.RestoreBackupInfo{
+			DirPath:    args[0],
+			Shared:     restoreShared,
+			SnapshotID: restoreSnapshot,
+			LocalDir:   args[1],
+		}
+		if restoreProgress {
+			info.Progress = newProgressFunc(args[1])
+		}
+		if _, err = c.RestoreBackup(info); err != nil {
+			log.Fatalf("Failed to restore: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	restoreCmd.Flags().BoolVarP(&restoreShared, "shared", "s", false, "Use shared area for user/app")
+	restoreCmd.Flags().StringVar(&restoreSnapshot, "snapshot", "", "ID of the snapshot to restore (default latest)")
+	restoreCmd.Flags().BoolVar(&restoreProgress, "progress", false, "Show download progress on stderr")
+	RootCmd.AddCommand(restoreCmd)
+}
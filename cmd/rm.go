@@ -8,24 +8,53 @@ import (
 )
 
 var rmShared bool
+var rmRecursive bool
+var rmTrash bool
 
 var rmCmd = &cobra.Command{
-	Use:   "rm [file]",
+	Use:   "rm [file...]",
 	Short: "Delete file",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("One and only one argument allowed")
+		if len(args) == 0 {
+			return errors.New("At least one argument required")
 		}
 		c, err := getClient()
 		if err != nil {
 			log.Fatalf("Unable to obtain client: %v", err)
 		}
-		info := client.DeleteFileInfo{
-			FilePath: args[0],
-			Shared:   rmShared,
+		paths, err := c.GlobAll(args, rmShared)
+		if err != nil {
+			log.Fatalf("Failed to expand paths: %v", err)
 		}
-		if err = c.DeleteFile(info); err != nil {
-			log.Fatalf("Failed to delete file: %v", err)
+		for _, filePath := range paths {
+			if rmTrash {
+				if !rmRecursive {
+					if _, dirErr := c.GetDir(client.GetDirInfo{DirPath: filePath, Shared: rmShared}); dirErr == nil {
+						log.Fatalf("Failed to trash %v: it is a directory", filePath)
+					}
+				}
+				info := client.TrashInfo{Path: filePath, Shared: rmShared, PurgeOlderThan: client.DefaultTrashRetention}
+				if _, err = c.Trash(info); err != nil {
+					log.Fatalf("Failed to trash %v: %v", filePath, err)
+				}
+				continue
+			}
+			if rmRecursive {
+				if _, dirErr := c.GetDir(client.GetDirInfo{DirPath: filePath, Shared: rmShared}); dirErr == nil {
+					err = c.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: filePath, Shared: rmShared})
+					if err != nil {
+						log.Fatalf("Failed to delete dir %v: %v", filePath, err)
+					}
+					continue
+				}
+			}
+			info := client.DeleteFileInfo{
+				FilePath: filePath,
+				Shared:   rmShared,
+			}
+			if err = c.DeleteFile(info); err != nil {
+				log.Fatalf("Failed to delete file %v: %v", filePath, err)
+			}
 		}
 		return nil
 	},
@@ -33,5 +62,7 @@ var rmCmd = &cobra.Command{
 
 func init() {
 	rmCmd.Flags().BoolVarP(&rmShared, "shared", "s", false, "Use shared area for user/app")
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "Delete directories and everything under them")
+	rmCmd.Flags().BoolVar(&rmTrash, "trash", false, "Move to the trash instead, see the trash command")
 	RootCmd.AddCommand(rmCmd)
 }
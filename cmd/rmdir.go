@@ -2,36 +2,125 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"github.com/cretz/go-safeclient/client"
 	"github.com/spf13/cobra"
 	"log"
+	"os"
+	"path"
 )
 
+// rmdirConfirmThreshold is the number of entries above which a recursive delete asks before deleting
+const rmdirConfirmThreshold = 100
+
 var rmdirShared bool
+var rmdirRecursive bool
+var rmdirDryRun bool
+var rmdirYes bool
+var rmdirConcurrency int
+var rmdirTrash bool
 
 var rmdirCmd = &cobra.Command{
 	Use:   "rmdir [dir]",
 	Short: "Delete directory",
+	Long: `Delete a directory. With --recursive, everything under the directory is deleted first. If some entries can't be
+deleted, they are listed and running the same command again retries only what is left.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
 			return errors.New("One and only one argument allowed")
 		}
+		if rmdirDryRun && !rmdirRecursive {
+			return errors.New("Dry run only applies to recursive deletes")
+		}
 		c, err := getClient()
 		if err != nil {
 			log.Fatalf("Unable to obtain client: %v", err)
 		}
-		info := client.DeleteDirInfo{
-			DirPath: args[0],
-			Shared:  rmdirShared,
+		if rmdirTrash && !rmdirRecursive {
+			dir, err := c.GetDir(client.GetDirInfo{DirPath: args[0], Shared: rmdirShared})
+			if err != nil {
+				log.Fatalf("Failed to load dir: %v", err)
+			} else if len(dir.Files) > 0 || len(dir.SubDirs) > 0 {
+				log.Fatalf("Failed to delete dir: not empty")
+			}
+			rmdirTrashDir(c, args[0])
+			return nil
+		}
+		if !rmdirRecursive {
+			info := client.DeleteDirInfo{
+				DirPath: args[0],
+				Shared:  rmdirShared,
+			}
+			if err = c.DeleteDir(info); err != nil {
+				log.Fatalf("Failed to delete dir: %v", err)
+			}
+			return nil
+		}
+		tree, err := c.LoadDirTree(client.LoadDirTreeInfo{DirPath: args[0], Shared: rmdirShared,
+			Concurrency: rmdirConcurrency})
+		if err != nil {
+			log.Fatalf("Failed to load dir: %v", err)
+		}
+		dirCount := rmdirCountDirs(tree)
+		if rmdirDryRun {
+			rmdirPrintTree(tree)
+			fmt.Printf("Would delete %v files and %v directories\n", tree.FileCount(), dirCount)
+			return nil
+		}
+		if !rmdirYes && tree.FileCount()+dirCount > rmdirConfirmThreshold &&
+			!confirm(fmt.Sprintf("Delete %v files and %v directories under %v?", tree.FileCount(), dirCount, tree.Path)) {
+			return nil
 		}
-		if err = c.DeleteDir(info); err != nil {
+		if rmdirTrash {
+			rmdirTrashDir(c, tree.Path)
+			return nil
+		}
+		err = c.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: tree.Path, Shared: rmdirShared,
+			Concurrency: rmdirConcurrency, Tree: tree})
+		if derr, ok := err.(*client.DeleteDirRecursiveError); ok {
+			for _, failure := range derr.Failures {
+				fmt.Fprintf(os.Stderr, "Failed to delete %v: %v\n", failure.Path, failure.Err)
+			}
+			log.Fatalf("Failed to delete %v entries, run again to retry", len(derr.Failures))
+		} else if err != nil {
 			log.Fatalf("Failed to delete dir: %v", err)
 		}
 		return nil
 	},
 }
 
+func rmdirTrashDir(c *client.Client, dirPath string) {
+	info := client.TrashInfo{Path: dirPath, Shared: rmdirShared, PurgeOlderThan: client.DefaultTrashRetention}
+	if _, err := c.Trash(info); err != nil {
+		log.Fatalf("Failed to trash dir: %v", err)
+	}
+}
+
+func rmdirCountDirs(tree *client.DirTree) int {
+	count := 1
+	for _, sub := range tree.SubDirs {
+		count += rmdirCountDirs(sub)
+	}
+	return count
+}
+
+// rmdirPrintTree prints the paths in the order they'd be deleted
+func rmdirPrintTree(tree *client.DirTree) {
+	for _, file := range tree.Files {
+		fmt.Println(path.Join(tree.Path, file.Name))
+	}
+	for _, sub := range tree.SubDirs {
+		rmdirPrintTree(sub)
+	}
+	fmt.Println(tree.Path + "/")
+}
+
 func init() {
 	rmdirCmd.Flags().BoolVarP(&rmdirShared, "shared", "s", false, "Use shared area for user/app")
+	rmdirCmd.Flags().BoolVarP(&rmdirRecursive, "recursive", "r", false, "Delete everything under the directory too")
+	rmdirCmd.Flags().BoolVar(&rmdirDryRun, "dry-run", false, "Only print what a recursive delete would delete")
+	rmdirCmd.Flags().BoolVarP(&rmdirYes, "yes", "y", false, "Do not ask before deleting large trees")
+	rmdirCmd.Flags().IntVar(&rmdirConcurrency, "concurrency", client.DefaultTreeConcurrency, "Maximum requests to make at once")
+	rmdirCmd.Flags().BoolVar(&rmdirTrash, "trash", false, "Move to the trash instead, see the trash command")
 	RootCmd.AddCommand(rmdirCmd)
 }
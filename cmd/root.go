@@ -1,13 +1,12 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/cretz/go-safeclient/client"
 	"github.com/spf13/cobra"
-	"io/ioutil"
 	"log"
 	"os"
+	"time"
 )
 
 // RootCmd is the root command that the CLI runs
@@ -18,54 +17,38 @@ var RootCmd = &cobra.Command{
 
 var cfgFile = ""
 var verbose = false
-
-var app = client.AuthAppInfo{
-	Name:    "SAFE Client CLI",
-	ID:      "go-safeclient.cretz.github.com",
-	Version: "0.0.1",
-	Vendor:  "cretz",
-	//Name:    "Maidsafe Demo",
-	//ID:      "demo.maidsafe.net",
-	//Version: "0.2.1",
-	//Vendor:  "MaidSafe",
-}
+var cacheTTL time.Duration
+var cacheDir = ""
+var versioning = false
 
 func init() {
 	RootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "conf.json", "config file")
 	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show debug output")
+	RootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", 0,
+		"cache listings and file contents, using them without revalidating for this long")
+	RootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "",
+		"also keep the cache in this local directory so it can be used across runs")
+	RootCmd.PersistentFlags().BoolVar(&versioning, "versioning", false,
+		"save a version of versioned directories before changing their files")
 }
 
 func getClient() (*client.Client, error) {
-	// Try to load the config first
-	var conf client.Conf
-	if _, err := os.Stat(cfgFile); !os.IsNotExist(err) {
-		byts, err := ioutil.ReadFile(cfgFile)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to read conf: %v", err)
-		}
-		// JSON unmarshal into the conf
-		if err := json.Unmarshal(byts, &conf); err != nil {
-			return nil, fmt.Errorf("Invalid conf: %v", err)
-		}
-	}
-
-	// Create the client and ensure it is authed
-	c := client.NewClient(conf)
+	var logger *log.Logger
 	if verbose {
-		c.Logger = log.New(os.Stderr, "", log.LstdFlags)
-	}
-	authInfo := client.AuthInfo{App: app, Permissions: []string{client.AuthPermSafeDriveAccess}}
-	if err := c.EnsureAuthed(authInfo); err != nil {
-		return nil, err
+		logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
-
-	// Persist the config
-	persistBytes, err := json.Marshal(c.Conf)
+	authInfo := client.AuthInfo{App: client.CLIAuthApp, Permissions: []string{client.AuthPermSafeDriveAccess}}
+	c, err := client.NewClientFromConfFile(cfgFile, authInfo, logger)
 	if err != nil {
 		return nil, err
 	}
-	if err := ioutil.WriteFile(cfgFile, persistBytes, 0600); err != nil {
-		return nil, fmt.Errorf("Unable to write config at %v: %v", cfgFile, err)
+	if cacheTTL > 0 || cacheDir != "" {
+		cache, err := client.NewCache(client.CacheConf{TTL: cacheTTL, Dir: cacheDir})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create cache: %v", err)
+		}
+		c.Cache = cache
 	}
+	c.Versioning = versioning
 	return c, nil
 }
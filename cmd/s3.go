@@ -0,0 +1,659 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var s3Shared bool
+var s3Addr string
+
+var s3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Serve an S3 compatible API",
+	Long: `Serve a minimal S3 compatible API until interrupted so S3 tools can use SAFE.
+
+Buckets are the top level directories of the app area, or of the shared area with -s. Object keys are paths under them,
+and directories are created and removed as needed. Only path style requests for ListBuckets, ListObjectsV2, GetObject,
+HeadObject, PutObject, CopyObject and DeleteObject are supported. Request signatures are not checked, so only listen on
+addresses others can't reach.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		server := &s3Server{fs: &safeFS{c: c}, area: "/app"}
+		if s3Shared {
+			server.area = "/shared"
+		}
+		log.Printf("Serving S3 on %v", s3Addr)
+		if err = http.ListenAndServe(s3Addr, server); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+		return nil
+	},
+}
+
+// Metadata keys for what S3 keeps with an object. User metadata is stored under its full header name.
+const (
+	s3MetadataContentType = "contentType"
+	s3MetadataETag        = "etag"
+	s3UserMetadataPrefix  = "x-amz-meta-"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// s3Server handles S3 requests for the buckets in an area of a safeFS
+type s3Server struct {
+	fs   *safeFS
+	area string
+}
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+type s3ListBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string
+	DisplayName string
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type s3BucketsByName []s3Bucket
+
+func (s s3BucketsByName) Len() int           { return len(s) }
+func (s s3BucketsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s s3BucketsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type s3ListObjectsResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	KeyCount              int              `xml:"KeyCount"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+type s3CopyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string
+	ETag         string
+}
+
+// s3Entry is a key or common prefix in a listing
+type s3Entry struct {
+	key    string
+	info   os.FileInfo
+	prefix bool
+}
+
+type s3EntriesByKey []s3Entry
+
+func (s s3EntriesByKey) Len() int           { return len(s) }
+func (s s3EntriesByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s s3EntriesByKey) Less(i, j int) bool { return s[i].key < s[j].key }
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pieces := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := pieces[0], ""
+	if len(pieces) == 2 {
+		key = pieces[1]
+	}
+	if bucket != "" && !s3ValidName(bucket) || key != "" && !s3ValidKey(key) {
+		s.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid bucket or key")
+		return
+	}
+	switch {
+	case bucket == "" && r.Method == "GET":
+		s.listBuckets(w, r)
+	case bucket != "" && key == "" && r.Method == "HEAD":
+		s.headBucket(w, r, bucket)
+	case bucket != "" && key == "" && r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		s.listObjects(w, r, bucket)
+	case key != "" && r.Method == "GET":
+		s.getObject(w, r, bucket, key)
+	case key != "" && r.Method == "HEAD":
+		s.headObject(w, r, bucket, key)
+	case key != "" && r.Method == "PUT" && r.Header.Get("x-amz-copy-source") != "":
+		s.copyObject(w, r, bucket, key)
+	case key != "" && r.Method == "PUT":
+		s.putObject(w, r, bucket, key)
+	case key != "" && r.Method == "DELETE":
+		s.deleteObject(w, r, bucket, key)
+	default:
+		s.writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Operation not supported")
+	}
+}
+
+// s3ValidName is whether the name is a single path element
+func s3ValidName(name string) bool {
+	return name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// s3ValidKey is whether the key maps to a path without empty, "." or ".." elements. A trailing slash is allowed.
+func s3ValidKey(key string) bool {
+	for _, name := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if name == "" || !s3ValidName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *s3Server) name(bucket string, key string) string {
+	return s.area + "/" + bucket + "/" + strings.TrimSuffix(key, "/")
+}
+
+func (s *s3Server) writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	if status >= 500 {
+		log.Printf("%v %v failed: %v", r.Method, r.URL.Path, message)
+	}
+	s.writeXML(w, status, &s3Error{Code: code, Message: message, Resource: r.URL.Path})
+}
+
+func (s *s3Server) writeXML(w http.ResponseWriter, status int, v interface{}) {
+	byts, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(byts)
+}
+
+// writeFSError writes a missing path as the given S3 code and anything else as an internal error
+func (s *s3Server) writeFSError(w http.ResponseWriter, r *http.Request, err error, notExistCode string) {
+	if os.IsNotExist(err) {
+		s.writeError(w, r, http.StatusNotFound, notExistCode, err.Error())
+	} else {
+		s.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+	}
+}
+
+// bucketExists writes NoSuchBucket and returns false if the bucket doesn't exist
+func (s *s3Server) bucketExists(w http.ResponseWriter, r *http.Request, bucket string) bool {
+	info, err := s.fs.stat(s.area + "/" + bucket)
+	if err == nil && !info.dir {
+		err = &os.PathError{Op: "stat", Path: bucket, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		s.writeFSError(w, r, err, "NoSuchBucket")
+		return false
+	}
+	return true
+}
+
+// statObject writes NoSuchKey and returns nil if the object doesn't exist. Directories are not objects.
+func (s *s3Server) statObject(w http.ResponseWriter, r *http.Request, bucket string, key string) *safeFileInfo {
+	if !s.bucketExists(w, r, bucket) {
+		return nil
+	}
+	info, err := s.fs.stat(s.name(bucket, key))
+	if err == nil && (info.dir || strings.HasSuffix(key, "/")) {
+		err = &os.PathError{Op: "stat", Path: key, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		s.writeFSError(w, r, err, "NoSuchKey")
+		return nil
+	}
+	return info
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter, r *http.Request) {
+	infos, err := s.fs.readDir(s.area)
+	if err != nil {
+		s.writeFSError(w, r, err, "NoSuchBucket")
+		return
+	}
+	result := &s3ListBucketsResult{Xmlns: s3Namespace, Buckets: []s3Bucket{}}
+	for _, info := range infos {
+		if dir, ok := info.Sys().(client.DirInfo); ok {
+			result.Buckets = append(result.Buckets, s3Bucket{
+				Name:         dir.Name,
+				CreationDate: dir.CreatedOn.Time().UTC().Format(s3TimeFormat),
+			})
+		}
+	}
+	sort.Sort(s3BucketsByName(result.Buckets))
+	s.writeXML(w, http.StatusOK, result)
+}
+
+func (s *s3Server) headBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if s.bucketExists(w, r, bucket) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// listObjects lists the keys under the prefix. With the common "/" delimiter only the directory the prefix is in is
+// listed. Otherwise everything under that directory is loaded.
+func (s *s3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	result := &s3ListObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           1000,
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        query.Get("start-after"),
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		var err error
+		if result.MaxKeys, err = strconv.Atoi(maxKeys); err != nil || result.MaxKeys < 0 {
+			s.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		}
+	}
+	after := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.StdEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			s.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid continuation token")
+			return
+		}
+		after = string(token)
+	}
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	dirKey := result.Prefix[:strings.LastIndex(result.Prefix, "/")+1]
+	entries := []s3Entry{}
+	if s3ValidKey(dirKey) || dirKey == "" {
+		var err error
+		if entries, err = s.listEntries(bucket, dirKey, result.Delimiter == "/"); err != nil && !os.IsNotExist(err) {
+			s.writeFSError(w, r, err, "NoSuchBucket")
+			return
+		}
+	}
+	entries = s3GroupEntries(entries, result.Prefix, result.Delimiter)
+	sort.Sort(s3EntriesByKey(entries))
+	for _, entry := range entries {
+		if entry.key <= after {
+			continue
+		} else if result.KeyCount >= result.MaxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		if entry.prefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: entry.key})
+		} else {
+			result.Contents = append(result.Contents, s3Object{
+				Key:          entry.key,
+				LastModified: entry.info.ModTime().UTC().Format(s3TimeFormat),
+				ETag:         s3ETag(entry.info),
+				Size:         entry.info.Size(),
+				StorageClass: "STANDARD",
+			})
+		}
+		after = entry.key
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(after))
+	}
+	s.writeXML(w, http.StatusOK, result)
+}
+
+// listEntries gives the files under the directory for dirKey as keys. If shallow, only the directory itself is listed
+// and its sub directories are given as prefixes.
+func (s *s3Server) listEntries(bucket string, dirKey string, shallow bool) ([]s3Entry, error) {
+	dirName := s.name(bucket, dirKey)
+	entries := []s3Entry{}
+	if shallow {
+		infos, err := s.fs.readDir(dirName)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.IsDir() {
+				entries = append(entries, s3Entry{key: dirKey + info.Name() + "/", prefix: true})
+			} else {
+				entries = append(entries, s3Entry{key: dirKey + info.Name(), info: info})
+			}
+		}
+		return entries, nil
+	}
+	safePath, shared, err := safeFSPath(dirName)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.fs.c.LoadDirTree(client.LoadDirTreeInfo{DirPath: safePath, Shared: shared})
+	if err != nil {
+		return nil, safeFSError("readdir", dirName, err)
+	}
+	var addTree func(tree *client.DirTree, treeKey string)
+	addTree = func(tree *client.DirTree, treeKey string) {
+		for _, file := range tree.Files {
+			entries = append(entries, s3Entry{key: treeKey + file.Name, info: fileFileInfo(file)})
+		}
+		for _, sub := range tree.SubDirs {
+			addTree(sub, treeKey+sub.Info.Name+"/")
+		}
+	}
+	addTree(tree, dirKey)
+	return entries, nil
+}
+
+// s3GroupEntries removes entries without the prefix and rolls up keys containing the delimiter after the prefix into
+// common prefixes
+func s3GroupEntries(entries []s3Entry, prefix string, delimiter string) []s3Entry {
+	grouped := []s3Entry{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.key, prefix) {
+			continue
+		}
+		if delimiter != "" && !entry.prefix {
+			if i := strings.Index(entry.key[len(prefix):], delimiter); i >= 0 {
+				entry = s3Entry{key: entry.key[:len(prefix)+i+len(delimiter)], prefix: true}
+			}
+		}
+		if entry.prefix {
+			if seen[entry.key] {
+				continue
+			}
+			seen[entry.key] = true
+		}
+		grouped = append(grouped, entry)
+	}
+	return grouped
+}
+
+// s3ETag gives the stored MD5 of the object or, for files not written through S3, a value based on size and time
+func s3ETag(info os.FileInfo) string {
+	if file, ok := info.Sys().(client.FileInfo); ok {
+		if etag := client.ParseMetadata(file.Metadata)[s3MetadataETag]; etag != "" {
+			return `"` + etag + `"`
+		}
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// writeObjectHeaders writes the ETag, content type and user metadata of the object
+func (s *s3Server) writeObjectHeaders(w http.ResponseWriter, info *safeFileInfo) {
+	w.Header().Set("ETag", s3ETag(info))
+	if file, ok := info.Sys().(client.FileInfo); ok {
+		for k, v := range client.ParseMetadata(file.Metadata) {
+			if k == s3MetadataContentType {
+				w.Header().Set("Content-Type", v)
+			} else if strings.HasPrefix(k, s3UserMetadataPrefix) {
+				w.Header().Set(k, v)
+			}
+		}
+	}
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	info := s.statObject(w, r, bucket, key)
+	if info == nil {
+		return
+	}
+	contents, err := s.fs.readFile(s.name(bucket, key))
+	if err != nil {
+		s.writeFSError(w, r, err, "NoSuchKey")
+		return
+	}
+	s.writeObjectHeaders(w, info)
+	// This handles ranges and conditional requests
+	http.ServeContent(w, r, path.Base(key), info.modTime, bytes.NewReader(contents))
+}
+
+func (s *s3Server) headObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	info := s.statObject(w, r, bucket, key)
+	if info == nil {
+		return
+	}
+	s.writeObjectHeaders(w, info)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.size, 10))
+	w.Header().Set("Last-Modified", info.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestMetadata gives the metadata to store for the content type and user metadata headers of the request
+func s3RequestMetadata(r *http.Request, etag string) client.Metadata {
+	meta := client.Metadata{s3MetadataETag: etag}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		meta[s3MetadataContentType] = contentType
+	}
+	for k := range r.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, s3UserMetadataPrefix) {
+			meta[k] = r.Header.Get(k)
+		}
+	}
+	return meta
+}
+
+// mkdirAll creates the bucket directories for every element of the key's path
+func (s *s3Server) mkdirAll(bucket string, key string) error {
+	name := s.area + "/" + bucket
+	for _, dirName := range strings.Split(key, "/") {
+		name += "/" + dirName
+		info, err := s.fs.stat(name)
+		if os.IsNotExist(err) {
+			err = s.fs.mkdir(name)
+		} else if err == nil && !info.dir {
+			err = &os.PathError{Op: "mkdir", Path: name, Err: errors.New("Object exists with the same name")}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObject replaces the object, creating the directories for it first. It returns the new info for the object.
+func (s *s3Server) writeObject(bucket, key string, contents []byte, meta client.Metadata) (*safeFileInfo, error) {
+	if dirKey := path.Dir(key); dirKey != "." {
+		if err := s.mkdirAll(bucket, dirKey); err != nil {
+			return nil, err
+		}
+	}
+	name := s.name(bucket, key)
+	info, err := s.fs.stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if info != nil && info.dir {
+		return nil, &os.PathError{Op: "write", Path: name, Err: errors.New("Prefix exists with the same name")}
+	}
+	if err = s.fs.writeFile(name, contents, meta.String()); err != nil {
+		return nil, err
+	}
+	return s.fs.stat(name)
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	var contents []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		contents, err = s3DecodeChunked(r.Body)
+	} else {
+		contents, err = ioutil.ReadAll(r.Body)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	sum := md5.Sum(contents)
+	if expected := r.Header.Get("Content-MD5"); expected != "" && expected != base64.StdEncoding.EncodeToString(sum[:]) {
+		s.writeError(w, r, http.StatusBadRequest, "BadDigest", "Content-MD5 does not match")
+		return
+	}
+	etag := hex.EncodeToString(sum[:])
+	// Keys ending in a slash are how S3 tools make folders
+	if strings.HasSuffix(key, "/") {
+		err = s.mkdirAll(bucket, strings.TrimSuffix(key, "/"))
+	} else {
+		_, err = s.writeObject(bucket, key, contents, s3RequestMetadata(r, etag))
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// s3DecodeChunked decodes the aws-chunked encoding of streaming uploads. Chunk signatures aren't checked since request
+// signatures aren't either, and trailers are ignored.
+func s3DecodeChunked(r io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(r)
+	var buf bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeStr := strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+		size, err := strconv.ParseInt(sizeStr, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid chunk size: %v", sizeStr)
+		} else if size == 0 {
+			return buf.Bytes(), nil
+		}
+		if _, err = io.CopyN(&buf, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err = reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// s3ParseCopySource gives the bucket and key of an x-amz-copy-source header. The value is URL encoded as a path, so a
+// plus is a plus and not a space, and any version query is ignored.
+func s3ParseCopySource(source string) (string, string, bool) {
+	source, err := url.PathUnescape(strings.SplitN(source, "?", 2)[0])
+	pieces := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if err != nil || len(pieces) != 2 || !s3ValidName(pieces[0]) || !s3ValidKey(pieces[1]) {
+		return "", "", false
+	}
+	return pieces[0], pieces[1], true
+}
+
+func (s *s3Server) copyObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	srcBucket, srcKey, ok := s3ParseCopySource(r.Header.Get("x-amz-copy-source"))
+	if !ok {
+		s.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid copy source")
+		return
+	}
+	srcInfo := s.statObject(w, r, srcBucket, srcKey)
+	if srcInfo == nil || !s.bucketExists(w, r, bucket) {
+		return
+	}
+	contents, err := s.fs.readFile(s.name(srcBucket, srcKey))
+	if err != nil {
+		s.writeFSError(w, r, err, "NoSuchKey")
+		return
+	}
+	sum := md5.Sum(contents)
+	meta := s3RequestMetadata(r, hex.EncodeToString(sum[:]))
+	if r.Header.Get("x-amz-metadata-directive") != "REPLACE" {
+		meta = client.ParseMetadata(srcInfo.sys.(client.FileInfo).Metadata)
+		meta[s3MetadataETag] = hex.EncodeToString(sum[:])
+	}
+	info, err := s.writeObject(bucket, key, contents, meta)
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.writeXML(w, http.StatusOK, &s3CopyObjectResult{
+		Xmlns:        s3Namespace,
+		LastModified: info.modTime.UTC().Format(s3TimeFormat),
+		ETag:         s3ETag(info),
+	})
+}
+
+// deleteObject deletes the object and then any directories above it that are left empty. Like S3, deleting an object
+// that doesn't exist succeeds.
+func (s *s3Server) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	name := s.name(bucket, key)
+	info, err := s.fs.stat(name)
+	if err == nil && !info.dir {
+		err = s.fs.remove(name)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		s.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	// A key ending in a slash starts with its own directory
+	for dirKey := path.Dir(key); dirKey != "."; dirKey = path.Dir(dirKey) {
+		dirName := s.name(bucket, dirKey)
+		if infos, err := s.fs.readDir(dirName); err != nil || len(infos) > 0 || s.fs.remove(dirName) != nil {
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func init() {
+	s3Cmd.Flags().BoolVarP(&s3Shared, "shared", "s", false, "Use shared area for user/app")
+	s3Cmd.Flags().StringVar(&s3Addr, "addr", "localhost:9000", "Address to listen on")
+	RootCmd.AddCommand(s3Cmd)
+}
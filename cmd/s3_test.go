@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestS3ValidKey(t *testing.T) {
+	for _, key := range []string{"a", "a/b.txt", "a/b/", "a+b c.txt", "..a"} {
+		require.True(t, s3ValidKey(key), key)
+	}
+	for _, key := range []string{"", "/a", "a//b", "a/./b", "a/../b", "..", "a/.."} {
+		require.False(t, s3ValidKey(key), key)
+	}
+}
+
+func TestS3ParseCopySource(t *testing.T) {
+	bucket, key, ok := s3ParseCopySource("/b1/dir/a+b%20c.txt?versionId=1")
+	require.True(t, ok)
+	require.Equal(t, "b1", bucket)
+	require.Equal(t, "dir/a+b c.txt", key)
+	bucket, key, ok = s3ParseCopySource("b1/a%2Fb")
+	require.True(t, ok)
+	require.Equal(t, "a/b", key)
+	for _, source := range []string{"", "b1", "/b1/", "/b1/a/../b", "/../a", "/b1/%zz"} {
+		_, _, ok = s3ParseCopySource(source)
+		require.False(t, ok, source)
+	}
+}
+
+func TestS3DecodeChunked(t *testing.T) {
+	// Chunk signatures and trailers are ignored
+	body := "5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\nx-amz-trailer: foo\r\n\r\n"
+	decoded, err := s3DecodeChunked(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(decoded))
+	decoded, err = s3DecodeChunked(strings.NewReader("0\r\n\r\n"))
+	require.NoError(t, err)
+	require.Empty(t, decoded)
+
+	// Bad sizes and truncated bodies fail
+	_, err = s3DecodeChunked(strings.NewReader("zz\r\nhello\r\n0\r\n\r\n"))
+	require.Error(t, err)
+	_, err = s3DecodeChunked(strings.NewReader("a\r\nhello"))
+	require.Error(t, err)
+	_, err = s3DecodeChunked(strings.NewReader("5\r\nhello\r\n"))
+	require.Error(t, err)
+}
+
+func TestS3GroupEntries(t *testing.T) {
+	entries := []s3Entry{
+		{key: "a/b/c.txt"},
+		{key: "a/b/d.txt"},
+		{key: "a/e.txt"},
+		{key: "g.txt"},
+	}
+	keys := func(grouped []s3Entry) []string {
+		var keys []string
+		for _, entry := range grouped {
+			if entry.prefix {
+				keys = append(keys, "P:"+entry.key)
+			} else {
+				keys = append(keys, entry.key)
+			}
+		}
+		return keys
+	}
+
+	// No delimiter only filters by prefix
+	require.Equal(t, []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt"}, keys(s3GroupEntries(entries, "a/", "")))
+	// Keys with the delimiter after the prefix are rolled up once
+	require.Equal(t, []string{"P:a/"}, keys(s3GroupEntries(entries, "a", "/")))
+	require.Equal(t, []string{"P:a/b/", "a/e.txt"}, keys(s3GroupEntries(entries, "a/", "/")))
+	require.Equal(t, []string{"P:a/", "g.txt"}, keys(s3GroupEntries(entries, "", "/")))
+	// Other delimiters work too
+	require.Equal(t, []string{"P:a/b/c.", "P:a/b/d.", "P:a/e.", "P:g."}, keys(s3GroupEntries(entries, "", ".")))
+	require.Empty(t, s3GroupEntries(entries, "x", "/"))
+
+	// Prefixes from shallow listings are kept as is
+	shallow := []s3Entry{{key: "a/b/", prefix: true}, {key: "a/e.txt"}, {key: "a/f/", prefix: true}}
+	require.Equal(t, []string{"P:a/b/", "a/e.txt", "P:a/f/"}, keys(s3GroupEntries(shallow, "a/", "/")))
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/cretz/go-safeclient/client"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// safeFS presents SAFE as a single tree for the file servers. The app area is under /app and the shared area is under
+// /shared. Files are read and written whole since SAFE can't truncate or write sparsely.
+type safeFS struct {
+	c *client.Client
+}
+
+var safeFSAreas = []string{"app", "shared"}
+
+// safeFSPath splits a tree path into its SAFE path and area. The SAFE path is empty for the root of the tree.
+func safeFSPath(name string) (string, bool, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "", false, nil
+	}
+	pieces := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)
+	shared := false
+	switch pieces[0] {
+	case "app":
+	case "shared":
+		shared = true
+	default:
+		return "", false, os.ErrNotExist
+	}
+	if len(pieces) == 1 {
+		return "/", shared, nil
+	}
+	return "/" + pieces[1], shared, nil
+}
+
+// safeFSError converts the error to a *os.PathError, treating launcher rejections as the path not existing
+func safeFSError(op string, name string, err error) error {
+	if client.IsNotExist(err) {
+		err = os.ErrNotExist
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// safeFileInfo is an os.FileInfo for a SAFE file or directory. Sys gives the client.FileInfo or client.DirInfo it came
+// from, or nil for entries that aren't on SAFE.
+type safeFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	sys     interface{}
+}
+
+func dirFileInfo(name string, dir client.DirInfo) *safeFileInfo {
+	return &safeFileInfo{name: name, modTime: dir.ModifiedOn.Time(), dir: true, sys: dir}
+}
+
+func fileFileInfo(file client.FileInfo) *safeFileInfo {
+	return &safeFileInfo{name: file.Name, size: file.LogicalSize(), modTime: file.ModifiedOn.Time(), sys: file}
+}
+
+func (s *safeFileInfo) Name() string       { return s.name }
+func (s *safeFileInfo) Size() int64        { return s.size }
+func (s *safeFileInfo) ModTime() time.Time { return s.modTime }
+func (s *safeFileInfo) IsDir() bool        { return s.dir }
+func (s *safeFileInfo) Sys() interface{}   { return s.sys }
+
+func (s *safeFileInfo) Mode() os.FileMode {
+	if s.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (s *safeFS) stat(name string) (*safeFileInfo, error) {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	} else if safePath == "" {
+		return &safeFileInfo{name: "/", modTime: time.Now(), dir: true}, nil
+	} else if safePath == "/" {
+		dir, err := s.c.GetDir(client.GetDirInfo{DirPath: "/", Shared: shared})
+		if err != nil {
+			return nil, safeFSError("stat", name, err)
+		}
+		return dirFileInfo(path.Base(path.Clean("/"+name)), dir.Info), nil
+	}
+	// Entries are found in their parent's listing since there is no call for a single file
+	parent, err := s.c.GetDir(client.GetDirInfo{DirPath: path.Dir(safePath), Shared: shared})
+	if err != nil {
+		return nil, safeFSError("stat", name, err)
+	}
+	base := path.Base(safePath)
+	for _, dir := range parent.SubDirs {
+		if dir.Name == base {
+			return dirFileInfo(base, dir), nil
+		}
+	}
+	for _, file := range parent.Files {
+		if file.Name == base {
+			return fileFileInfo(file), nil
+		}
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (s *safeFS) readDir(name string) ([]os.FileInfo, error) {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	} else if safePath == "" {
+		infos := []os.FileInfo{}
+		for _, area := range safeFSAreas {
+			info, err := s.stat("/" + area)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+	dir, err := s.c.GetDir(client.GetDirInfo{DirPath: safePath, Shared: shared})
+	if err != nil {
+		return nil, safeFSError("readdir", name, err)
+	}
+	infos := make([]os.FileInfo, 0, len(dir.SubDirs)+len(dir.Files))
+	for _, sub := range dir.SubDirs {
+		infos = append(infos, dirFileInfo(sub.Name, sub))
+	}
+	for _, file := range dir.Files {
+		infos = append(infos, fileFileInfo(file))
+	}
+	return infos, nil
+}
+
+func (s *safeFS) mkdir(name string) error {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	} else if safePath == "" || safePath == "/" {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err = s.c.CreateDir(client.CreateDirInfo{DirPath: safePath, Shared: shared}); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// remove removes a file or a directory and everything under it
+func (s *safeFS) remove(name string) error {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	} else if safePath == "" || safePath == "/" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	info, err := s.stat(name)
+	if err != nil {
+		return err
+	} else if info.dir {
+		err = s.c.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: safePath, Shared: shared})
+	} else {
+		err = s.c.DeleteFile(client.DeleteFileInfo{FilePath: safePath, Shared: shared})
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// rename moves the file or directory to the new path, which must not exist. Moves between directories are done with a
+// move into the new parent and then a rename if the name changed.
+func (s *safeFS) rename(oldName string, newName string) error {
+	oldPath, oldShared, err := safeFSPath(oldName)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+	newPath, newShared, err := safeFSPath(newName)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	} else if oldPath == "" || oldPath == "/" || newPath == "" || newPath == "/" {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrPermission}
+	}
+	info, err := s.stat(oldName)
+	if err != nil {
+		return err
+	}
+	currPath := oldPath
+	if path.Dir(oldPath) != path.Dir(newPath) || oldShared != newShared {
+		if info.dir {
+			err = s.c.MoveDir(client.MoveDirInfo{SrcPath: oldPath, SrcShared: oldShared,
+				DestPath: path.Dir(newPath), DestShared: newShared})
+		} else {
+			err = s.c.MoveFile(client.MoveFileInfo{SrcPath: oldPath, SrcShared: oldShared,
+				DestPath: path.Dir(newPath), DestShared: newShared})
+		}
+		if err != nil {
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+		}
+		currPath = path.Join(path.Dir(newPath), path.Base(oldPath))
+	}
+	if path.Base(currPath) != path.Base(newPath) {
+		if info.dir {
+			err = s.c.ChangeDir(client.ChangeDirInfo{DirPath: currPath, Shared: newShared, NewName: path.Base(newPath)})
+		} else {
+			err = s.c.ChangeFile(client.ChangeFileInfo{FilePath: currPath, Shared: newShared,
+				NewName: path.Base(newPath)})
+		}
+		if err != nil {
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *safeFS) readFile(name string) ([]byte, error) {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	rc, err := s.c.GetFile(client.GetFileInfo{FilePath: safePath, Shared: shared, Decompress: true})
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// writeFile replaces the file with the given contents and metadata, creating it if it doesn't exist. If the metadata
+// says the contents were compressed, e.g. because it came from the file being replaced, they are compressed again. The
+// contents are written atomically so a failure never loses the existing file.
+func (s *safeFS) writeFile(name string, contents []byte, metadata string) error {
+	safePath, shared, err := safeFSPath(name)
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	} else if safePath == "" || safePath == "/" {
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrPermission}
+	}
+	// WriteFile sets the compression metadata for what it actually writes
+	meta := client.ParseMetadata(metadata)
+	compress := meta[client.MetadataCompression] != ""
+	if compress {
+		delete(meta, client.MetadataCompression)
+		delete(meta, client.MetadataLogicalSize)
+		metadata = meta.String()
+	}
+	err = s.c.WriteFileAtomic(client.WriteFileAtomicInfo{
+		FilePath: safePath,
+		Shared:   shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(contents)),
+		Metadata: metadata,
+		Compress: compress,
+	})
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+	return nil
+}
+
+// replaceFile replaces the file with the given contents keeping the metadata of the existing file, which is given by
+// its info or nil if it doesn't exist. The ETag stored by the S3 server is updated for the new contents and the
+// encryption key ID is dropped since the new contents are written unencrypted.
+func (s *safeFS) replaceFile(name string, contents []byte, info *safeFileInfo) error {
+	if info == nil {
+		return s.writeFile(name, contents, "")
+	}
+	meta := client.Metadata{}
+	if file, ok := info.sys.(client.FileInfo); ok {
+		meta = client.ParseMetadata(file.Metadata)
+	}
+	if meta[s3MetadataETag] != "" {
+		sum := md5.Sum(contents)
+		meta[s3MetadataETag] = hex.EncodeToString(sum[:])
+	}
+	delete(meta, client.MetadataEncryptionKeyID)
+	return s.writeFile(name, contents, meta.String())
+}
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+)
+
+var sftpAddr string
+var sftpAuthorizedKeys string
+var sftpHostKey string
+
+var sftpCmd = &cobra.Command{
+	Use:   "sftp",
+	Short: "Serve the SAFE drive over SFTP",
+	Long: `Serve the SAFE drive over SFTP until interrupted.
+
+The app area is at /app and the shared area is at /shared. Clients authenticate with a public key from the
+authorized keys file. If no host key is given, a new one is generated each run and its fingerprint is logged.
+
+File attributes can't be set on SAFE, so requests to change them succeed without doing anything. Files can only be
+truncated to empty.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		if sftpAuthorizedKeys == "" {
+			return errors.New("Authorized keys file required")
+		}
+		config, err := sftpServerConfig()
+		if err != nil {
+			log.Fatalf("Invalid SSH config: %v", err)
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		listener, err := net.Listen("tcp", sftpAddr)
+		if err != nil {
+			log.Fatalf("Unable to listen: %v", err)
+		}
+		log.Printf("Serving SFTP on %v", sftpAddr)
+		handler := &sftpHandler{fs: &safeFS{c: c}}
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Fatalf("Failed to accept: %v", err)
+			}
+			go sftpServeConn(conn, config, handler)
+		}
+	},
+}
+
+// sftpServerConfig builds the SSH config from the authorized keys and host key files
+func sftpServerConfig() (*ssh.ServerConfig, error) {
+	byts, err := ioutil.ReadFile(sftpAuthorizedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read authorized keys: %v", err)
+	}
+	authorized := map[string]bool{}
+	for len(bytes.TrimSpace(byts)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(byts)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid authorized keys: %v", err)
+		}
+		authorized[string(key.Marshal())] = true
+		byts = rest
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorized[string(key.Marshal())] {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("Unknown public key for %v", meta.User())
+		},
+	}
+	var signer ssh.Signer
+	if sftpHostKey == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		if signer, err = ssh.NewSignerFromKey(key); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated host key with fingerprint %v", ssh.FingerprintSHA256(signer.PublicKey()))
+	} else {
+		if byts, err = ioutil.ReadFile(sftpHostKey); err != nil {
+			return nil, fmt.Errorf("Unable to read host key: %v", err)
+		}
+		if signer, err = ssh.ParsePrivateKey(byts); err != nil {
+			return nil, fmt.Errorf("Invalid host key: %v", err)
+		}
+	}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+// sftpServeConn runs the SFTP subsystem for each session on the connection
+func sftpServeConn(conn net.Conn, config *ssh.ServerConfig, handler *sftpHandler) {
+	serverConn, channels, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		log.Printf("SSH handshake with %v failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("Unable to accept channel from %v: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// The payload is the length prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server := sftp.NewRequestServer(channel, sftp.Handlers{
+					FileGet:  handler,
+					FilePut:  handler,
+					FileCmd:  handler,
+					FileList: handler,
+				})
+				if err := server.Serve(); err != nil && err != io.EOF {
+					log.Printf("SFTP session for %v failed: %v", serverConn.User(), err)
+				}
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// sftpHandler implements the SFTP request handlers on top of safeFS
+type sftpHandler struct {
+	fs *safeFS
+}
+
+func (s *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	info, err := s.fs.stat(r.Filepath)
+	if err != nil {
+		return nil, err
+	} else if info.dir {
+		return nil, &os.PathError{Op: "open", Path: r.Filepath, Err: errors.New("Is a directory")}
+	}
+	safePath, shared, _ := safeFSPath(r.Filepath)
+	file := info.sys.(client.FileInfo)
+	return &sftpReader{
+		c:        s.fs.c,
+		filePath: safePath,
+		shared:   shared,
+		size:     info.size,
+		// Only compressed files need the extra metadata lookup decompression costs
+		decompress: client.ParseMetadata(file.Metadata)[client.MetadataCompression] != "",
+	}, nil
+}
+
+func (s *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	flags := r.Pflags()
+	safePath, shared, err := safeFSPath(r.Filepath)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: r.Filepath, Err: err}
+	}
+	info, err := s.fs.stat(r.Filepath)
+	if os.IsNotExist(err) && flags.Creat {
+		err = s.fs.replaceFile(r.Filepath, nil, nil)
+	} else if err == nil && flags.Creat && flags.Excl {
+		err = &os.PathError{Op: "open", Path: r.Filepath, Err: os.ErrExist}
+	} else if err == nil && info.dir {
+		err = &os.PathError{Op: "open", Path: r.Filepath, Err: errors.New("Is a directory")}
+	} else if err == nil && flags.Trunc && info.size > 0 {
+		err = s.fs.replaceFile(r.Filepath, nil, info)
+	} else if err == nil && client.ParseMetadata(info.sys.(client.FileInfo).Metadata)[client.MetadataCompression] != "" {
+		// Writing at offsets would write into the compressed bytes
+		err = &os.PathError{Op: "open", Path: r.Filepath, Err: errors.New("Compressed files can only be truncated")}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Writes to an existing file that wasn't truncated may continue from its end, e.g. to append or resume
+	offset := int64(0)
+	if info != nil && !flags.Trunc {
+		offset = info.size
+	}
+	return &sftpWriter{c: s.fs.c, filePath: safePath, shared: shared, offset: offset, pending: map[int64][]byte{}}, nil
+}
+
+func (s *sftpHandler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return s.setstat(r)
+	case "Rename":
+		return s.fs.rename(r.Filepath, r.Target)
+	case "Mkdir":
+		return s.fs.mkdir(r.Filepath)
+	case "Rmdir":
+		infos, err := s.fs.readDir(r.Filepath)
+		if err != nil {
+			return err
+		} else if len(infos) > 0 {
+			return &os.PathError{Op: "rmdir", Path: r.Filepath, Err: errors.New("Directory not empty")}
+		}
+		return s.fs.remove(r.Filepath)
+	case "Remove":
+		info, err := s.fs.stat(r.Filepath)
+		if err != nil {
+			return err
+		} else if info.dir {
+			return &os.PathError{Op: "remove", Path: r.Filepath, Err: errors.New("Is a directory")}
+		}
+		return s.fs.remove(r.Filepath)
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// PosixRename is like Rename except an existing file at the target is replaced
+func (s *sftpHandler) PosixRename(r *sftp.Request) error {
+	info, err := s.fs.stat(r.Target)
+	if err == nil && !info.dir {
+		err = s.fs.remove(r.Target)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.fs.rename(r.Filepath, r.Target)
+}
+
+// setstat ignores everything but truncating to empty, which is the only size change SAFE can do
+func (s *sftpHandler) setstat(r *sftp.Request) error {
+	info, err := s.fs.stat(r.Filepath)
+	if err != nil || !r.AttrFlags().Size || info.dir || int64(r.Attributes().Size) == info.size {
+		return err
+	} else if r.Attributes().Size != 0 {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	return s.fs.replaceFile(r.Filepath, nil, info)
+}
+
+func (s *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		infos, err := s.fs.readDir(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(sftpFileInfos(infos))
+		return sftpLister(infos), nil
+	case "Stat":
+		info, err := s.fs.stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return sftpLister{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+type sftpFileInfos []os.FileInfo
+
+func (s sftpFileInfos) Len() int           { return len(s) }
+func (s sftpFileInfos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sftpFileInfos) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+
+type sftpLister []os.FileInfo
+
+func (s sftpLister) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(s)) {
+		return 0, io.EOF
+	}
+	n := copy(infos, s[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// sftpReadAhead is how much sftpReader gets from SAFE at once since clients read in small packets
+const sftpReadAhead = 1024 * 1024
+
+// sftpReader reads the ranges of a file that are asked for. Each read from SAFE gets more than was asked for to serve
+// the reads after it. Compressed files can't be read at an offset, so they are decompressed whole on the first read.
+type sftpReader struct {
+	c          *client.Client
+	filePath   string
+	shared     bool
+	size       int64
+	decompress bool
+	lock       sync.Mutex
+	// The offset buf starts at
+	offset int64
+	buf    []byte
+}
+
+func (s *sftpReader) ReadAt(p []byte, off int64) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for n < len(p) && off+int64(n) < s.size {
+		pos := off + int64(n)
+		if pos < s.offset || pos >= s.offset+int64(len(s.buf)) {
+			if err := s.load(pos); err != nil {
+				return n, err
+			} else if pos >= s.offset+int64(len(s.buf)) {
+				// It's shorter than it was when opened
+				break
+			}
+		}
+		n += copy(p[n:], s.buf[pos-s.offset:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *sftpReader) load(off int64) error {
+	info := client.GetFileInfo{FilePath: s.filePath, Shared: s.shared, Offset: off, Length: sftpReadAhead}
+	if s.decompress {
+		info = client.GetFileInfo{FilePath: s.filePath, Shared: s.shared, Decompress: true}
+		off = 0
+	}
+	rc, err := s.c.GetFile(info)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	byts, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	s.offset, s.buf = off, byts
+	return nil
+}
+
+// sftpWriter writes to SAFE at offsets in chunks. Clients may send writes out of order, so writes past what has been
+// received so far are held until the gap is filled. SAFE can't write past the end of a file, so a gap still open at
+// close fails the write. For existing files, what has been received so far starts out as the whole file.
+type sftpWriter struct {
+	c        *client.Client
+	filePath string
+	shared   bool
+	lock     sync.Mutex
+	// The offset buf starts at
+	offset  int64
+	buf     []byte
+	pending map[int64][]byte
+}
+
+func (s *sftpWriter) WriteAt(p []byte, off int64) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if off < s.offset {
+		// Rewriting what was already written only needs a flush of what is buffered first
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+		return len(p), s.write(p, off)
+	} else if off > s.offset+int64(len(s.buf)) {
+		s.pending[off] = append([]byte{}, p...)
+		return len(p), nil
+	}
+	// It starts within or right after the buffer, so it overwrites what it overlaps and adds the rest
+	copied := copy(s.buf[off-s.offset:], p)
+	s.buf = append(s.buf, p[copied:]...)
+	// Held writes that now start within the buffer add whatever they have past it
+	for merged := true; merged; {
+		merged = false
+		for pendingOff, pendingBytes := range s.pending {
+			end := s.offset + int64(len(s.buf))
+			if pendingOff > end {
+				continue
+			}
+			delete(s.pending, pendingOff)
+			if pendingOff+int64(len(pendingBytes)) > end {
+				s.buf = append(s.buf, pendingBytes[end-pendingOff:]...)
+			}
+			merged = true
+		}
+	}
+	if len(s.buf) >= client.DefaultUploadChunkSize {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (s *sftpWriter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	if err := s.write(s.buf, s.offset); err != nil {
+		return err
+	}
+	s.offset += int64(len(s.buf))
+	s.buf = nil
+	return nil
+}
+
+func (s *sftpWriter) write(p []byte, off int64) error {
+	return s.c.WriteFile(client.WriteFileInfo{
+		FilePath: s.filePath,
+		Shared:   s.shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(p)),
+		Offset:   off,
+	})
+}
+
+// Close writes what is left
+func (s *sftpWriter) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	} else if len(s.pending) > 0 {
+		return fmt.Errorf("Unable to write %v: writes left a gap at offset %v", s.filePath, s.offset)
+	}
+	return nil
+}
+
+func init() {
+	sftpCmd.Flags().StringVar(&sftpAddr, "addr", "localhost:2222", "Address to listen on")
+	sftpCmd.Flags().StringVar(&sftpAuthorizedKeys, "authorized-keys", "", "File of public keys allowed to connect")
+	sftpCmd.Flags().StringVar(&sftpHostKey, "host-key", "", "Private key file to identify the server with")
+	RootCmd.AddCommand(sftpCmd)
+}
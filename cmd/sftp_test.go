@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSftpWriterAppend(t *testing.T) {
+	// A launcher with a single 5 byte file at /f.txt that records writes to it
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/nfs/directory/"):
+			json.NewEncoder(w).Encode(client.DirResponse{
+				Info:  client.DirInfo{Name: "/"},
+				Files: client.Files{{Name: "f.txt", Size: 5}},
+			})
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/nfs/file/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			writes = append(writes, r.URL.Query().Get("offset")+":"+string(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c := client.NewClient(client.Conf{LauncherBaseURL: server.URL})
+	buildRequest, handleResponse := c.RequestBuilder, c.ResponseHandler
+	c.RequestBuilder = func(c *client.Client, req *client.Request) (*http.Request, error) {
+		req.DoNotEncrypt = true
+		return buildRequest(c, req)
+	}
+	c.ResponseHandler = func(c *client.Client, resp *http.Response, decrypt bool, jsonResponse interface{}) error {
+		return handleResponse(c, resp, false, jsonResponse)
+	}
+	h := &sftpHandler{fs: &safeFS{c: c}}
+
+	// Writes continue from the end of the file, even out of order
+	req := sftp.NewRequest("Put", "/app/f.txt")
+	req.Flags = 0x02 | 0x04 // write|append
+	writer, err := h.Filewrite(req)
+	require.NoError(t, err)
+	_, err = writer.WriteAt([]byte("de"), 8)
+	require.NoError(t, err)
+	_, err = writer.WriteAt([]byte("abc"), 5)
+	require.NoError(t, err)
+	require.NoError(t, writer.(io.Closer).Close())
+	require.Equal(t, []string{"5:abcde"}, writes)
+
+	// Writes within the existing contents write over them
+	writes = nil
+	req.Flags = 0x02 // write
+	writer, err = h.Filewrite(req)
+	require.NoError(t, err)
+	_, err = writer.WriteAt([]byte("X"), 1)
+	require.NoError(t, err)
+	require.NoError(t, writer.(io.Closer).Close())
+	require.Equal(t, []string{"1:X"}, writes)
+}
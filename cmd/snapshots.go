@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+var snapshotsShared bool
+var snapshotsHuman bool
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots [dir]",
+	Short: "List backup snapshots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		snapshots, err := c.BackupSnapshots(client.BackupSnapshotsInfo{DirPath: args[0], Shared: snapshotsShared})
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Time", "Entries", "Size", "Source"})
+		table.SetBorder(false)
+		table.SetCenterSeparator(" ")
+		table.SetColumnSeparator(" ")
+		table.SetAutoFormatHeaders(false)
+		for _, snapshot := range snapshots {
+			table.Append([]string{snapshot.ID, snapshot.Time.Local().Format(time.RFC822),
+				strconv.Itoa(len(snapshot.Entries)), formatSize(snapshot.Size(), snapshotsHuman), snapshot.Source})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	snapshotsCmd.Flags().BoolVarP(&snapshotsShared, "shared", "s", false, "Use shared area for user/app")
+	snapshotsCmd.Flags().BoolVar(&snapshotsHuman, "human", false, "Show sizes in human readable units")
+	RootCmd.AddCommand(snapshotsCmd)
+}
@@ -11,23 +11,25 @@ var touchShared bool
 var touchMetadata string
 
 var touchCmd = &cobra.Command{
-	Use:   "touch [file path]",
+	Use:   "touch [file path...]",
 	Short: "Create empty file",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("One and only one argument allowed")
+		if len(args) == 0 {
+			return errors.New("At least one argument required")
 		}
 		c, err := getClient()
 		if err != nil {
 			log.Fatalf("Unable to obtain client: %v", err)
 		}
-		info := client.CreateFileInfo{
-			FilePath: args[0],
-			Shared:   touchShared,
-			Metadata: touchMetadata,
-		}
-		if err = c.CreateFile(info); err != nil {
-			log.Fatalf("Failed to create file: %v", err)
+		for _, filePath := range args {
+			info := client.CreateFileInfo{
+				FilePath: filePath,
+				Shared:   touchShared,
+				Metadata: touchMetadata,
+			}
+			if err = c.CreateFile(info); err != nil {
+				log.Fatalf("Failed to create file %v: %v", filePath, err)
+			}
 		}
 		return nil
 	},
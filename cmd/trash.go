@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"time"
+)
+
+var trashShared bool
+var trashTo string
+var trashOlderThan string
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore and purge trashed files and directories",
+	Long: `List, restore and purge files and directories deleted with "rm --trash" or "rmdir --trash".
+
+Trashed entries are copied to /.trash/<id>/<original path> before being deleted. Entries older than 30 days are purged
+whenever something else is trashed.`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trashed entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		entries, err := c.ListTrash(client.ListTrashInfo{Shared: trashShared})
+		if err != nil {
+			log.Fatalf("Failed to list trash: %v", err)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Time", "Path"})
+		table.SetBorder(false)
+		table.SetCenterSeparator(" ")
+		table.SetColumnSeparator(" ")
+		table.SetAutoFormatHeaders(false)
+		for _, entry := range entries {
+			entryPath := entry.Path
+			if entry.Dir {
+				entryPath += "/"
+			}
+			table.Append([]string{entry.ID, entry.Time.Local().Format(time.RFC822), entryPath})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore [id]",
+	Short: "Restore trashed entry to where it was",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		entry, err := c.RestoreTrash(client.RestoreTrashInfo{ID: args[0], Shared: trashShared, DestPath: trashTo})
+		if err != nil {
+			log.Fatalf("Failed to restore: %v", err)
+		}
+		if trashTo != "" {
+			fmt.Printf("Restored %v to %v\n", entry.Path, trashTo)
+		} else {
+			fmt.Printf("Restored %v\n", entry.Path)
+		}
+		return nil
+	},
+}
+
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently delete trashed entries",
+	Long: `Permanently delete trashed entries older than --older-than, which defaults to the 30 days entries are kept for
+anyway. Use --older-than=0s to empty the trash.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		olderThan, err := parseAge(trashOlderThan)
+		if err != nil {
+			return errors.New("Older than must be a duration or a number of days like 30d")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		purged, err := c.PurgeTrash(client.PurgeTrashInfo{Shared: trashShared, OlderThan: olderThan})
+		for _, entry := range purged {
+			fmt.Printf("Purged %v %v\n", entry.ID, entry.Path)
+		}
+		if err != nil {
+			log.Fatalf("Failed to purge: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	trashCmd.PersistentFlags().BoolVarP(&trashShared, "shared", "s", false, "Use shared area for user/app")
+	trashRestoreCmd.Flags().StringVar(&trashTo, "to", "", "Restore to this path instead of the original one")
+	trashPurgeCmd.Flags().StringVar(&trashOlderThan, "older-than", "30d", "Only purge entries trashed longer ago than this, 0s for all")
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashPurgeCmd)
+	RootCmd.AddCommand(trashCmd)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+var treeShared bool
+var treeLevel int
+var treeHuman bool
+
+var treeCmd = &cobra.Command{
+	Use:   "tree [dir]",
+	Short: "Show directory hierarchy with sizes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		tree, err := c.LoadDirTree(client.LoadDirTreeInfo{DirPath: args[0], Shared: treeShared, MaxDepth: treeLevel})
+		if err != nil {
+			log.Fatalf("Failed to load dir: %v", err)
+		}
+		fmt.Printf("%v %v\n", tree.Path, treeDirLabel(tree))
+		writeTree(os.Stdout, tree, "")
+		fmt.Printf("\n%v directories, %v files\n", treeDirCount(tree), tree.FileCount())
+		return nil
+	},
+}
+
+func writeTree(w io.Writer, tree *client.DirTree, prefix string) {
+	count := len(tree.SubDirs) + len(tree.Files)
+	index := 0
+	// Directories are listed first
+	for _, sub := range tree.SubDirs {
+		index++
+		branch, childPrefix := treeBranch(index == count)
+		fmt.Fprintf(w, "%v%v%v/ %v\n", prefix, branch, sub.Info.Name, treeDirLabel(sub))
+		writeTree(w, sub, prefix+childPrefix)
+	}
+	for _, file := range tree.Files {
+		index++
+		branch, _ := treeBranch(index == count)
+		fmt.Fprintf(w, "%v%v%v [%v]\n", prefix, branch, file.Name, formatSize(file.LogicalSize(), treeHuman))
+	}
+}
+
+func treeBranch(last bool) (string, string) {
+	if last {
+		return "└── ", "    "
+	}
+	return "├── ", "│   "
+}
+
+func treeDirLabel(tree *client.DirTree) string {
+	labels := []string{}
+	if tree.Loaded {
+		labels = append(labels, formatSize(tree.Size(), treeHuman))
+	} else {
+		labels = append(labels, "not loaded")
+	}
+	if tree.Info.Private {
+		labels = append(labels, "private")
+	}
+	if tree.Info.Versioned {
+		labels = append(labels, "versioned")
+	}
+	return "[" + strings.Join(labels, ", ") + "]"
+}
+
+func treeDirCount(tree *client.DirTree) int {
+	count := len(tree.SubDirs)
+	for _, sub := range tree.SubDirs {
+		count += treeDirCount(sub)
+	}
+	return count
+}
+
+func init() {
+	treeCmd.Flags().BoolVarP(&treeShared, "shared", "s", false, "Use shared area for user/app")
+	treeCmd.Flags().IntVarP(&treeLevel, "level", "L", 0, "Max depth of directories to descend into (0 for no limit)")
+	treeCmd.Flags().BoolVar(&treeHuman, "human", false, "Show sizes in human readable units")
+	RootCmd.AddCommand(treeCmd)
+}
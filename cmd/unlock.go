@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var unlockShared bool
+var unlockToken string
+var unlockForce bool
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock [file path]",
+	Short: "Release a lock",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		} else if unlockToken == "" && !unlockForce {
+			return errors.New("Token or force required")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		info := client.UnlockInfo{
+			FilePath: args[0],
+			Shared:   unlockShared,
+			Token:    unlockToken,
+			Force:    unlockForce,
+		}
+		if err = c.Unlock(info); err != nil {
+			log.Fatalf("Failed to unlock: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	unlockCmd.Flags().BoolVarP(&unlockShared, "shared", "s", false, "Use shared area for user/app")
+	unlockCmd.Flags().StringVar(&unlockToken, "token", "", "Token printed when the lock was taken")
+	unlockCmd.Flags().BoolVarP(&unlockForce, "force", "f", false, "Release the lock whoever holds it")
+	RootCmd.AddCommand(unlockCmd)
+}
@@ -1,33 +1,88 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
 	"github.com/cretz/go-safeclient/client"
 	"github.com/olekukonko/tablewriter"
 	"io"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 func writeDirResponseTable(writer io.Writer, dir client.DirResponse) {
 	table := tablewriter.NewWriter(writer)
-	table.SetHeader([]string{"Name", "Size", "Created On", "Modified On"})
+	table.SetHeader([]string{"Name", "Size", "Logical Size", "Created On", "Modified On"})
 	table.SetBorder(false)
 	table.SetCenterSeparator(" ")
 	table.SetColumnSeparator(" ")
 	table.SetAutoFormatHeaders(false)
-	table.Append([]string{"./", "",
+	table.Append([]string{"./", "", "",
 		dir.Info.CreatedOn.Time().Format(time.RFC822), dir.Info.ModifiedOn.Time().Format(time.RFC822)})
 	// Sort the things first
 	sort.Sort(dir.SubDirs)
 	for _, sub := range dir.SubDirs {
-		table.Append([]string{sub.Name + "/", "",
+		table.Append([]string{sub.Name + "/", "", "",
 			sub.CreatedOn.Time().Format(time.RFC822), sub.ModifiedOn.Time().Format(time.RFC822)})
 	}
 	sort.Sort(dir.Files)
 	for _, file := range dir.Files {
-		table.Append([]string{file.Name, strconv.FormatInt(file.Size, 10),
+		table.Append([]string{file.Name, strconv.FormatInt(file.Size, 10), strconv.FormatInt(file.LogicalSize(), 10),
 			file.CreatedOn.Time().Format(time.RFC822), file.ModifiedOn.Time().Format(time.RFC822)})
 	}
 	table.Render()
 }
+
+// archiveFormat gives "tar" or "zip" from the explicit format if given, otherwise the file extension
+func archiveFormat(format string, filePath string) (string, error) {
+	switch format {
+	case "tar", "zip":
+		return format, nil
+	case "":
+		if strings.ToLower(filepath.Ext(filePath)) == ".zip" {
+			return "zip", nil
+		}
+		return "tar", nil
+	default:
+		return "", fmt.Errorf("Unknown archive format: %v", format)
+	}
+}
+
+// formatSize gives the size in bytes or, if human is true, in the largest unit that fits (e.g. 1.5K)
+func formatSize(size int64, human bool) string {
+	if !human || size < 1024 {
+		return strconv.FormatInt(size, 10)
+	}
+	value := float64(size)
+	for _, unit := range []string{"K", "M", "G", "T"} {
+		value /= 1024
+		if value < 1024 || unit == "T" {
+			return strconv.FormatFloat(value, 'f', 1, 64) + unit
+		}
+	}
+	return ""
+}
+
+// confirm asks a yes or no question on stderr and reads the answer from stdin. Anything but y or yes is no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%v [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// parseAge parses a duration that may also be a whole number of days such as 30d
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("Invalid number of days: %v", age)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(age)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+var versionsShared bool
+var versionsVersion int64
+var versionsSave bool
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions [dir]",
+	Short: "List prior versions of a versioned directory",
+	Long: `List the saved prior versions of a directory, or with --version, the files in one of them.
+
+The launcher doesn't give access to the history of versioned directories, so the CLI keeps it itself: when run with
+--versioning, before changing a file in a directory created with "mkdir --versioned", the directory's files are saved
+as a new version in its .versions subdirectory. Fetch a file from a version with "fetch --version".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("One and only one argument allowed")
+		} else if versionsSave && versionsVersion != 0 {
+			return errors.New("Can't save and show a version at the same time")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		if versionsSave {
+			if err = c.SaveVersion(client.SaveVersionInfo{DirPath: args[0], Shared: versionsShared}); err != nil {
+				log.Fatalf("Failed to save version: %v", err)
+			}
+			return nil
+		}
+		if versionsVersion != 0 {
+			info := client.GetDirAtVersionInfo{DirPath: args[0], Shared: versionsShared, Version: versionsVersion}
+			dir, err := c.GetDirAtVersion(info)
+			if err != nil {
+				log.Fatalf("Failed to get version: %v", err)
+			}
+			writeDirResponseTable(os.Stdout, dir)
+			return nil
+		}
+		versions, err := c.ListVersions(client.ListVersionsInfo{DirPath: args[0], Shared: versionsShared})
+		if err != nil {
+			log.Fatalf("Failed to list versions: %v", err)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Version", "Time"})
+		table.SetBorder(false)
+		table.SetCenterSeparator(" ")
+		table.SetColumnSeparator(" ")
+		table.SetAutoFormatHeaders(false)
+		for _, version := range versions {
+			table.Append([]string{strconv.FormatInt(version.Version, 10), version.Time.Local().Format(time.RFC822)})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	versionsCmd.Flags().BoolVarP(&versionsShared, "shared", "s", false, "Use shared area for user/app")
+	versionsCmd.Flags().Int64Var(&versionsVersion, "version", 0, "Show the files in this version")
+	versionsCmd.Flags().BoolVar(&versionsSave, "save", false, "Save the directory's files as a new version now")
+	RootCmd.AddCommand(versionsCmd)
+}
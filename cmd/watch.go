@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var watchShared bool
+var watchDebounce time.Duration
+var watchRetry time.Duration
+var watchInitial bool
+var watchIgnore []string
+var watchAtomic bool
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [local dir] [dir]",
+	Short: "Publish local directory changes as they happen",
+	Long: `Watch a local directory and publish every change to an existing SAFE directory until interrupted.
+
+Bursts of changes are collected until nothing has changed for the debounce time and then published together. Files
+renamed within a directory are renamed on SAFE instead of uploaded again. Changes that fail to publish, e.g. while the
+launcher is down, are retried with backoff until they succeed. Unless --initial=false, the SAFE directory is first
+brought up to date with the local one.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Exactly two arguments required for local and SAFE directories")
+		}
+		for _, pattern := range watchIgnore {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return errors.New("Invalid ignore pattern: " + pattern)
+			}
+		}
+		if stat, err := os.Stat(args[0]); err != nil || !stat.IsDir() {
+			return errors.New("Local path must be a directory")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Fatalf("Unable to watch: %v", err)
+		}
+		defer watcher.Close()
+		if err = runWatch(c, watcher, args[0], args[1]); err != nil {
+			log.Fatalf("Failed to watch: %v", err)
+		}
+		return nil
+	},
+}
+
+func runWatch(c *client.Client, watcher *fsnotify.Watcher, localRoot string, safeRoot string) error {
+	publisher, err := c.NewPublisher(client.PublisherInfo{
+		LocalDirPath: localRoot,
+		DirPath:      safeRoot,
+		Shared:       watchShared,
+		Ignore:       watchIgnore,
+		Atomic:       watchAtomic,
+	})
+	if err != nil {
+		return err
+	}
+	// Watch before reading anything local so no change is missed
+	if err = watchDir(watcher, publisher, localRoot); err != nil {
+		return err
+	}
+	if watchInitial {
+		if err = publisher.QueueAll(); err != nil {
+			return err
+		}
+		watchPublish(publisher)
+	}
+	log.Printf("Watching %v", localRoot)
+	var debounceC, retryC <-chan time.Time
+	if publisher.Retrying() {
+		retryC = time.After(watchRetryDelay(publisher))
+	}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			relPath := publisher.RelPath(event.Name)
+			if relPath == "" || publisher.Ignored(relPath) {
+				continue
+			}
+			publisher.Queue(relPath)
+			// New directories may have gotten contents before being watched
+			if event.Op&fsnotify.Create != 0 {
+				if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+					if err = watchDir(watcher, publisher, event.Name); err != nil {
+						log.Printf("Unable to watch %v: %v", event.Name, err)
+					} else if err = publisher.QueueDir(event.Name); err != nil {
+						log.Printf("Unable to read %v: %v", event.Name, err)
+					}
+				}
+			}
+			debounceC = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Watch error: %v", err)
+		case <-debounceC:
+			debounceC = nil
+			watchPublish(publisher)
+			if publisher.Retrying() && retryC == nil {
+				retryC = time.After(watchRetryDelay(publisher))
+			}
+		case <-retryC:
+			retryC = nil
+			watchPublish(publisher)
+			if publisher.Retrying() {
+				retryC = time.After(watchRetryDelay(publisher))
+			}
+		}
+	}
+}
+
+// watchRetryDelay doubles the retry time for each consecutive failed publish up to 32 times the retry time
+func watchRetryDelay(publisher *client.Publisher) time.Duration {
+	shift := uint(publisher.Failures() - 1)
+	if shift > 5 {
+		shift = 5
+	}
+	return watchRetry << shift
+}
+
+// watchDir watches the local directory and every directory under it that isn't ignored
+func watchDir(watcher *fsnotify.Watcher, publisher *client.Publisher, localPath string) error {
+	return filepath.Walk(localPath, func(entryPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !info.IsDir() {
+			return nil
+		} else if relPath := publisher.RelPath(entryPath); relPath != "" && publisher.Ignored(relPath) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(entryPath)
+	})
+}
+
+func watchPublish(publisher *client.Publisher) {
+	for _, event := range publisher.Publish() {
+		name := event.Path
+		if event.Dir {
+			name += "/"
+		}
+		switch event.Type {
+		case client.PublishWritten:
+			log.Printf("Published %v", name)
+		case client.PublishDeleted:
+			log.Printf("Deleted %v", name)
+		case client.PublishRenamed:
+			log.Printf("Renamed %v to %v", event.OldPath, name)
+		case client.PublishFailed:
+			log.Printf("Failed to publish %v, will retry: %v", name, event.Err)
+		}
+	}
+}
+
+func init() {
+	watchCmd.Flags().BoolVarP(&watchShared, "shared", "s", false, "Use shared area for user/app")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond, "How long to wait for changes to stop before publishing")
+	watchCmd.Flags().DurationVar(&watchRetry, "retry", 5*time.Second, "How long to wait before retrying failed changes")
+	watchCmd.Flags().BoolVar(&watchInitial, "initial", true, "Publish differences when starting")
+	watchCmd.Flags().StringSliceVar(&watchIgnore, "ignore", nil, "Local file name patterns to never publish (e.g. *.swp)")
+	watchCmd.Flags().BoolVar(&watchAtomic, "atomic", true, "Write files to a temp file and swap it in so they are never seen partially written")
+	RootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/webdav"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+var webdavAddr string
+
+var webdavCmd = &cobra.Command{
+	Use:   "webdav",
+	Short: "Serve the SAFE drive over WebDAV",
+	Long: `Serve the SAFE drive over WebDAV until interrupted so it can be mounted as a network drive.
+
+The app area is at /app and the shared area is at /shared. Files are held in memory while open and written to SAFE
+when closed. There is no authentication, so only listen on addresses others can't reach.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("No arguments allowed")
+		}
+		c, err := getClient()
+		if err != nil {
+			log.Fatalf("Unable to obtain client: %v", err)
+		}
+		handler := &webdav.Handler{
+			FileSystem: &webdavFS{fs: &safeFS{c: c}},
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(req *http.Request, err error) {
+				if err != nil && !os.IsNotExist(err) {
+					log.Printf("%v %v failed: %v", req.Method, req.URL.Path, err)
+				}
+			},
+		}
+		log.Printf("Serving WebDAV on %v", webdavAddr)
+		if err = http.ListenAndServe(webdavAddr, handler); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+		return nil
+	},
+}
+
+// webdavFS is a webdav.FileSystem on top of safeFS
+type webdavFS struct {
+	fs *safeFS
+}
+
+func (w *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return w.fs.mkdir(name)
+}
+
+func (w *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	info, err := w.fs.stat(name)
+	if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+		// Created on close like any other write
+		return &webdavFile{fs: w.fs, name: name, flag: flag, loaded: true, dirty: true}, nil
+	} else if err != nil {
+		return nil, err
+	} else if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	} else if info.dir && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("Is a directory")}
+	}
+	file := &webdavFile{fs: w.fs, name: name, info: info, flag: flag}
+	if flag&os.O_TRUNC != 0 && !info.dir {
+		file.loaded, file.dirty = true, true
+	}
+	return file, nil
+}
+
+func (w *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	return w.fs.remove(name)
+}
+
+func (w *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	return w.fs.rename(oldName, newName)
+}
+
+func (w *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return w.fs.stat(name)
+}
+
+// webdavFile is a webdav.File for a SAFE file or directory. File contents are only fetched once read or written.
+type webdavFile struct {
+	fs   *safeFS
+	name string
+	// Nil if the file doesn't exist yet
+	info     *safeFileInfo
+	flag     int
+	contents []byte
+	loaded   bool
+	dirty    bool
+	offset   int64
+	entries  []os.FileInfo
+	listed   bool
+}
+
+func (w *webdavFile) load() error {
+	if w.loaded {
+		return nil
+	} else if w.info.dir {
+		return &os.PathError{Op: "read", Path: w.name, Err: errors.New("Is a directory")}
+	}
+	contents, err := w.fs.readFile(w.name)
+	if err != nil {
+		return err
+	}
+	w.contents, w.loaded = contents, true
+	return nil
+}
+
+func (w *webdavFile) size() int64 {
+	if w.loaded {
+		return int64(len(w.contents))
+	}
+	return w.info.size
+}
+
+func (w *webdavFile) Read(p []byte) (int, error) {
+	if err := w.load(); err != nil {
+		return 0, err
+	}
+	if w.offset >= int64(len(w.contents)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.contents[w.offset:])
+	w.offset += int64(n)
+	return n, nil
+}
+
+func (w *webdavFile) Write(p []byte) (int, error) {
+	if w.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &os.PathError{Op: "write", Path: w.name, Err: os.ErrPermission}
+	} else if err := w.load(); err != nil {
+		return 0, err
+	}
+	if w.flag&os.O_APPEND != 0 {
+		w.offset = int64(len(w.contents))
+	}
+	if end := w.offset + int64(len(p)); end > int64(len(w.contents)) {
+		w.contents = append(w.contents, make([]byte, end-int64(len(w.contents)))...)
+	}
+	copy(w.contents[w.offset:], p)
+	w.offset += int64(len(p))
+	w.dirty = true
+	return len(p), nil
+}
+
+func (w *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += w.offset
+	case io.SeekEnd:
+		offset += w.size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: w.name, Err: errors.New("Negative offset")}
+	}
+	w.offset = offset
+	return offset, nil
+}
+
+func (w *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	if w.info == nil || !w.info.dir {
+		return nil, &os.PathError{Op: "readdir", Path: w.name, Err: errors.New("Not a directory")}
+	}
+	if !w.listed {
+		entries, err := w.fs.readDir(w.name)
+		if err != nil {
+			return nil, err
+		}
+		w.entries, w.listed = entries, true
+	}
+	if count <= 0 {
+		entries := w.entries
+		w.entries = nil
+		return entries, nil
+	} else if len(w.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(w.entries) {
+		count = len(w.entries)
+	}
+	entries := w.entries[:count]
+	w.entries = w.entries[count:]
+	return entries, nil
+}
+
+func (w *webdavFile) Stat() (os.FileInfo, error) {
+	if w.info != nil && !w.dirty {
+		return w.info, nil
+	}
+	return &safeFileInfo{name: path.Base(path.Clean("/" + w.name)), size: w.size(), modTime: time.Now()}, nil
+}
+
+// Close writes the contents to SAFE if they changed
+func (w *webdavFile) Close() error {
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.fs.replaceFile(w.name, w.contents, w.info)
+}
+
+func init() {
+	webdavCmd.Flags().StringVar(&webdavAddr, "addr", "localhost:8080", "Address to listen on")
+	RootCmd.AddCommand(webdavCmd)
+}
@@ -0,0 +1,81 @@
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestArchiveTarRoundTrip(t *testing.T) {
+	testArchiveRoundTrip(t, func(buf *bytes.Buffer, dirPath string) error {
+		return safeClient.ExportTar(buf, client.ExportInfo{DirPath: dirPath})
+	}, func(buf *bytes.Buffer, dirPath string) error {
+		return safeClient.ImportTar(buf, client.ImportInfo{DirPath: dirPath})
+	})
+}
+
+func TestArchiveZipRoundTrip(t *testing.T) {
+	testArchiveRoundTrip(t, func(buf *bytes.Buffer, dirPath string) error {
+		return safeClient.ExportZip(buf, client.ExportInfo{DirPath: dirPath})
+	}, func(buf *bytes.Buffer, dirPath string) error {
+		return safeClient.ImportZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), client.ImportInfo{DirPath: dirPath})
+	})
+}
+
+func testArchiveRoundTrip(t *testing.T, export func(*bytes.Buffer, string) error,
+	imprt func(*bytes.Buffer, string) error) {
+	// Create src/a.txt, src/sub/ as private and versioned, and src/sub/b.txt all with metadata
+	srcPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: srcPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: srcPath})
+	err := safeClient.CreateDir(client.CreateDirInfo{
+		DirPath:   path.Join(srcPath, "sub"),
+		Private:   true,
+		Versioned: true,
+		Metadata:  "sub meta",
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		filePath := path.Join(srcPath, name)
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath, Metadata: name + " meta"}))
+		err = safeClient.WriteFile(client.WriteFileInfo{
+			FilePath: filePath,
+			Contents: ioutil.NopCloser(strings.NewReader("contents of " + name)),
+		})
+		require.NoError(t, err)
+	}
+
+	// Export it and import it somewhere else
+	var buf bytes.Buffer
+	require.NoError(t, export(&buf, srcPath))
+	destPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: destPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: destPath})
+	require.NoError(t, imprt(&buf, destPath))
+
+	// Check the attributes and contents came through
+	dest, err := safeClient.GetDir(client.GetDirInfo{DirPath: destPath})
+	require.NoError(t, err)
+	require.Len(t, dest.SubDirs, 1)
+	require.Equal(t, "sub", dest.SubDirs[0].Name)
+	require.True(t, dest.SubDirs[0].Private)
+	require.True(t, dest.SubDirs[0].Versioned)
+	require.Equal(t, "sub meta", dest.SubDirs[0].Metadata)
+	require.Len(t, dest.Files, 1)
+	require.Equal(t, "a.txt meta", dest.Files[0].Metadata)
+	sub, err := safeClient.GetDir(client.GetDirInfo{DirPath: path.Join(destPath, "sub")})
+	require.NoError(t, err)
+	require.Len(t, sub.Files, 1)
+	require.Equal(t, "sub/b.txt meta", sub.Files[0].Metadata)
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: path.Join(destPath, name)})
+		require.NoError(t, err)
+		requireReadCloserEqualsString(t, "contents of "+name, rc)
+	}
+}
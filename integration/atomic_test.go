@@ -0,0 +1,51 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	filePath := dirPath + "/index.html"
+	write := func(contents string) {
+		err := safeClient.WriteFileAtomic(client.WriteFileAtomicInfo{
+			FilePath: filePath,
+			Contents: ioutil.NopCloser(strings.NewReader(contents)),
+		})
+		require.NoError(t, err)
+	}
+	requireOnly := func(contents string) {
+		dir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+		require.NoError(t, err)
+		require.Len(t, dir.Files, 1)
+		require.Equal(t, "index.html", dir.Files[0].Name)
+		rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: filePath})
+		require.NoError(t, err)
+		requireReadCloserEqualsString(t, contents, rc)
+	}
+
+	// Create and replace
+	write("FOO")
+	requireOnly("FOO")
+	write("BAR BAZ")
+	requireOnly("BAR BAZ")
+
+	// A failed write's partial temp file is removed
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: dirPath + "/.index.html.tmp-1234"}))
+	write("QUX")
+	requireOnly("QUX")
+
+	// A write that failed after deleting the old file is finished before the next write
+	require.NoError(t, safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath}))
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: dirPath + "/.index.html.new-1234"}))
+	write("FOO BAR")
+	requireOnly("FOO BAR")
+}
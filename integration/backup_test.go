@@ -0,0 +1,86 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	// Make a local dir with a file big enough to be split into several chunks
+	localDir, err := ioutil.TempDir("", "backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+	big := make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(1)).Read(big)
+	require.NoError(t, os.Mkdir(filepath.Join(localDir, "sub"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "sub", "big"), big, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "small"), []byte("FOO BAR BAZ"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "empty"), nil, 0644))
+
+	// Back it up and make sure it was chunked
+	dirPath := "/" + randomName()
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	first, err := safeClient.Backup(client.BackupInfo{LocalDir: localDir, DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, first.Entries, 4)
+	var bigChunks []string
+	for _, entry := range first.Entries {
+		if entry.Path == "sub/big" {
+			bigChunks = entry.Chunks
+		}
+	}
+	require.True(t, len(bigChunks) > 1)
+
+	// Append to the big file and back up again, which should only change its last chunk
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "sub", "big"), append(big, "QUX"...), 0644))
+	second, err := safeClient.Backup(client.BackupInfo{LocalDir: localDir, DirPath: dirPath})
+	require.NoError(t, err)
+	for _, entry := range second.Entries {
+		if entry.Path == "sub/big" {
+			require.Equal(t, bigChunks[:len(bigChunks)-1], entry.Chunks[:len(bigChunks)-1])
+		}
+	}
+	snapshots, err := safeClient.BackupSnapshots(client.BackupSnapshotsInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, first.ID, snapshots[0].ID)
+
+	// Restore the first snapshot and check it's what was backed up
+	restoreDir, err := ioutil.TempDir("", "restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(restoreDir)
+	restoreInfo := client.RestoreBackupInfo{DirPath: dirPath, SnapshotID: first.ID, LocalDir: restoreDir}
+	_, err = safeClient.RestoreBackup(restoreInfo)
+	require.NoError(t, err)
+	restored, err := ioutil.ReadFile(filepath.Join(restoreDir, "sub", "big"))
+	require.NoError(t, err)
+	require.Equal(t, big, restored)
+	restored, err = ioutil.ReadFile(filepath.Join(restoreDir, "small"))
+	require.NoError(t, err)
+	require.Equal(t, "FOO BAR BAZ", string(restored))
+	stat, err := os.Stat(filepath.Join(restoreDir, "small"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	// Prune the first and make sure only its last chunk of the big file went with it
+	result, err := safeClient.PruneBackup(client.PruneBackupInfo{DirPath: dirPath, KeepLast: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{first.ID}, result.Snapshots)
+	require.Equal(t, 1, result.Chunks)
+	require.NoError(t, safeClient.CheckBackup(client.CheckBackupInfo{DirPath: dirPath, ReadData: true}))
+
+	// Remove a chunk the remaining snapshot needs and make sure check sees it
+	require.NoError(t, safeClient.DeleteFile(client.DeleteFileInfo{
+		FilePath: dirPath + "/chunks/" + bigChunks[0][:2] + "/" + bigChunks[0],
+	}))
+	err = safeClient.CheckBackup(client.CheckBackupInfo{DirPath: dirPath})
+	require.IsType(t, &client.CheckBackupError{}, err)
+	require.Len(t, err.(*client.CheckBackupError).Problems, 1)
+}
@@ -0,0 +1,111 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	a := client.Snapshot{
+		"same":      {Path: "same", Size: 1, ModifiedOn: now, Hash: "h1"},
+		"removed":   {Path: "removed", Size: 1, ModifiedOn: now},
+		"sized":     {Path: "sized", Size: 1, ModifiedOn: now},
+		"touched":   {Path: "touched", Size: 1, ModifiedOn: now},
+		"hashed":    {Path: "hashed", Size: 1, ModifiedOn: now, Hash: "h1"},
+		"unhashed":  {Path: "unhashed", Size: 1, ModifiedOn: now, Hash: "h1"},
+		"retyped":   {Path: "retyped", Size: 1, ModifiedOn: now},
+		"dir":       {Path: "dir", Dir: true, ModifiedOn: now},
+		"dir/inner": {Path: "dir/inner", Size: 1, ModifiedOn: now},
+	}
+	b := client.Snapshot{
+		"same":      {Path: "same", Size: 1, ModifiedOn: now, Hash: "h1"},
+		"added":     {Path: "added", Size: 1, ModifiedOn: now},
+		"sized":     {Path: "sized", Size: 2, ModifiedOn: now},
+		"touched":   {Path: "touched", Size: 1, ModifiedOn: now.Add(time.Second)},
+		"hashed":    {Path: "hashed", Size: 1, ModifiedOn: now, Hash: "h2"},
+		"unhashed":  {Path: "unhashed", Size: 1, ModifiedOn: now},
+		"retyped":   {Path: "retyped", Dir: true, ModifiedOn: now},
+		"dir":       {Path: "dir", Dir: true, ModifiedOn: now.Add(time.Second)},
+		"dir/inner": {Path: "dir/inner", Size: 1, ModifiedOn: now},
+	}
+	summarize := func(diffs []client.DiffEntry) []string {
+		strs := []string{}
+		for _, diff := range diffs {
+			strs = append(strs, string(diff.Change)+" "+diff.Path+" "+strings.Join(diff.Reasons, ","))
+		}
+		return strs
+	}
+
+	// Directories only differ by type and files without a hash on both sides aren't compared by it
+	diffs := client.DiffSnapshots(a, b, client.DiffOptions{})
+	require.Equal(t, []string{
+		"added added ",
+		"changed hashed hash",
+		"removed removed ",
+		"changed retyped type",
+		"changed sized size",
+		"changed touched modified",
+	}, summarize(diffs))
+	require.Nil(t, diffs[0].A)
+	require.Equal(t, b["added"], *diffs[0].B)
+	require.Equal(t, a["removed"], *diffs[2].A)
+	require.Nil(t, diffs[2].B)
+
+	// Ignoring mod times leaves out the touched file
+	diffs = client.DiffSnapshots(a, b, client.DiffOptions{IgnoreModTime: true})
+	require.NotContains(t, summarize(diffs), "changed touched modified")
+	require.Len(t, diffs, 5)
+	require.Empty(t, client.DiffSnapshots(a, a, client.DiffOptions{}))
+}
+
+func TestDNSSnapshotCompressedHash(t *testing.T) {
+	// Create a dir with a compressed file and the same file locally
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	contents := strings.Repeat("Some compressible content ", 100)
+	filePath := path.Join(dirPath, "index.html")
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader(contents)),
+		Compress: true,
+	}))
+	localDir, err := ioutil.TempDir("", "safe-diff-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "index.html"), []byte(contents), 0644))
+
+	// Serve it over DNS
+	name := randomName()
+	require.NoError(t, safeClient.DNSCreateName(name))
+	defer safeClient.DNSDeleteName(name)
+	serviceName := randomName()
+	require.NoError(t, safeClient.DNSAddService(client.DNSAddServiceInfo{
+		Name:        name,
+		ServiceName: serviceName,
+		HomeDirPath: dirPath,
+	}))
+	defer safeClient.DNSDeleteService(name, serviceName)
+
+	// The hashes of the DNS, SAFE and local snapshots should all be of the uncompressed contents
+	dnsSnap, err := safeClient.DNSSnapshot(client.DNSSnapshotInfo{Name: name, Service: serviceName, Hash: true})
+	require.NoError(t, err)
+	safeSnap, err := safeClient.Snapshot(client.SnapshotInfo{DirPath: dirPath, Hash: true})
+	require.NoError(t, err)
+	localSnap, err := client.LocalSnapshot(localDir, true)
+	require.NoError(t, err)
+	require.Equal(t, localSnap["index.html"].Hash, dnsSnap["index.html"].Hash)
+	require.Equal(t, localSnap["index.html"].Hash, safeSnap["index.html"].Hash)
+	require.Empty(t, client.DiffSnapshots(localSnap, dnsSnap, client.DiffOptions{IgnoreModTime: true}))
+}
@@ -0,0 +1,61 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPlanDNS(t *testing.T) {
+	name, otherName := randomName(), randomName()
+	homePath, otherHomePath := "/"+randomName(), "/"+randomName()
+	for _, dirPath := range []string{homePath, otherHomePath} {
+		require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+		defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	}
+	require.NoError(t, safeClient.DNSRegister(client.DNSRegisterInfo{Name: otherName, ServiceName: "www",
+		HomeDirPath: homePath}))
+	defer safeClient.DNSDeleteName(otherName)
+	defer safeClient.DNSDeleteName(name)
+	plan := func(names map[string]map[string]client.DNSService) []string {
+		p, err := safeClient.PlanDNS(client.PlanDNSInfo{Names: names})
+		require.NoError(t, err)
+		changes := []string{}
+		for _, change := range p.Changes {
+			changes = append(changes, change.String())
+		}
+		return changes
+	}
+	apply := func(names map[string]map[string]client.DNSService) {
+		p, err := safeClient.PlanDNS(client.PlanDNSInfo{Names: names})
+		require.NoError(t, err)
+		require.NoError(t, safeClient.ApplyDNS(p))
+	}
+
+	// Create, then nothing to do
+	names := map[string]map[string]client.DNSService{
+		name:      {"www": {HomeDirPath: homePath}, "blog": {HomeDirPath: otherHomePath}},
+		otherName: {"www": {HomeDirPath: homePath}},
+	}
+	require.Equal(t, []string{
+		"create name " + name,
+		"add service blog." + name + " -> " + otherHomePath + " (app)",
+		"add service www." + name + " -> " + homePath + " (app)",
+	}, plan(names))
+	apply(names)
+	require.Empty(t, plan(names))
+
+	// Replace and leave a service alone, then delete it with prune
+	names[name] = map[string]client.DNSService{"www": {HomeDirPath: otherHomePath}}
+	require.Equal(t, []string{"replace service www." + name + " -> " + otherHomePath + " (app)"}, plan(names))
+	apply(names)
+	dir, err := safeClient.DNSServiceDir(name, "www")
+	require.NoError(t, err)
+	require.Equal(t, otherHomePath[1:], dir.Info.Name)
+	p, err := safeClient.PlanDNS(client.PlanDNSInfo{Names: names, Prune: true})
+	require.NoError(t, err)
+	require.Contains(t, p.Changes, client.DNSChange{Action: client.DNSActionDeleteService, Name: name,
+		ServiceName: "blog"})
+}
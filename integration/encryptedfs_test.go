@@ -0,0 +1,72 @@
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFS(t *testing.T) {
+	// Create a new directory to work with
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: dirPath})
+
+	// Small chunks so reads span several of them
+	encFS := client.NewEncryptedFS(safeClient, client.Keyring{
+		Keys:         map[string][]byte{"first": bytes.Repeat([]byte{1}, 32), "second": bytes.Repeat([]byte{2}, 32)},
+		CurrentKeyID: "first",
+	})
+	encFS.ChunkSize = 4
+
+	// Create and write "FOO BAR BAZ" and make sure the key ID is in the metadata
+	filePath := path.Join(dirPath, randomName())
+	require.NoError(t, encFS.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	defer safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+	require.NoError(t, encFS.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("FOO BAR BAZ")),
+	}))
+	getDir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, getDir.Files, 1)
+	require.Equal(t, "first", client.ParseMetadata(getDir.Files[0].Metadata)[client.MetadataEncryptionKeyID])
+
+	// The raw content must not be the plaintext
+	rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: filePath})
+	require.NoError(t, err)
+	raw, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "FOO")
+
+	// Full content and a range across chunks have to be right
+	rc, err = encFS.GetFile(client.GetFileInfo{FilePath: filePath})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "FOO BAR BAZ", rc)
+	rc, err = encFS.GetFile(client.GetFileInfo{FilePath: filePath, Offset: 2, Length: 7})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "O BAR B", rc)
+	_, err = encFS.GetFile(client.GetFileInfo{FilePath: filePath, Offset: -1})
+	require.Error(t, err)
+	_, err = encFS.GetFile(client.GetFileInfo{FilePath: filePath, Length: -1})
+	require.Error(t, err)
+
+	// Rewrite with the second key and make sure the metadata follows
+	encFS.Keyring.CurrentKeyID = "second"
+	require.NoError(t, encFS.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("QUX")),
+	}))
+	getDir, err = safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Equal(t, "second", client.ParseMetadata(getDir.Files[0].Metadata)[client.MetadataEncryptionKeyID])
+	rc, err = encFS.GetFile(client.GetFileInfo{FilePath: filePath})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "QUX", rc)
+}
@@ -0,0 +1,68 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"path"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	// Create base/one/index.html, base/one/a.bak, base/two/b.bak, base/three/, base/.hidden/index.html and
+	// base/one/.c.bak
+	basePath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: basePath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: basePath})
+	for _, dirName := range []string{"one", "two", "three", ".hidden"} {
+		require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: path.Join(basePath, dirName)}))
+	}
+	for _, fileName := range []string{"one/index.html", "one/a.bak", "two/b.bak", ".hidden/index.html", "one/.c.bak"} {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: path.Join(basePath, fileName)}))
+	}
+	glob := func(pattern string) []string {
+		matches, err := safeClient.Glob(client.GlobInfo{Pattern: path.Join(basePath, pattern)})
+		require.NoError(t, err)
+		for i, match := range matches {
+			require.Equal(t, basePath+"/", match[:len(basePath)+1])
+			matches[i] = match[len(basePath)+1:]
+		}
+		return matches
+	}
+
+	// Plain elements after a wildcard only match what exists
+	require.Equal(t, []string{"one/index.html"}, glob("*/index.html"))
+	require.Equal(t, []string{"one/a.bak", "two/b.bak"}, glob("*/*.bak"))
+	require.Empty(t, glob("*/missing"))
+	require.Empty(t, glob("t*/index.html"))
+	// Directories and files both match the last element in name order
+	require.Equal(t, []string{"one", "three", "two"}, glob("*"))
+	require.Equal(t, []string{"one/a.bak", "one/index.html"}, glob("one/*"))
+	// Dot entries are only matched by elements starting with a dot
+	require.Equal(t, []string{".hidden"}, glob(".*"))
+	require.Equal(t, []string{".hidden/index.html"}, glob(".*/index.html"))
+	require.Equal(t, []string{"one/.c.bak"}, glob("one/.*.bak"))
+
+	// Patterns without special characters are returned as is
+	matches, err := safeClient.Glob(client.GlobInfo{Pattern: path.Join(basePath, "missing")})
+	require.NoError(t, err)
+	require.Equal(t, []string{path.Join(basePath, "missing")}, matches)
+
+	// Missing directories don't match but other failures listing them are returned
+	matches, err = safeClient.Glob(client.GlobInfo{Pattern: path.Join(basePath, "missing/*")})
+	require.NoError(t, err)
+	require.Empty(t, matches)
+	unreachable := client.NewClient(client.Conf{LauncherBaseURL: "http://127.0.0.1:1/"})
+	_, err = unreachable.Glob(client.GlobInfo{Pattern: path.Join(basePath, "*")})
+	require.Error(t, err)
+
+	// Bad patterns fail and GlobAll fails when a pattern doesn't match
+	_, err = safeClient.Glob(client.GlobInfo{Pattern: path.Join(basePath, "[")})
+	require.Error(t, err)
+	_, err = safeClient.GlobAll([]string{path.Join(basePath, "*/index.html"), path.Join(basePath, "*/missing")}, false)
+	require.Error(t, err)
+	all, err := safeClient.GlobAll([]string{path.Join(basePath, "two/*"), path.Join(basePath, "one/a.*")}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{path.Join(basePath, "two/b.bak"), path.Join(basePath, "one/a.bak")}, all)
+}
@@ -0,0 +1,62 @@
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/cretz/go-safeclient/kv"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	dirPath := "/" + randomName()
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	// Small chunks so large values are written in several calls
+	store, err := kv.NewStore(safeClient, kv.StoreInfo{DirPath: dirPath, ChunkSize: 4})
+	require.NoError(t, err)
+
+	// Missing keys
+	_, _, err = store.Get("foo")
+	require.Equal(t, kv.ErrNotFound, err)
+	require.Equal(t, kv.ErrNotFound, store.Delete("foo", kv.AnyVersion))
+
+	// Put, get and replace
+	version, err := store.Put("foo", []byte("FOO BAR BAZ"), 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), version)
+	value, version, err := store.Get("foo")
+	require.NoError(t, err)
+	require.Equal(t, "FOO BAR BAZ", string(value))
+	require.Equal(t, int64(1), version)
+	_, err = store.Put("foo", []byte("QUX"), 0)
+	require.Equal(t, kv.ErrVersionMismatch, err)
+	version, err = store.Put("foo", []byte("QUX"), 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), version)
+	value, _, err = store.Get("foo")
+	require.NoError(t, err)
+	require.Equal(t, "QUX", string(value))
+	version, err = store.Put("foo", bytes.Repeat([]byte("A"), 10), kv.AnyVersion)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), version)
+
+	// List by prefix
+	_, err = store.Put("food", nil, kv.AnyVersion)
+	require.NoError(t, err)
+	_, err = store.Put("bar/baz", []byte("B"), kv.AnyVersion)
+	require.NoError(t, err)
+	entries, err := store.List("foo")
+	require.NoError(t, err)
+	require.Equal(t, []kv.Entry{{Key: "foo", Version: 3, Size: 10}, {Key: "food", Version: 1}}, entries)
+	entries, err = store.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// Delete
+	require.Equal(t, kv.ErrVersionMismatch, store.Delete("foo", 1))
+	require.NoError(t, store.Delete("foo", 3))
+	_, _, err = store.Get("foo")
+	require.Equal(t, kv.ErrNotFound, err)
+}
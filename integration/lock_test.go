@@ -0,0 +1,55 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	lockPath := dirPath + "/lock"
+
+	// Take it, then fail to take it again
+	first, err := safeClient.Lock(client.LockInfo{FilePath: lockPath, Holder: "first"})
+	require.NoError(t, err)
+	_, err = safeClient.Lock(client.LockInfo{FilePath: lockPath, Holder: "second"})
+	require.IsType(t, &client.LockHeldError{}, err)
+	require.Equal(t, "first", err.(*client.LockHeldError).Holder)
+
+	// Renew and unlock only with the token
+	require.NoError(t, first.Renew())
+	require.Equal(t, client.ErrLockNotHeld, safeClient.Unlock(client.UnlockInfo{FilePath: lockPath, Token: "bad"}))
+	require.NoError(t, first.Unlock())
+	require.Equal(t, client.ErrLockNotHeld, first.Renew())
+
+	// Take over an expired lock
+	stale, err := safeClient.Lock(client.LockInfo{FilePath: lockPath, Holder: "stale", TTL: time.Millisecond})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	second, err := safeClient.Lock(client.LockInfo{FilePath: lockPath, Holder: "second", Heartbeat: true})
+	require.NoError(t, err)
+	require.Equal(t, client.ErrLockNotHeld, stale.Unlock())
+	require.Nil(t, second.Err())
+	require.NoError(t, second.Unlock())
+
+	// Paths are cleaned the same way Lock cleans them
+	third, err := safeClient.Lock(client.LockInfo{FilePath: lockPath})
+	require.NoError(t, err)
+	uncleanPath := dirPath[1:] + "//./lock"
+	require.NoError(t, safeClient.RenewLock(client.RenewLockInfo{FilePath: uncleanPath, Token: third.Token}))
+	require.NoError(t, safeClient.Unlock(client.UnlockInfo{FilePath: uncleanPath, Token: third.Token}))
+
+	// Forcing never deletes files that aren't locks
+	filePath := dirPath + "/file"
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	require.Error(t, safeClient.Unlock(client.UnlockInfo{FilePath: filePath, Force: true}))
+	dir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, dir.Files, 1)
+}
@@ -28,6 +28,154 @@ func TestSimpleNFSSharedPrivate(t *testing.T) {
 	assertSimpleNFS(t, true, true)
 }
 
+func TestCompressedNFS(t *testing.T) {
+	// Create a new directory to work with
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: dirPath})
+
+	// Write some very compressible text
+	filePath := path.Join(dirPath, randomName()+".txt")
+	contents := strings.Repeat("FOO BAR BAZ ", 100)
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	defer safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader(contents)),
+		Compress: true,
+	}))
+
+	// Make sure it's stored smaller but reports the logical size
+	getDir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, getDir.Files, 1)
+	require.True(t, getDir.Files[0].Size < int64(len(contents)))
+	require.Equal(t, int64(len(contents)), getDir.Files[0].LogicalSize())
+	require.Equal(t, client.CompressionGzip,
+		client.ParseMetadata(getDir.Files[0].Metadata)[client.MetadataCompression])
+
+	// Full content and a range have to be right
+	rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: filePath, Decompress: true})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, contents, rc)
+	rc, err = safeClient.GetFile(client.GetFileInfo{FilePath: filePath, Decompress: true, Offset: 2, Length: 7})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "O BAR B", rc)
+
+	// Writing it again uncompressed removes the compression from the metadata
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader(contents)),
+	}))
+	getDir, err = safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Empty(t, client.ParseMetadata(getDir.Files[0].Metadata)[client.MetadataCompression])
+	require.Empty(t, client.ParseMetadata(getDir.Files[0].Metadata)[client.MetadataLogicalSize])
+	rc, err = safeClient.GetFile(client.GetFileInfo{FilePath: filePath, Decompress: true})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, contents, rc)
+}
+
+func TestProgressNFS(t *testing.T) {
+	// Create a new directory to work with
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: dirPath})
+	filePath := path.Join(dirPath, randomName())
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	defer safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+
+	// Write and read it back, making sure the last progress is the whole thing
+	contents := strings.Repeat("FOO BAR BAZ ", 1000)
+	var last client.Progress
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader(contents)),
+		Progress: func(p client.Progress) { last = p },
+	}))
+	require.True(t, last.Done)
+	require.Equal(t, int64(len(contents)), last.Transferred)
+	last = client.Progress{}
+	rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: filePath, Progress: func(p client.Progress) { last = p }})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, contents, rc)
+	require.True(t, last.Done)
+}
+
+func TestCachedNFS(t *testing.T) {
+	// Use a copy of the client with a cache that never expires on its own
+	cache, err := client.NewCache(client.CacheConf{TTL: time.Hour})
+	require.NoError(t, err)
+	cachedClient := *safeClient
+	cachedClient.Cache = cache
+
+	// Create a new directory and file to work with
+	dirPath := "/" + randomName()
+	require.NoError(t, cachedClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: dirPath})
+	filePath := path.Join(dirPath, randomName())
+	require.NoError(t, cachedClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	defer safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+	require.NoError(t, cachedClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("FOO BAR BAZ")),
+	}))
+
+	// Read it to cache it, then change it without the cache and make sure the cached value is still used
+	rc, err := cachedClient.GetFile(client.GetFileInfo{FilePath: filePath})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "FOO BAR BAZ", rc)
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("QUX")),
+		Offset:   4,
+	}))
+	rc, err = cachedClient.GetFile(client.GetFileInfo{FilePath: filePath, Offset: 4, Length: 3})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "BAR", rc)
+
+	// Changes through the cached client invalidate it
+	require.NoError(t, cachedClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("!")),
+		Offset:   11,
+	}))
+	rc, err = cachedClient.GetFile(client.GetFileInfo{FilePath: filePath})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "FOO QUX BAZ!", rc)
+	getDir, err := cachedClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, getDir.Files, 1)
+	require.Equal(t, int64(12), getDir.Files[0].Size)
+}
+
+func TestMkdirAll(t *testing.T) {
+	// Create base/one/two with metadata only on two
+	basePath := "/" + randomName()
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: basePath})
+	twoPath := path.Join(basePath, "one", "two")
+	require.NoError(t, safeClient.MkdirAll(client.CreateDirInfo{DirPath: twoPath, Metadata: "foo"}))
+	getDir, err := safeClient.GetDir(client.GetDirInfo{DirPath: basePath})
+	require.NoError(t, err)
+	require.Len(t, getDir.SubDirs, 1)
+	require.Equal(t, "one", getDir.SubDirs[0].Name)
+	require.Empty(t, getDir.SubDirs[0].Metadata)
+	getDir, err = safeClient.GetDir(client.GetDirInfo{DirPath: path.Join(basePath, "one")})
+	require.NoError(t, err)
+	require.Len(t, getDir.SubDirs, 1)
+	require.Equal(t, "two", getDir.SubDirs[0].Name)
+	require.Equal(t, "foo", getDir.SubDirs[0].Metadata)
+
+	// Doing it again or for an existing parent changes nothing
+	require.NoError(t, safeClient.MkdirAll(client.CreateDirInfo{DirPath: twoPath, Metadata: "bar"}))
+	require.NoError(t, safeClient.MkdirAll(client.CreateDirInfo{DirPath: basePath + "/one/"}))
+	getDir, err = safeClient.GetDir(client.GetDirInfo{DirPath: path.Join(basePath, "one")})
+	require.NoError(t, err)
+	require.Len(t, getDir.SubDirs, 1)
+	require.Equal(t, "foo", getDir.SubDirs[0].Metadata)
+	require.NoError(t, safeClient.MkdirAll(client.CreateDirInfo{DirPath: "/"}))
+}
+
 func assertSimpleNFS(t *testing.T, shared bool, private bool) {
 	// Create a new directory to work with
 	dirInfo := client.CreateDirInfo{
@@ -0,0 +1,139 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPublisher(t *testing.T) {
+	// Local has a.txt, sub/b.txt and local.swp while SAFE has old.txt, safe.swp, saved versions and an atomic write's
+	// temp file
+	localDir, err := ioutil.TempDir("", "safe-publish-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+	require.NoError(t, os.Mkdir(filepath.Join(localDir, "sub"), 0755))
+	for name, contents := range map[string]string{"a.txt": "A", "sub/b.txt": "B", "local.swp": "ignored"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, filepath.FromSlash(name)), []byte(contents), 0644))
+	}
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: path.Join(dirPath, ".versions")}))
+	for _, name := range []string{"old.txt", "safe.swp", ".versions/0000000001.json", ".other.txt.tmp-1234"} {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: path.Join(dirPath, name)}))
+	}
+	publisher, err := safeClient.NewPublisher(client.PublisherInfo{
+		LocalDirPath: localDir,
+		DirPath:      dirPath,
+		Ignore:       []string{"*.swp"},
+		Atomic:       true,
+	})
+	require.NoError(t, err)
+	summarize := func(events []client.PublishEvent) []string {
+		strs := []string{}
+		for _, event := range events {
+			str := string(event.Type) + " " + event.Path
+			if event.OldPath != "" {
+				str += " from " + event.OldPath
+			}
+			strs = append(strs, str)
+		}
+		return strs
+	}
+	// The files SAFE had that are never touched are always expected too
+	requireSafeFiles := func(expected map[string]string) {
+		for _, name := range []string{"safe.swp", ".versions/0000000001.json", ".other.txt.tmp-1234"} {
+			expected[name] = ""
+		}
+		snap, err := safeClient.Snapshot(client.SnapshotInfo{DirPath: dirPath})
+		require.NoError(t, err)
+		actual := []string{}
+		for relPath, entry := range snap {
+			if !entry.Dir {
+				actual = append(actual, relPath)
+			}
+		}
+		sort.Strings(actual)
+		names := []string{}
+		for name, contents := range expected {
+			names = append(names, name)
+			rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: path.Join(dirPath, name)})
+			require.NoError(t, err)
+			requireReadCloserEqualsString(t, contents, rc)
+		}
+		sort.Strings(names)
+		require.Equal(t, names, actual)
+	}
+
+	// The first publish of everything deletes what isn't local and leaves ignored and client kept files alone on both
+	// sides
+	require.NoError(t, publisher.QueueAll())
+	require.Equal(t, []string{
+		"written a.txt",
+		"deleted old.txt",
+		"written sub",
+		"written sub/b.txt",
+	}, summarize(publisher.Publish()))
+	requireSafeFiles(map[string]string{"a.txt": "A", "sub/b.txt": "B"})
+	require.False(t, publisher.Retrying())
+
+	// Publishing everything again does nothing
+	require.NoError(t, publisher.QueueAll())
+	require.Empty(t, publisher.Publish())
+
+	// Renames are renamed on SAFE and changed files are written again
+	require.NoError(t, os.Rename(filepath.Join(localDir, "a.txt"), filepath.Join(localDir, "c.txt")))
+	bPath := filepath.Join(localDir, "sub", "b.txt")
+	require.NoError(t, ioutil.WriteFile(bPath, []byte("BB"), 0644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(bPath, future, future))
+	for _, relPath := range []string{"a.txt", "c.txt", "sub/b.txt", "safe.swp"} {
+		publisher.Queue(relPath)
+	}
+	require.Equal(t, []string{"renamed c.txt from a.txt", "written sub/b.txt"}, summarize(publisher.Publish()))
+	requireSafeFiles(map[string]string{"c.txt": "A", "sub/b.txt": "BB"})
+
+	// When SAFE changes underneath it, publishing fails and is retried until it works
+	require.NoError(t, safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: path.Join(dirPath, "sub")}))
+	future = future.Add(time.Minute)
+	require.NoError(t, ioutil.WriteFile(bPath, []byte("BBB"), 0644))
+	require.NoError(t, os.Chtimes(bPath, future, future))
+	publisher.Queue("sub/b.txt")
+	events := publisher.Publish()
+	require.Equal(t, []string{"failed sub/b.txt"}, summarize(events))
+	require.Error(t, events[0].Err)
+	require.True(t, publisher.Retrying())
+	require.Equal(t, 1, publisher.Failures())
+	require.Equal(t, []string{"failed sub/b.txt"}, summarize(publisher.Publish()))
+	require.Equal(t, 2, publisher.Failures())
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: path.Join(dirPath, "sub")}))
+	require.Equal(t, []string{"written sub/b.txt"}, summarize(publisher.Publish()))
+	require.False(t, publisher.Retrying())
+	require.Equal(t, 0, publisher.Failures())
+	requireSafeFiles(map[string]string{"c.txt": "A", "sub/b.txt": "BBB"})
+
+	// Deleted directories are deleted on SAFE
+	require.NoError(t, os.RemoveAll(filepath.Join(localDir, "sub")))
+	publisher.Queue("sub")
+	publisher.Queue("sub/b.txt")
+	require.Equal(t, []string{"deleted sub"}, summarize(publisher.Publish()))
+	requireSafeFiles(map[string]string{"c.txt": "A"})
+
+	// Local paths are made relative for queueing
+	require.Equal(t, "sub/b.txt", publisher.RelPath(filepath.Join(localDir, "sub", "b.txt")))
+	require.Equal(t, "", publisher.RelPath(localDir))
+	require.True(t, publisher.Ignored("sub/local.swp"))
+	require.True(t, publisher.Ignored("dir.swp/c.txt"))
+	require.True(t, publisher.Ignored(".versions/blobs"))
+	require.True(t, publisher.Ignored("sub/.b.txt.new-1234"))
+	require.False(t, publisher.Ignored("sub/.b.txt"))
+}
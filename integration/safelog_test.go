@@ -0,0 +1,75 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/cretz/go-safeclient/safelog"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSafeLog(t *testing.T) {
+	// Small segments so they roll over
+	dirPath := "/" + randomName()
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	writer, err := safelog.NewWriter(safeClient, safelog.WriterInfo{DirPath: dirPath, SegmentSize: 32})
+	require.NoError(t, err)
+	positions := []int64{}
+	for _, data := range []string{"FOO", "BAR", strings.Repeat("BAZ", 20), "QUX"} {
+		position, err := writer.Append([]byte(data))
+		require.NoError(t, err)
+		positions = append(positions, position)
+	}
+	require.Equal(t, []int64{0, 11, 22, 90}, positions)
+	dir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, dir.Files, 3)
+
+	// Read it all and make sure it waits for more at the end
+	reader := safelog.NewReader(safeClient, safelog.ReaderInfo{DirPath: dirPath})
+	for i, data := range []string{"FOO", "BAR", strings.Repeat("BAZ", 20), "QUX"} {
+		record, err := reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, data, string(record.Data))
+		require.Equal(t, positions[i], record.Position)
+	}
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+	_, err = writer.Append([]byte("QUUX"))
+	require.NoError(t, err)
+	record, err := reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, "QUUX", string(record.Data))
+
+	// Start from the middle
+	middle := safelog.NewReader(safeClient, safelog.ReaderInfo{DirPath: dirPath, Position: positions[2]})
+	record, err = middle.Next()
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("BAZ", 20), string(record.Data))
+
+	// Tear a write at the end, which readers should treat as not written yet
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: path.Join(dirPath, dir.Files[len(dir.Files)-1].Name),
+		Contents: ioutil.NopCloser(strings.NewReader("\x00\x00\x00\x10AB")),
+		Offset:   reader.Position() - positions[3],
+	}))
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+
+	// A new writer should skip the torn bytes with a new segment
+	writer, err = safelog.NewWriter(safeClient, safelog.WriterInfo{DirPath: dirPath, SegmentSize: 32})
+	require.NoError(t, err)
+	require.Equal(t, reader.Position(), writer.Position())
+	_, err = writer.Append([]byte("CORGE"))
+	require.NoError(t, err)
+	record, err = reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, "CORGE", string(record.Data))
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+}
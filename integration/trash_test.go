@@ -0,0 +1,79 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	defer safeClient.PurgeTrash(client.PurgeTrashInfo{})
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath + "/sub", Metadata: "sub meta"}))
+	for _, filePath := range []string{dirPath + "/foo", dirPath + "/sub/bar"} {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath, Metadata: "file meta"}))
+		err := safeClient.WriteFile(client.WriteFileInfo{
+			FilePath: filePath,
+			Contents: ioutil.NopCloser(strings.NewReader("FOO BAR")),
+		})
+		require.NoError(t, err)
+	}
+	requireEntries := func(expected ...string) {
+		dir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath})
+		require.NoError(t, err)
+		var actual []string
+		for _, sub := range dir.SubDirs {
+			actual = append(actual, sub.Name+"/")
+		}
+		for _, file := range dir.Files {
+			actual = append(actual, file.Name)
+		}
+		require.Equal(t, expected, actual)
+	}
+
+	// Trash a file and a directory
+	fileEntry, err := safeClient.Trash(client.TrashInfo{Path: dirPath + "/foo"})
+	require.NoError(t, err)
+	require.False(t, fileEntry.Dir)
+	dirEntry, err := safeClient.Trash(client.TrashInfo{Path: dirPath + "/sub"})
+	require.NoError(t, err)
+	require.True(t, dirEntry.Dir)
+	requireEntries()
+	entries, err := safeClient.ListTrash(client.ListTrashInfo{})
+	require.NoError(t, err)
+	require.Contains(t, entries, *fileEntry)
+	require.Contains(t, entries, *dirEntry)
+
+	// Restore them, the directory somewhere else
+	_, err = safeClient.RestoreTrash(client.RestoreTrashInfo{ID: fileEntry.ID})
+	require.NoError(t, err)
+	_, err = safeClient.RestoreTrash(client.RestoreTrashInfo{ID: dirEntry.ID, DestPath: dirPath + "/restored"})
+	require.NoError(t, err)
+	requireEntries("restored/", "foo")
+	rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: dirPath + "/restored/bar"})
+	require.NoError(t, err)
+	requireReadCloserEqualsString(t, "FOO BAR", rc)
+	dir, err := safeClient.GetDir(client.GetDirInfo{DirPath: dirPath + "/restored"})
+	require.NoError(t, err)
+	require.Equal(t, "sub meta", dir.Info.Metadata)
+	require.Equal(t, "file meta", dir.Files[0].Metadata)
+	_, err = safeClient.RestoreTrash(client.RestoreTrashInfo{ID: fileEntry.ID})
+	require.Equal(t, client.ErrTrashEntryNotFound, err)
+
+	// Only old entries are purged
+	entry, err := safeClient.Trash(client.TrashInfo{Path: dirPath + "/foo"})
+	require.NoError(t, err)
+	purged, err := safeClient.PurgeTrash(client.PurgeTrashInfo{OlderThan: time.Hour})
+	require.NoError(t, err)
+	require.NotContains(t, purged, *entry)
+	purged, err = safeClient.PurgeTrash(client.PurgeTrashInfo{})
+	require.NoError(t, err)
+	require.Contains(t, purged, *entry)
+}
@@ -0,0 +1,101 @@
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumableUpload(t *testing.T) {
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	localDir, err := ioutil.TempDir("", "safe-upload-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+	journalPath := filepath.Join(localDir, "journal.json")
+	// Five chunks of 10 with each one different
+	const chunkSize = 10
+	contents := ""
+	for _, char := range "abcde" {
+		contents += strings.Repeat(string(char), chunkSize)
+	}
+	hash := sha256.Sum256([]byte(contents))
+	newJournal := func(offset int64) client.UploadJournal {
+		return client.UploadJournal{
+			SourceHash: hex.EncodeToString(hash[:]),
+			Size:       int64(len(contents)),
+			ChunkSize:  chunkSize,
+			Offset:     offset,
+		}
+	}
+	// Written ahead of uploads so it's clear which bytes the upload wrote
+	stale := strings.ToUpper(contents)
+	// Creates the file with the given bytes written and a journal if given
+	prepare := func(written string, journal *client.UploadJournal) string {
+		filePath := path.Join(dirPath, randomName())
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+		if written != "" {
+			require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+				FilePath: filePath,
+				Contents: ioutil.NopCloser(strings.NewReader(written)),
+			}))
+		}
+		if journal != nil {
+			journal.FilePath = filePath
+			byts, err := json.Marshal(journal)
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(journalPath, byts, 0600))
+		}
+		return filePath
+	}
+	// Uploads and gives what ends up on SAFE
+	upload := func(filePath string) string {
+		err := safeClient.ResumableUpload(client.ResumableUploadInfo{
+			FilePath:    filePath,
+			Contents:    bytes.NewReader([]byte(contents)),
+			JournalPath: journalPath,
+			ChunkSize:   chunkSize,
+		})
+		require.NoError(t, err)
+		_, err = os.Stat(journalPath)
+		require.True(t, os.IsNotExist(err))
+		rc, err := safeClient.GetFile(client.GetFileInfo{FilePath: filePath})
+		require.NoError(t, err)
+		defer rc.Close()
+		byts, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		return string(byts)
+	}
+
+	// Without a journal, it all gets written
+	require.Equal(t, contents, upload(prepare(stale[:2*chunkSize], nil)))
+
+	// With a journal two chunks in, it continues from there
+	journal := newJournal(2 * chunkSize)
+	require.Equal(t, stale[:2*chunkSize]+contents[2*chunkSize:], upload(prepare(stale[:2*chunkSize], &journal)))
+	journal = newJournal(2 * chunkSize)
+	require.Equal(t, contents, upload(prepare(contents[:2*chunkSize], &journal)))
+
+	// With a journal four chunks in but SAFE only having one and a half, it continues from the first chunk
+	journal = newJournal(4 * chunkSize)
+	require.Equal(t, stale[:chunkSize]+contents[chunkSize:], upload(prepare(stale[:chunkSize+chunkSize/2], &journal)))
+	journal = newJournal(4 * chunkSize)
+	require.Equal(t, contents, upload(prepare(contents[:chunkSize+chunkSize/2], &journal)))
+
+	// A journal for different contents is ignored
+	journal = newJournal(3 * chunkSize)
+	journal.SourceHash = strings.Repeat("0", 64)
+	require.Equal(t, contents, upload(prepare(stale[:3*chunkSize], &journal)))
+}
@@ -0,0 +1,113 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	safeClient.Versioning = true
+	defer func() { safeClient.Versioning = false }()
+	dirPath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath, Versioned: true}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: dirPath})
+	filePath := dirPath + "/foo"
+	write := func(contents string) {
+		err := safeClient.WriteFile(client.WriteFileInfo{
+			FilePath: filePath,
+			Contents: ioutil.NopCloser(strings.NewReader(contents)),
+		})
+		require.NoError(t, err)
+	}
+
+	// Each change that could lose something saves the version before it, so creating the file and writing it while
+	// empty don't
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	write("FOO")
+	write("BAR")
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: dirPath + "/.hidden"}))
+	require.NoError(t, safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath}))
+	versions, err := safeClient.ListVersions(client.ListVersionsInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	for i, version := range versions {
+		require.Equal(t, int64(i+1), version.Version)
+	}
+
+	// Check what was in each
+	for version, expected := range map[int64]string{1: "FOO", 2: "BAR"} {
+		dir, err := safeClient.GetDirAtVersion(client.GetDirAtVersionInfo{DirPath: dirPath, Version: version})
+		require.NoError(t, err)
+		require.Len(t, dir.Files, 1)
+		require.Equal(t, "foo", dir.Files[0].Name)
+		rc, err := safeClient.GetFileAtVersion(client.GetFileAtVersionInfo{FilePath: filePath, Version: version})
+		require.NoError(t, err)
+		requireReadCloserEqualsString(t, expected, rc)
+	}
+
+	// Locks and metadata changes don't save versions and lock files are left out of them
+	lock, err := safeClient.Lock(client.LockInfo{FilePath: dirPath + "/lock"})
+	require.NoError(t, err)
+	require.NoError(t, safeClient.RenewLock(client.RenewLockInfo{FilePath: lock.FilePath, Token: lock.Token}))
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	write("BAZ")
+	require.NoError(t, safeClient.ChangeFile(client.ChangeFileInfo{FilePath: filePath, Metadata: "foo=bar"}))
+	versions, err = safeClient.ListVersions(client.ListVersionsInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.NoError(t, safeClient.Unlock(client.UnlockInfo{FilePath: lock.FilePath, Token: lock.Token}))
+
+	// Saving the current files, then again without changes which does nothing
+	for i := 0; i < 2; i++ {
+		require.NoError(t, safeClient.SaveVersion(client.SaveVersionInfo{DirPath: dirPath}))
+		versions, err = safeClient.ListVersions(client.ListVersionsInfo{DirPath: dirPath})
+		require.NoError(t, err)
+		require.Len(t, versions, 3)
+	}
+	dir, err := safeClient.GetDirAtVersion(client.GetDirAtVersionInfo{DirPath: dirPath, Version: 3})
+	require.NoError(t, err)
+	require.Len(t, dir.Files, 1)
+	require.Equal(t, "foo", dir.Files[0].Name)
+	require.Equal(t, "foo=bar", dir.Files[0].Metadata)
+
+	// Concurrent changes each save their own version even when they store the same contents at once
+	for i := 0; i < 8; i++ {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: dirPath + "/same" + strconv.Itoa(i)}))
+		err := safeClient.WriteFile(client.WriteFileInfo{
+			FilePath: dirPath + "/same" + strconv.Itoa(i),
+			Contents: ioutil.NopCloser(strings.NewReader("SAME")),
+		})
+		require.NoError(t, err)
+	}
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(filePath string) {
+			defer wg.Done()
+			errs <- safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+		}(dirPath + "/same" + strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	versions, err = safeClient.ListVersions(client.ListVersionsInfo{DirPath: dirPath})
+	require.NoError(t, err)
+	require.True(t, len(versions) > 3)
+	for _, version := range versions[3:] {
+		rc, err := safeClient.GetFileAtVersion(client.GetFileAtVersionInfo{FilePath: dirPath + "/same0",
+			Version: version.Version})
+		if err == nil {
+			requireReadCloserEqualsString(t, "SAME", rc)
+		}
+	}
+}
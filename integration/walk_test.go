@@ -0,0 +1,130 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	// Create a small tree: base/a, base/sub/, base/sub/b
+	basePath := "/" + randomName()
+	subPath := path.Join(basePath, "sub")
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: basePath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: basePath})
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: subPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: subPath})
+	for _, filePath := range []string{path.Join(basePath, "a"), path.Join(subPath, "b")} {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+		defer safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath})
+	}
+
+	// Walk the whole thing and make sure it's visited in order
+	visited := []string{}
+	err := safeClient.Walk(client.WalkInfo{DirPath: basePath}, func(entryPath string, dir *client.DirInfo,
+		file *client.FileInfo, err error) error {
+		require.NoError(t, err)
+		require.True(t, (dir == nil) != (file == nil))
+		visited = append(visited, entryPath)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{basePath, path.Join(basePath, "a"), subPath, path.Join(subPath, "b")}, visited)
+
+	// Skip the sub directory this time
+	visited = []string{}
+	err = safeClient.Walk(client.WalkInfo{DirPath: basePath}, func(entryPath string, dir *client.DirInfo,
+		file *client.FileInfo, err error) error {
+		require.NoError(t, err)
+		visited = append(visited, entryPath)
+		if entryPath == subPath {
+			return client.SkipDir
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{basePath, path.Join(basePath, "a"), subPath}, visited)
+}
+
+func TestLoadDirTree(t *testing.T) {
+	// Create base/a, base/one/b, base/one/deeper/c, base/two/d and base/three/ with d compressed
+	basePath := "/" + randomName()
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: basePath}))
+	defer safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: basePath})
+	for _, dirName := range []string{"one", "one/deeper", "two", "three"} {
+		require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: path.Join(basePath, dirName)}))
+	}
+	contents := map[string]string{
+		"a":            "A",
+		"one/b":        "BB",
+		"one/deeper/c": "CCC",
+		"two/d":        strings.Repeat("D", 1000),
+	}
+	for name, content := range contents {
+		filePath := path.Join(basePath, name)
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+		require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+			FilePath: filePath,
+			Contents: ioutil.NopCloser(strings.NewReader(content)),
+			Compress: name == "two/d",
+		}))
+	}
+
+	// Load it all with a small concurrency and check the structure and totals
+	tree, err := safeClient.LoadDirTree(client.LoadDirTreeInfo{DirPath: basePath, Concurrency: 2})
+	require.NoError(t, err)
+	require.Equal(t, basePath, tree.Path)
+	require.True(t, tree.Loaded)
+	require.Len(t, tree.Files, 1)
+	require.Len(t, tree.SubDirs, 3)
+	// Sub directories are in name order
+	require.Equal(t, path.Join(basePath, "one"), tree.SubDirs[0].Path)
+	require.Equal(t, path.Join(basePath, "three"), tree.SubDirs[1].Path)
+	require.Equal(t, path.Join(basePath, "two"), tree.SubDirs[2].Path)
+	require.Equal(t, path.Join(basePath, "one/deeper"), tree.SubDirs[0].SubDirs[0].Path)
+	require.True(t, tree.SubDirs[0].SubDirs[0].Loaded)
+	require.Equal(t, 4, tree.FileCount())
+	require.EqualValues(t, 1006, tree.Size())
+	require.EqualValues(t, 5, tree.SubDirs[0].Size())
+	require.EqualValues(t, 0, tree.SubDirs[1].Size())
+	// The compressed file is stored smaller than it is
+	require.True(t, tree.StoredSize() < tree.Size())
+	require.EqualValues(t, 6, tree.StoredSize()-tree.SubDirs[2].StoredSize())
+
+	// With a max depth of 1, the deeper dir is known but not loaded
+	tree, err = safeClient.LoadDirTree(client.LoadDirTreeInfo{DirPath: basePath, MaxDepth: 1})
+	require.NoError(t, err)
+	deeper := tree.SubDirs[0].SubDirs[0]
+	require.Equal(t, "deeper", deeper.Info.Name)
+	require.False(t, deeper.Loaded)
+	require.Empty(t, deeper.Files)
+	require.Equal(t, 3, tree.FileCount())
+	require.EqualValues(t, 1003, tree.Size())
+
+	// A missing dir fails
+	_, err = safeClient.LoadDirTree(client.LoadDirTreeInfo{DirPath: path.Join(basePath, "missing")})
+	require.Error(t, err)
+}
+
+func TestDeleteDirRecursive(t *testing.T) {
+	// Create base/a, base/sub/b, and base/sub/deeper/c
+	basePath := "/" + randomName()
+	subPath := path.Join(basePath, "sub")
+	deeperPath := path.Join(subPath, "deeper")
+	for _, dirPath := range []string{basePath, subPath, deeperPath} {
+		require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	}
+	for _, filePath := range []string{path.Join(basePath, "a"), path.Join(subPath, "b"), path.Join(deeperPath, "c")} {
+		require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	}
+
+	// Delete it all and make sure the base is gone
+	require.NoError(t, safeClient.DeleteDirRecursive(client.DeleteDirRecursiveInfo{DirPath: basePath, Concurrency: 2}))
+	_, err := safeClient.GetDir(client.GetDirInfo{DirPath: basePath})
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/cretz/go-safeclient/client"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	// Create a dir with a single file and start watching
+	dirPath := "/" + randomName()
+	filePath := path.Join(dirPath, "a")
+	require.NoError(t, safeClient.CreateDir(client.CreateDirInfo{DirPath: dirPath}))
+	defer safeClient.DeleteDir(client.DeleteDirInfo{DirPath: dirPath})
+	require.NoError(t, safeClient.CreateFile(client.CreateFileInfo{FilePath: filePath}))
+	watcher, err := safeClient.NewWatcher(client.WatcherInfo{DirPaths: []string{dirPath}, Interval: time.Second})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	// Change the file and make sure it's seen
+	require.NoError(t, safeClient.WriteFile(client.WriteFileInfo{
+		FilePath: filePath,
+		Contents: ioutil.NopCloser(strings.NewReader("FOO BAR BAZ")),
+	}))
+	event := requireWatchEvent(t, watcher)
+	require.Equal(t, client.WatchModified, event.Type)
+	require.Equal(t, filePath, event.Path)
+
+	// Delete it and make sure that's seen too
+	require.NoError(t, safeClient.DeleteFile(client.DeleteFileInfo{FilePath: filePath}))
+	event = requireWatchEvent(t, watcher)
+	require.Equal(t, client.WatchDeleted, event.Type)
+	require.Equal(t, filePath, event.Path)
+}
+
+func requireWatchEvent(t *testing.T, watcher *client.Watcher) client.WatchEvent {
+	select {
+	case event := <-watcher.Events:
+		return event
+	case err := <-watcher.Errors:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "No event")
+	}
+	return client.WatchEvent{}
+}
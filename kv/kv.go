@@ -0,0 +1,257 @@
+// Package kv is a key/value store kept as files in a SAFE directory. Each value is a file in a subdirectory picked by
+// the hash of its key so no directory listing gets too large. Every value has a version that starts at 1 and goes up
+// with each put, which can be used to only change a value if nobody else has since it was read.
+//
+// SAFE can't replace a file in one call, so a put deletes the old file before writing the new one. A get in between
+// gives ErrNotFound or ErrIncomplete. Version checks are made just before writing, so two puts at the same instant can
+// both succeed and the last one wins.
+package kv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AnyVersion can be given as the version to Store.Put and Store.Delete to change the value whatever its version is
+const AnyVersion int64 = -1
+
+// Metadata keys for a value's version and size
+const (
+	metadataVersion = "kvVersion"
+	metadataSize    = "kvSize"
+)
+
+// ErrNotFound is returned when a key has no value
+var ErrNotFound = errors.New("Key not found")
+
+// ErrVersionMismatch is returned when a value is not at the version given to change it
+var ErrVersionMismatch = errors.New("Version mismatch")
+
+// ErrIncomplete is returned when a value is read while it is being written
+var ErrIncomplete = errors.New("Value is being written")
+
+// StoreInfo are parameters for NewStore
+type StoreInfo struct {
+	// The directory to keep the values in. It is created if it doesn't exist.
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// Values larger than this are written in multiple calls of this size. If 0, client.DefaultUploadChunkSize is used.
+	ChunkSize int
+}
+
+// Entry describes a value in the store
+type Entry struct {
+	// The key of the value
+	Key string
+	// The version of the value
+	Version int64
+	// The size of the value in bytes
+	Size int64
+}
+
+type entriesByKey []Entry
+
+func (e entriesByKey) Len() int           { return len(e) }
+func (e entriesByKey) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e entriesByKey) Less(i, j int) bool { return e[i].Key < e[j].Key }
+
+// Store is a key/value store in a SAFE directory
+type Store struct {
+	c    *client.Client
+	info StoreInfo
+}
+
+// NewStore creates a store in StoreInfo.DirPath, creating the directory if it doesn't exist
+func NewStore(c *client.Client, si StoreInfo) (*Store, error) {
+	si.DirPath = path.Clean("/" + si.DirPath)
+	if si.ChunkSize <= 0 {
+		si.ChunkSize = client.DefaultUploadChunkSize
+	}
+	s := &Store{c: c, info: si}
+	if err := s.ensureDir(si.DirPath); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) ensureDir(dirPath string) error {
+	if err := s.c.MkdirAll(client.CreateDirInfo{DirPath: dirPath, Shared: s.info.Shared}); err != nil {
+		return fmt.Errorf("Unable to create %v: %v", dirPath, err)
+	}
+	return nil
+}
+
+// shardPath gives the directory the key's value is in
+func (s *Store) shardPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return path.Join(s.info.DirPath, hex.EncodeToString(sum[:1]))
+}
+
+// filePath gives the path of the key's value. Keys are hex encoded in file names so any key can be stored.
+func (s *Store) filePath(key string) string {
+	return path.Join(s.shardPath(key), hex.EncodeToString([]byte(key)))
+}
+
+// find gives the entry and file info for the key or nil if it has no value
+func (s *Store) find(key string) (*Entry, *client.FileInfo, error) {
+	if key == "" {
+		return nil, nil, errors.New("Key required")
+	}
+	dir, err := s.c.GetDir(client.GetDirInfo{DirPath: s.shardPath(key), Shared: s.info.Shared})
+	if client.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Unable to find %v: %v", key, err)
+	}
+	name := path.Base(s.filePath(key))
+	for _, file := range dir.Files {
+		if file.Name == name {
+			entry, err := fileEntry(key, file)
+			return entry, &file, err
+		}
+	}
+	return nil, nil, nil
+}
+
+func fileEntry(key string, file client.FileInfo) (*Entry, error) {
+	meta := client.ParseMetadata(file.Metadata)
+	version, err := strconv.ParseInt(meta[metadataVersion], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid version for %v: %v", key, err)
+	}
+	size, err := strconv.ParseInt(meta[metadataSize], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid size for %v: %v", key, err)
+	}
+	return &Entry{Key: key, Version: version, Size: size}, nil
+}
+
+// Get gives the value for the key and its version. If the key has no value, ErrNotFound is returned.
+func (s *Store) Get(key string) ([]byte, int64, error) {
+	entry, file, err := s.find(key)
+	if err != nil {
+		return nil, 0, err
+	} else if entry == nil {
+		return nil, 0, ErrNotFound
+	} else if file.Size != entry.Size {
+		return nil, 0, ErrIncomplete
+	}
+	rc, err := s.c.GetFile(client.GetFileInfo{FilePath: s.filePath(key), Shared: s.info.Shared})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Unable to get %v: %v", key, err)
+	}
+	defer rc.Close()
+	value, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Unable to read %v: %v", key, err)
+	} else if int64(len(value)) != entry.Size {
+		// Replaced while we were reading it
+		return nil, 0, ErrIncomplete
+	}
+	return value, entry.Version, nil
+}
+
+// Put sets the value for the key and gives its new version. Unless the version is AnyVersion, ErrVersionMismatch is
+// returned if the value isn't at that version. A version of 0 means the key must not have a value.
+func (s *Store) Put(key string, value []byte, version int64) (int64, error) {
+	entry, _, err := s.find(key)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	if entry != nil {
+		current = entry.Version
+	}
+	if version != AnyVersion && version != current {
+		return 0, ErrVersionMismatch
+	}
+	filePath := s.filePath(key)
+	if entry != nil {
+		if err = s.c.DeleteFile(client.DeleteFileInfo{FilePath: filePath, Shared: s.info.Shared}); err != nil {
+			return 0, fmt.Errorf("Unable to replace %v: %v", key, err)
+		}
+	} else if err = s.ensureDir(s.shardPath(key)); err != nil {
+		return 0, err
+	}
+	meta := client.Metadata{
+		metadataVersion: strconv.FormatInt(current+1, 10),
+		metadataSize:    strconv.Itoa(len(value)),
+	}
+	err = s.c.CreateFile(client.CreateFileInfo{FilePath: filePath, Shared: s.info.Shared, Metadata: meta.String()})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to create %v: %v", key, err)
+	}
+	for offset := 0; offset < len(value); offset += s.info.ChunkSize {
+		end := offset + s.info.ChunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		err = s.c.WriteFile(client.WriteFileInfo{
+			FilePath: filePath,
+			Shared:   s.info.Shared,
+			Contents: ioutil.NopCloser(bytes.NewReader(value[offset:end])),
+			Offset:   int64(offset),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("Unable to write %v: %v", key, err)
+		}
+	}
+	return current + 1, nil
+}
+
+// Delete removes the value for the key. Unless the version is AnyVersion, ErrVersionMismatch is returned if the value
+// isn't at that version. If the key has no value, ErrNotFound is returned.
+func (s *Store) Delete(key string, version int64) error {
+	entry, _, err := s.find(key)
+	if err != nil {
+		return err
+	} else if entry == nil {
+		return ErrNotFound
+	} else if version != AnyVersion && version != entry.Version {
+		return ErrVersionMismatch
+	}
+	if err = s.c.DeleteFile(client.DeleteFileInfo{FilePath: s.filePath(key), Shared: s.info.Shared}); err != nil {
+		return fmt.Errorf("Unable to delete %v: %v", key, err)
+	}
+	return nil
+}
+
+// List gives the entries for all keys starting with the prefix, sorted by key. Every subdirectory of the store has to
+// be listed, so this is much slower than getting a single key.
+func (s *Store) List(prefix string) ([]Entry, error) {
+	root, err := s.c.GetDir(client.GetDirInfo{DirPath: s.info.DirPath, Shared: s.info.Shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list store: %v", err)
+	}
+	entries := []Entry{}
+	for _, sub := range root.SubDirs {
+		dir, err := s.c.GetDir(client.GetDirInfo{DirPath: path.Join(s.info.DirPath, sub.Name), Shared: s.info.Shared})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list store: %v", err)
+		}
+		for _, file := range dir.Files {
+			keyBytes, err := hex.DecodeString(file.Name)
+			if err != nil || !strings.HasPrefix(string(keyBytes), prefix) {
+				// Not ours or not wanted
+				continue
+			}
+			entry, err := fileEntry(string(keyBytes), file)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Sort(entriesByKey(entries))
+	return entries, nil
+}
@@ -0,0 +1,360 @@
+// Package safelog is an append-only log of records kept in segment files in a SAFE directory. Each record is written
+// with its length and a checksum so a record that was only partly written can be told apart from a complete one.
+//
+// Every record has a position, which is its byte offset from the start of the log. Segment files are named by the
+// position they start at. A new segment is started when the current one would grow past the segment size, or when
+// the end of the current one is a torn write. SAFE can't truncate files, so the torn bytes are left in place and
+// skipped since the next segment starts where the last good record ended.
+//
+// Only one Writer may append to a log at a time. Any number of readers can read it while it is written.
+package safelog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/cretz/go-safeclient/client"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSegmentSize is the size segments roll over at if one isn't given
+const DefaultSegmentSize = 4 * 1024 * 1024
+
+// Each record is a header of the big endian length and CRC-32C of the data followed by the data
+const headerSize = 8
+
+const segmentSuffix = ".log"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when a complete record doesn't match its checksum or a position isn't at a record
+var ErrCorrupt = errors.New("Log is corrupt")
+
+// Record is a single entry in the log
+type Record struct {
+	// The position of the record
+	Position int64
+	// The position of the record after this one
+	Next int64
+	// The contents
+	Data []byte
+}
+
+// segment is a segment file in the log
+type segment struct {
+	start int64
+	size  int64
+}
+
+func segmentName(start int64) string {
+	return fmt.Sprintf("%020d%v", start, segmentSuffix)
+}
+
+type segmentsByStart []segment
+
+func (s segmentsByStart) Len() int           { return len(s) }
+func (s segmentsByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s segmentsByStart) Less(i, j int) bool { return s[i].start < s[j].start }
+
+// listSegments gives the segments in the log in order
+func listSegments(c *client.Client, dirPath string, shared bool) ([]segment, error) {
+	dir, err := c.GetDir(client.GetDirInfo{DirPath: dirPath, Shared: shared})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list log: %v", err)
+	}
+	segments := []segment{}
+	for _, file := range dir.Files {
+		if !strings.HasSuffix(file.Name, segmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(file.Name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{start: start, size: file.Size})
+	}
+	sort.Sort(segmentsByStart(segments))
+	return segments, nil
+}
+
+func readSegment(c *client.Client, dirPath string, shared bool, seg segment, offset int64) ([]byte, error) {
+	rc, err := c.GetFile(client.GetFileInfo{
+		FilePath: path.Join(dirPath, segmentName(seg.start)),
+		Shared:   shared,
+		Offset:   offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read log segment: %v", err)
+	}
+	defer rc.Close()
+	byts, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read log segment: %v", err)
+	}
+	return byts, nil
+}
+
+// parseRecord reads the record at the start of the bytes. It gives the record's data and whole size, or a size of 0
+// if the bytes end before the record does. The error is ErrCorrupt if the record is complete but its checksum is wrong.
+func parseRecord(byts []byte) ([]byte, int64, error) {
+	if len(byts) < headerSize {
+		return nil, 0, nil
+	}
+	length := int64(binary.BigEndian.Uint32(byts))
+	if int64(len(byts)) < headerSize+length {
+		return nil, 0, nil
+	}
+	data := byts[headerSize : headerSize+length]
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(byts[4:]) {
+		return nil, 0, ErrCorrupt
+	}
+	return data, headerSize + length, nil
+}
+
+// WriterInfo are parameters for NewWriter
+type WriterInfo struct {
+	// The directory of the log. It is created if it doesn't exist.
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The size in bytes past which a new segment is started. If 0, DefaultSegmentSize is used. A record larger than
+	// this gets a segment to itself.
+	SegmentSize int64
+}
+
+// Writer appends records to a log
+type Writer struct {
+	c    *client.Client
+	info WriterInfo
+	// The current segment, where size is the end of its last good record
+	current segment
+	// Whether the next record must start a new segment, either because there isn't one or its end is torn
+	roll bool
+	// Whether a write failed so what is at the end of the current segment isn't known
+	failed bool
+}
+
+// NewWriter opens the log in WriterInfo.DirPath for appending. The last segment is read to find the end of its last
+// good record.
+func NewWriter(c *client.Client, wi WriterInfo) (*Writer, error) {
+	wi.DirPath = path.Clean("/" + wi.DirPath)
+	if wi.SegmentSize <= 0 {
+		wi.SegmentSize = DefaultSegmentSize
+	}
+	w := &Writer{c: c, info: wi, roll: true}
+	if err := c.MkdirAll(client.CreateDirInfo{DirPath: wi.DirPath, Shared: wi.Shared}); err != nil {
+		return nil, fmt.Errorf("Unable to create log directory: %v", err)
+	}
+	segments, err := listSegments(c, wi.DirPath, wi.Shared)
+	if err != nil {
+		return nil, err
+	} else if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		w.current = segment{start: last.start}
+		if err = w.scan(last.size); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// scan moves the end of the current segment past the good records after it. If there are bytes after them, the next
+// record starts a new segment.
+func (w *Writer) scan(fileSize int64) error {
+	w.roll = false
+	if fileSize == w.current.size {
+		return nil
+	}
+	byts, err := readSegment(w.c, w.info.DirPath, w.info.Shared, w.current, w.current.size)
+	if err != nil {
+		return err
+	}
+	for len(byts) > 0 {
+		_, size, err := parseRecord(byts)
+		if size == 0 || err != nil {
+			w.roll = true
+			if w.current.size > 0 {
+				return nil
+			}
+			// Nothing good in it, so it's replaced by the new segment that starts at the same position
+			filePath := path.Join(w.info.DirPath, segmentName(w.current.start))
+			if err = w.c.DeleteFile(client.DeleteFileInfo{FilePath: filePath, Shared: w.info.Shared}); err != nil {
+				return fmt.Errorf("Unable to replace torn log segment: %v", err)
+			}
+			return nil
+		}
+		w.current.size += size
+		byts = byts[size:]
+	}
+	return nil
+}
+
+// Position gives the position the next record will be at
+func (w *Writer) Position() int64 {
+	return w.current.start + w.current.size
+}
+
+// Append adds the record to the end of the log and gives its position. If the write fails, what made it to SAFE is
+// checked on the next append.
+func (w *Writer) Append(data []byte) (int64, error) {
+	if w.failed {
+		segments, err := listSegments(w.c, w.info.DirPath, w.info.Shared)
+		if err != nil {
+			return 0, err
+		}
+		for _, seg := range segments {
+			if seg.start == w.current.start {
+				if err = w.scan(seg.size); err != nil {
+					return 0, err
+				}
+			}
+		}
+		w.failed = false
+	}
+	recordSize := int64(headerSize + len(data))
+	if !w.roll && w.current.size > 0 && w.current.size+recordSize > w.info.SegmentSize {
+		w.roll = true
+	}
+	if w.roll {
+		next := segment{start: w.Position()}
+		filePath := path.Join(w.info.DirPath, segmentName(next.start))
+		if err := w.c.CreateFile(client.CreateFileInfo{FilePath: filePath, Shared: w.info.Shared}); err != nil {
+			return 0, fmt.Errorf("Unable to create log segment: %v", err)
+		}
+		w.current, w.roll = next, false
+	}
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(data, crcTable))
+	copy(record[headerSize:], data)
+	err := w.c.WriteFile(client.WriteFileInfo{
+		FilePath: path.Join(w.info.DirPath, segmentName(w.current.start)),
+		Shared:   w.info.Shared,
+		Contents: ioutil.NopCloser(bytes.NewReader(record)),
+		Offset:   w.current.size,
+	})
+	if err != nil {
+		w.failed = true
+		return 0, fmt.Errorf("Unable to append to log: %v", err)
+	}
+	position := w.Position()
+	w.current.size += recordSize
+	return position, nil
+}
+
+// ReaderInfo are parameters for NewReader
+type ReaderInfo struct {
+	// The directory of the log
+	DirPath string
+	// Whether the directory is shared
+	Shared bool
+	// The position to start reading at. This must be 0 or the position of a record.
+	Position int64
+}
+
+// Reader reads records from a log in order. Once it has read everything, Next returns io.EOF and can be called again
+// later to read records appended since.
+type Reader struct {
+	c    *client.Client
+	info ReaderInfo
+	// The position of the next record
+	position int64
+	// The unread bytes of the current segment from the position
+	buf []byte
+	// The segment being read, which is nil until the position is found
+	current *segment
+	// The start of the segment after the current one or -1 if it is the last
+	limit int64
+}
+
+// NewReader creates a reader starting at ReaderInfo.Position. Nothing is read until Next is called.
+func NewReader(c *client.Client, ri ReaderInfo) *Reader {
+	ri.DirPath = path.Clean("/" + ri.DirPath)
+	return &Reader{c: c, info: ri, position: ri.Position}
+}
+
+// Position gives the position of the next record to be read
+func (r *Reader) Position() int64 {
+	return r.position
+}
+
+// Next gives the next record or io.EOF if there are no more yet. A record at the end of the log that is not complete
+// is treated as not written yet.
+func (r *Reader) Next() (*Record, error) {
+	for {
+		if r.current != nil && (r.limit < 0 || r.position < r.limit) {
+			data, size, err := parseRecord(r.buf)
+			if err != nil {
+				return nil, err
+			} else if size > 0 {
+				record := &Record{Position: r.position, Next: r.position + size, Data: data}
+				if r.limit >= 0 && record.Next > r.limit {
+					return nil, ErrCorrupt
+				}
+				r.position, r.buf = record.Next, r.buf[size:]
+				return record, nil
+			} else if r.limit >= 0 {
+				// Only the last segment may end in a partial record
+				return nil, ErrCorrupt
+			}
+		}
+		// Out of buffered records, so see what there is now
+		more, err := r.load()
+		if err != nil || !more {
+			return nil, err
+		}
+	}
+}
+
+// load reads the rest of the segment the position is in. It gives false if there is nothing new since the last load.
+func (r *Reader) load() (bool, error) {
+	segments, err := listSegments(r.c, r.info.DirPath, r.info.Shared)
+	if err != nil {
+		return false, err
+	}
+	var seg *segment
+	limit := int64(-1)
+	for i := range segments {
+		if segments[i].start <= r.position {
+			seg = &segments[i]
+			if i+1 < len(segments) {
+				limit = segments[i+1].start
+			} else {
+				limit = -1
+			}
+		}
+	}
+	if seg == nil {
+		if r.position == 0 {
+			return false, io.EOF
+		}
+		return false, ErrCorrupt
+	}
+	offset := r.position - seg.start
+	fileSize := seg.size
+	if limit >= 0 && seg.start+fileSize > limit {
+		// Bytes past the next segment's start are a torn write
+		fileSize = limit - seg.start
+	}
+	if fileSize <= offset+int64(len(r.buf)) && r.current != nil && r.current.start == seg.start && r.limit == limit {
+		return false, io.EOF
+	}
+	byts := []byte{}
+	if fileSize > offset {
+		if byts, err = readSegment(r.c, r.info.DirPath, r.info.Shared, *seg, offset); err != nil {
+			return false, err
+		}
+		if int64(len(byts)) > fileSize-offset {
+			byts = byts[:fileSize-offset]
+		}
+	}
+	r.current, r.limit, r.buf = seg, limit, byts
+	return true, nil
+}